@@ -0,0 +1,275 @@
+// Command slice slices mesh files into a print file without the web UI.
+//
+//	slice -profile "Anycubic Photon Mono X" -settings Default -o plate.pwmx part1.stl part2.3mf
+//	slice -profile printer.json -settings resin.json model.obj
+//
+// The profile and the settings are files read like an import in the web UI
+// (see slicer.ParseProfileFile), or names looked up in the database
+// configured like the server (.env or DB_* variables).
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"3dmodels/internal/config"
+	"3dmodels/internal/database"
+	"3dmodels/internal/models"
+	"3dmodels/internal/repository"
+	"3dmodels/internal/slicer"
+)
+
+func main() {
+	profileArg := flag.String("profile", "", "printer profile: a JSON file or the name of a profile in the database")
+	settingsArg := flag.String("settings", "", "print settings: a JSON file or the name of settings of the profile (default: the profile's default settings)")
+	output := flag.String("o", "", "output file (default: the first mesh's name with the format's extension)")
+	format := flag.String("format", "", "output format ID, overriding the profile's")
+	name := flag.String("name", "", "job name recorded in the file (default: the first mesh's name)")
+	arrange := flag.Bool("arrange", false, "pack the objects on the plate instead of centering each")
+	orient := flag.String("orient", "", "auto-orient every mesh: supports, peel or height")
+	verbose := flag.Bool("v", false, "show the slicer's log")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s -profile PROFILE [flags] MESH...\n\n", filepath.Base(os.Args[0]))
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files := flag.Args()
+	if len(files) == 0 || *profileArg == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	req := slicer.SliceRequest{FilePaths: files, FileFormat: *format, Arrange: *arrange, ModelName: *name}
+	if req.ModelName == "" {
+		req.ModelName = strings.TrimSuffix(filepath.Base(files[0]), filepath.Ext(files[0]))
+	}
+	if *orient != "" {
+		goal, ok := slicer.ParseOrientGoal(*orient)
+		if !ok {
+			fatalf("unknown orientation goal %q", *orient)
+		}
+		req.Orient = goal
+	}
+	if *format != "" {
+		if _, ok := slicer.LookupOutputFormat(*format); !ok {
+			fatalf("unknown output format %q", *format)
+		}
+	}
+	for _, f := range files {
+		if _, err := os.Stat(f); err != nil {
+			fatalf("%v", err)
+		}
+	}
+
+	var err error
+	if req.Profile, err = loadProfile(*profileArg); err != nil {
+		fatalf("profile: %v", err)
+	}
+	if req.Settings, err = loadSettings(*settingsArg, req.Profile); err != nil {
+		fatalf("settings: %v", err)
+	}
+
+	outDir := "."
+	if *output != "" {
+		outDir = filepath.Dir(*output)
+	}
+	engine := slicer.NewEngine(nil, outDir, 1)
+	jobID, err := engine.StartSlice(req)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	job := waitForJob(engine, jobID)
+	if job.Status != "complete" {
+		fatalf("%s", job.Message)
+	}
+
+	dest := *output
+	if dest == "" {
+		dest = req.ModelName + "." + job.Extension
+	}
+	if err := os.Rename(job.OutputPath, dest); err != nil {
+		os.Remove(job.OutputPath)
+		fatalf("%v", err)
+	}
+	printSummary(dest, job)
+}
+
+// fatalf reports an error and exits; log is silenced unless -v is given.
+func fatalf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "slice: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// isJSONFile reports whether a -profile or -settings value names a file
+// rather than a database entry.
+func isJSONFile(arg string) bool {
+	if strings.HasSuffix(strings.ToLower(arg), ".json") {
+		return true
+	}
+	fi, err := os.Stat(arg)
+	return err == nil && !fi.IsDir()
+}
+
+// readProfileFile reads a profile or settings file through the same parser
+// and validation as the import in the web UI.
+func readProfileFile(path string) (*slicer.ProfileBundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := slicer.ParseProfileFile(path, data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return b, nil
+}
+
+func loadProfile(arg string) (*models.PrinterProfile, error) {
+	if isJSONFile(arg) {
+		b, err := readProfileFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(b.Profiles) != 1 {
+			return nil, fmt.Errorf("%s: expected one printer profile, found %d", arg, len(b.Profiles))
+		}
+		return &b.Profiles[0].Profile, nil
+	}
+
+	repo, err := openRepo()
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := repo.GetAllProfiles()
+	if err != nil {
+		return nil, err
+	}
+	for i := range profiles {
+		if strings.EqualFold(profiles[i].Name, arg) {
+			return &profiles[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no printer profile named %q", arg)
+}
+
+// loadSettings reads settings from a JSON file, on top of the defaults, or
+// from the database: by name, or the profile's default when arg is empty.
+func loadSettings(arg string, profile *models.PrinterProfile) (*models.PrintSettings, error) {
+	if arg == "" && profile.ID == 0 {
+		return slicer.DefaultPrintSettings(0), nil
+	}
+	if arg != "" && isJSONFile(arg) {
+		b, err := readProfileFile(arg)
+		if err != nil {
+			return nil, err
+		}
+		all := b.Settings
+		for _, p := range b.Profiles {
+			all = append(all, p.Settings...)
+		}
+		if len(all) != 1 {
+			return nil, fmt.Errorf("%s: expected one set of print settings, found %d", arg, len(all))
+		}
+		s := &all[0]
+		s.ProfileID = profile.ID
+		return s, nil
+	}
+	if profile.ID == 0 {
+		return nil, fmt.Errorf("settings %q can only be looked up for a profile from the database", arg)
+	}
+
+	repo, err := openRepo()
+	if err != nil {
+		return nil, err
+	}
+	if arg == "" {
+		s, err := repo.GetDefaultSettings(profile.ID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return slicer.DefaultPrintSettings(profile.ID), nil
+		}
+		return s, err
+	}
+	all, err := repo.GetSettingsByProfile(profile.ID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range all {
+		if strings.EqualFold(all[i].Name, arg) {
+			return &all[i], nil
+		}
+	}
+	return nil, fmt.Errorf("profile %q has no settings named %q", profile.Name, arg)
+}
+
+// slicerRepo is opened on the first lookup by name, so slicing from JSON
+// files works without a database.
+var slicerRepo *repository.SlicerRepository
+
+func openRepo() (*repository.SlicerRepository, error) {
+	if slicerRepo != nil {
+		return slicerRepo, nil
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	db, err := database.Open(cfg.DatabaseURL())
+	if err != nil {
+		return nil, err
+	}
+	slicerRepo = repository.NewSlicerRepository(db)
+	return slicerRepo, nil
+}
+
+// waitForJob polls the job, printing its progress to stderr, until it ends.
+func waitForJob(engine *slicer.Engine, jobID string) *models.SliceJob {
+	lastProgress, lastStatus := -1, ""
+	for {
+		job, err := engine.GetJobStatus(jobID)
+		if err != nil {
+			fatalf("%v", err)
+		}
+		if job.Progress != lastProgress || job.Status != lastStatus {
+			fmt.Fprintf(os.Stderr, "[%3d%%] %s\n", job.Progress, job.Message)
+			lastProgress, lastStatus = job.Progress, job.Status
+		}
+		switch job.Status {
+		case "complete", "error", "cancelled":
+			return job
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
+
+func printSummary(path string, job *models.SliceJob) {
+	var size int64
+	if fi, err := os.Stat(path); err == nil {
+		size = fi.Size()
+	}
+	fmt.Printf("Output:      %s (%.1f MB)\n", path, float64(size)/(1<<20))
+	fmt.Printf("Layers:      %d\n", job.TotalLayers)
+	fmt.Printf("Print time:  %s\n", (time.Duration(job.PrintTimeS) * time.Second).String())
+	if job.ResinCost > 0 {
+		fmt.Printf("Resin:       %.2f ml (cost %.2f)\n", job.ResinML, job.ResinCost)
+	} else {
+		fmt.Printf("Resin:       %.2f ml\n", job.ResinML)
+	}
+	if job.Hollowed {
+		fmt.Printf("Hollowing:   saved %.2f ml (%.0f%%), %d drain holes\n", job.ResinSavedML, job.ResinSavedPct, job.DrainHoles)
+	}
+	if job.OpenContours > 0 {
+		fmt.Printf("Warning:     %d open contours (first layers: %v)\n", job.OpenContours, job.OpenContourLayers)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -19,6 +20,9 @@ type Config struct {
 	DBName     string
 	DBSSLMode  string
 	JWTSecret  string
+
+	SliceOutputDir string // where sliced files are kept until retention removes them
+	SliceWorkers   int    // slice jobs running at once; the others wait in the queue
 }
 
 func (c *Config) DatabaseURL() string {
@@ -48,6 +52,12 @@ func Load() (*Config, error) {
 		DBName:     getEnv("DB_NAME", "models3d"),
 		DBSSLMode:  getEnv("DB_SSLMODE", "disable"),
 		JWTSecret:  jwtSecret,
+
+		SliceOutputDir: getEnv("SLICE_OUTPUT_DIR", "slices"),
+		SliceWorkers:   1,
+	}
+	if n, err := strconv.Atoi(os.Getenv("SLICE_WORKERS")); err == nil && n > 0 {
+		cfg.SliceWorkers = n
 	}
 
 	return cfg, nil
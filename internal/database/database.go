@@ -120,13 +120,22 @@ func migrate(db *sql.DB) error {
 		}
 	}
 
+	// Conditional migration: add slicer settings columns added after the first release
+	log.Println("[migrate] checking print_settings columns...")
+	if err := addMissingColumns(db, "print_settings", printSettingsColumns); err != nil {
+		return err
+	}
+
 	// Seed printer profiles
 	log.Println("[migrate] seeding printer profiles...")
 	if err := seedPrinterProfiles(db); err != nil {
 		return fmt.Errorf("seed printer profiles: %w", err)
 	}
-	if err := ensurePhotonUltra(db); err != nil {
-		return fmt.Errorf("ensure photon ultra: %w", err)
+	if err := ensureBuiltInProfiles(db); err != nil {
+		return fmt.Errorf("ensure built-in profiles: %w", err)
+	}
+	if err := migrateAnycubicFormats(db); err != nil {
+		return fmt.Errorf("migrate anycubic formats: %w", err)
 	}
 
 	// Seed default feedback categories if table is empty
@@ -181,6 +190,57 @@ func migrate(db *sql.DB) error {
 	return nil
 }
 
+// printSettingsColumns lists the print_settings columns that existing
+// databases may lack, with their definitions.
+var printSettingsColumns = [][2]string{
+	{"hollow_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"hollow_wall_mm", "DOUBLE PRECISION NOT NULL DEFAULT 2.0"},
+	{"infill_spacing_mm", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"infill_thickness_mm", "DOUBLE PRECISION NOT NULL DEFAULT 1.0"},
+	{"drain_hole_diameter_mm", "DOUBLE PRECISION NOT NULL DEFAULT 3.0"},
+	{"supports_enabled", "BOOLEAN NOT NULL DEFAULT FALSE"},
+	{"support_type", "TEXT NOT NULL DEFAULT 'pillar'"},
+	{"support_tip_diameter_mm", "DOUBLE PRECISION NOT NULL DEFAULT 0.4"},
+	{"support_density_pct", "DOUBLE PRECISION NOT NULL DEFAULT 50"},
+	{"support_angle_deg", "DOUBLE PRECISION NOT NULL DEFAULT 45"},
+	{"resin_price_per_l", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"resin_brand", "TEXT NOT NULL DEFAULT ''"},
+	{"resin_color", "TEXT NOT NULL DEFAULT ''"},
+	{"transition_layers", "INTEGER NOT NULL DEFAULT 0"},
+	{"light_off_delay_s", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"bottom_light_off_delay_s", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"wait_before_cure_s", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"wait_after_cure_s", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"wait_after_lift_s", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"lift_height2_mm", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"lift_speed2_mmps", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"retract_height2_mm", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"retract_speed2_mmps", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"light_pwm", "INTEGER NOT NULL DEFAULT 255"},
+	{"bottom_light_pwm", "INTEGER NOT NULL DEFAULT 255"},
+	{"xy_compensation_um", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{"elephant_foot_um", "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+}
+
+// addMissingColumns adds every {name, definition} column that table lacks.
+func addMissingColumns(db *sql.DB, table string, columns [][2]string) error {
+	for _, col := range columns {
+		var count int
+		err := db.QueryRow(`SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_name = $1 AND column_name = $2`, table, col[0]).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("check %s.%s column: %w", table, col[0], err)
+		}
+		if count > 0 {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, col[0], col[1])); err != nil {
+			return fmt.Errorf("add %s.%s column: %w", table, col[0], err)
+		}
+	}
+	return nil
+}
+
 // backfillUserRoles assegna ROLE_USER a tutti gli utenti senza ruoli e
 // ROLE_ADMIN al primo utente (id minore) se non ce l'ha già.
 func backfillUserRoles(db *sql.DB) error {
@@ -247,25 +307,26 @@ func seedPrinterProfiles(db *sql.DB) error {
 		width, depth, height float64
 		resX, resY  int
 		pixelUM     float64
+		fileFormat  string
 	}
 
 	profiles := []profile{
-		{"Photon Mono", 130, 80, 165, 2560, 1620, 51},
-		{"Photon Mono X", 192, 120, 245, 3840, 2400, 50},
-		{"Photon Mono X 6Ks", 196, 122, 200, 5760, 3600, 34},
-		{"Photon Ultra", 102.4, 57.6, 165, 1280, 720, 80},
-		{"Photon M3", 164, 102, 180, 4096, 2560, 40},
-		{"Photon M3 Plus", 197, 122, 245, 5760, 3600, 34},
-		{"Photon M3 Max", 298, 164, 300, 6480, 3600, 46},
+		{"Photon Mono", 130, 80, 165, 2560, 1620, 51, "pwmo"},
+		{"Photon Mono X", 192, 120, 245, 3840, 2400, 50, "pwmx"},
+		{"Photon Mono X 6Ks", 196, 122, 200, 5760, 3600, 34, "px6s"},
+		{"Photon Ultra", 102.4, 57.6, 165, 1280, 720, 80, "dlp"},
+		{"Photon M3", 164, 102, 180, 4096, 2560, 40, "pm3"},
+		{"Photon M3 Plus", 197, 122, 245, 5760, 3600, 34, "pwmb"},
+		{"Photon M3 Max", 298, 164, 300, 6480, 3600, 46, "pm3m"},
 	}
 
 	for _, p := range profiles {
 		var profileID int64
 		err := db.QueryRow(`
-			INSERT INTO printer_profiles (name, manufacturer, build_width_mm, build_depth_mm, build_height_mm, resolution_x, resolution_y, pixel_size_um, is_built_in)
-			VALUES ($1, 'Anycubic', $2, $3, $4, $5, $6, $7, TRUE)
+			INSERT INTO printer_profiles (name, manufacturer, build_width_mm, build_depth_mm, build_height_mm, resolution_x, resolution_y, pixel_size_um, file_format, is_built_in)
+			VALUES ($1, 'Anycubic', $2, $3, $4, $5, $6, $7, $8, TRUE)
 			RETURNING id`,
-			p.name, p.width, p.depth, p.height, p.resX, p.resY, p.pixelUM,
+			p.name, p.width, p.depth, p.height, p.resX, p.resY, p.pixelUM, p.fileFormat,
 		).Scan(&profileID)
 		if err != nil {
 			return fmt.Errorf("insert profile %s: %w", p.name, err)
@@ -285,33 +346,89 @@ func seedPrinterProfiles(db *sql.DB) error {
 	return nil
 }
 
-// ensurePhotonUltra adds the Photon Ultra profile if it doesn't exist (for DBs seeded before it was added).
-func ensurePhotonUltra(db *sql.DB) error {
-	var exists int
-	if err := db.QueryRow(`SELECT COUNT(*) FROM printer_profiles WHERE name = 'Photon Ultra' AND manufacturer = 'Anycubic'`).Scan(&exists); err != nil {
-		return err
-	}
-	if exists > 0 {
-		return nil
-	}
+// builtInProfile is a printer profile every database should have.
+type builtInProfile struct {
+	name, manufacturer   string
+	width, depth, height float64
+	resX, resY           int
+	pixelUM              float64
+	fileFormat           string
+}
 
-	var profileID int64
-	err := db.QueryRow(`
-		INSERT INTO printer_profiles (name, manufacturer, build_width_mm, build_depth_mm, build_height_mm, resolution_x, resolution_y, pixel_size_um, is_built_in)
-		VALUES ('Photon Ultra', 'Anycubic', 102.4, 57.6, 165, 1280, 720, 80, TRUE)
-		RETURNING id`).Scan(&profileID)
-	if err != nil {
-		return err
-	}
+// laterBuiltInProfiles were added after the first seed, so existing databases
+// get them from ensureBuiltInProfiles.
+var laterBuiltInProfiles = []builtInProfile{
+	{"Photon Ultra", "Anycubic", 102.4, 57.6, 165, 1280, 720, 80, "dlp"},
+	{"Original Prusa SL1", "Prusa", 120.96, 68.04, 150, 2560, 1440, 47.25, "sl1"},
+	{"Original Prusa SL1S SPEED", "Prusa", 127, 80, 150, 2560, 1620, 49.6, "sl1s"},
+	{"Mars 2 Pro", "Elegoo", 129.6, 80.64, 160, 2560, 1620, 50, "ctb3"},
+	{"Mars 3", "Elegoo", 143.43, 89.6, 175, 4098, 2560, 35, "ctb"},
+	{"Mars 3 Pro", "Elegoo", 143.43, 89.6, 175, 4098, 2560, 35, "ctb"},
+	{"Saturn", "Elegoo", 192, 120, 200, 3840, 2400, 50, "ctb3"},
+	{"Saturn 2", "Elegoo", 219.52, 123.84, 250, 7680, 4320, 28.5, "ctb"},
+	{"Mars 4 Ultra", "Elegoo", 153.36, 77.76, 165, 9024, 5120, 17, "goo"},
+	{"Saturn 3 Ultra", "Elegoo", 218.88, 122.88, 260, 11520, 5120, 19, "goo"},
+}
 
-	_, err = db.Exec(`
-		INSERT INTO print_settings (name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s, bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps, anti_aliasing, is_default)
-		VALUES ('Default', $1, 0.05, 2.0, 30.0, 5, 6.0, 2.0, 4.0, 1, TRUE)`, profileID)
-	if err != nil {
-		return err
+// ensureBuiltInProfiles adds every profile of laterBuiltInProfiles that
+// doesn't exist yet, with default settings.
+func ensureBuiltInProfiles(db *sql.DB) error {
+	for _, p := range laterBuiltInProfiles {
+		var exists int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM printer_profiles WHERE name = $1 AND manufacturer = $2`,
+			p.name, p.manufacturer).Scan(&exists); err != nil {
+			return err
+		}
+		if exists > 0 {
+			continue
+		}
+
+		var profileID int64
+		err := db.QueryRow(`
+			INSERT INTO printer_profiles (name, manufacturer, build_width_mm, build_depth_mm, build_height_mm, resolution_x, resolution_y, pixel_size_um, file_format, is_built_in)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, TRUE)
+			RETURNING id`,
+			p.name, p.manufacturer, p.width, p.depth, p.height, p.resX, p.resY, p.pixelUM, p.fileFormat,
+		).Scan(&profileID)
+		if err != nil {
+			return fmt.Errorf("insert profile %s: %w", p.name, err)
+		}
+
+		_, err = db.Exec(`
+			INSERT INTO print_settings (name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s, bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps, anti_aliasing, is_default)
+			VALUES ('Default', $1, 0.05, 2.0, 30.0, 5, 6.0, 2.0, 4.0, 1, TRUE)`, profileID)
+		if err != nil {
+			return fmt.Errorf("insert default settings for %s: %w", p.name, err)
+		}
+
+		log.Printf("[migrate] added %s profile", p.name)
 	}
+	return nil
+}
+
+// anycubicFormats maps the built-in Anycubic profiles to the Photon Workshop
+// format their firmware reads.
+var anycubicFormats = map[string]string{
+	"Photon Mono":       "pwmo",
+	"Photon Mono X":     "pwmx",
+	"Photon Mono X 6Ks": "px6s",
+	"Photon Ultra":      "dlp",
+	"Photon M3":         "pm3",
+	"Photon M3 Plus":    "pwmb",
+	"Photon M3 Max":     "pm3m",
+}
 
-	log.Println("[migrate] added Photon Ultra profile")
+// migrateAnycubicFormats moves the built-in Anycubic profiles seeded with the
+// legacy .photon format to their native one. Profiles whose format was
+// changed by hand are left alone.
+func migrateAnycubicFormats(db *sql.DB) error {
+	for name, format := range anycubicFormats {
+		if _, err := db.Exec(`UPDATE printer_profiles SET file_format = $1
+			WHERE name = $2 AND manufacturer = 'Anycubic' AND is_built_in AND file_format = 'photon'`,
+			format, name); err != nil {
+			return fmt.Errorf("update %s: %w", name, err)
+		}
+	}
 	return nil
 }
 
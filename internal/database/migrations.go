@@ -141,8 +141,61 @@ CREATE TABLE IF NOT EXISTS print_settings (
     retract_speed_mmps DOUBLE PRECISION NOT NULL DEFAULT 4.0,
     anti_aliasing INTEGER NOT NULL DEFAULT 1,
     is_default BOOLEAN DEFAULT FALSE,
-    created_at TIMESTAMPTZ DEFAULT NOW()
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    hollow_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    hollow_wall_mm DOUBLE PRECISION NOT NULL DEFAULT 2.0,
+    infill_spacing_mm DOUBLE PRECISION NOT NULL DEFAULT 0,
+    infill_thickness_mm DOUBLE PRECISION NOT NULL DEFAULT 1.0,
+    drain_hole_diameter_mm DOUBLE PRECISION NOT NULL DEFAULT 3.0,
+    supports_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    support_type TEXT NOT NULL DEFAULT 'pillar',
+    support_tip_diameter_mm DOUBLE PRECISION NOT NULL DEFAULT 0.4,
+    support_density_pct DOUBLE PRECISION NOT NULL DEFAULT 50,
+    support_angle_deg DOUBLE PRECISION NOT NULL DEFAULT 45,
+    resin_price_per_l DOUBLE PRECISION NOT NULL DEFAULT 0,
+    resin_brand TEXT NOT NULL DEFAULT '',
+    resin_color TEXT NOT NULL DEFAULT '',
+    transition_layers INTEGER NOT NULL DEFAULT 0,
+    light_off_delay_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    bottom_light_off_delay_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    wait_before_cure_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    wait_after_cure_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    wait_after_lift_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    lift_height2_mm DOUBLE PRECISION NOT NULL DEFAULT 0,
+    lift_speed2_mmps DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retract_height2_mm DOUBLE PRECISION NOT NULL DEFAULT 0,
+    retract_speed2_mmps DOUBLE PRECISION NOT NULL DEFAULT 0,
+    light_pwm INTEGER NOT NULL DEFAULT 255,
+    bottom_light_pwm INTEGER NOT NULL DEFAULT 255,
+    xy_compensation_um DOUBLE PRECISION NOT NULL DEFAULT 0,
+    elephant_foot_um DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS slice_jobs (
+    id TEXT PRIMARY KEY,
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+    model_id INTEGER REFERENCES models(id) ON DELETE SET NULL,
+    model_name TEXT NOT NULL DEFAULT '',
+    file_ids TEXT NOT NULL DEFAULT '',
+    profile_id INTEGER REFERENCES printer_profiles(id) ON DELETE SET NULL,
+    profile_name TEXT NOT NULL DEFAULT '',
+    output_format TEXT NOT NULL DEFAULT '',
+    settings JSONB NOT NULL,
+    options JSONB NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    message TEXT NOT NULL DEFAULT '',
+    total_layers INTEGER NOT NULL DEFAULT 0,
+    print_time_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+    resin_ml DOUBLE PRECISION NOT NULL DEFAULT 0,
+    resin_cost DOUBLE PRECISION NOT NULL DEFAULT 0,
+    extension TEXT NOT NULL DEFAULT '',
+    output_path TEXT NOT NULL DEFAULT '',
+    output_size BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    finished_at TIMESTAMPTZ
 );
+CREATE INDEX IF NOT EXISTS idx_slice_jobs_user ON slice_jobs(user_id, created_at DESC);
 
 CREATE TABLE IF NOT EXISTS roles (
     id SERIAL PRIMARY KEY,
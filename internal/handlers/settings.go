@@ -83,6 +83,8 @@ func (h *SettingsHandler) Page(w http.ResponseWriter, r *http.Request) {
 		Users:              users,
 		AllRoles:           allRoles,
 		PrinterProfiles:    printerProfiles,
+		SliceRetentionDays: h.settingsRepo.GetInt("slice_retention_days", DefaultSliceRetentionDays),
+		SliceCacheMB:       h.settingsRepo.GetInt("slice_cache_mb", DefaultSliceCacheMB),
 		ActiveTab:          activeTab,
 		Username:           username,
 		IsAdmin:            isAdmin,
@@ -122,6 +124,44 @@ func (h *SettingsHandler) SaveExcludedFolders(w http.ResponseWriter, r *http.Req
 	templates.ExcludedFoldersSaved(excludedFolders).Render(r.Context(), w)
 }
 
+// DefaultSliceRetentionDays is how long slice jobs are kept when the
+// setting was never saved.
+const DefaultSliceRetentionDays = 30
+
+func (h *SettingsHandler) SaveSliceRetention(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("slice_retention_days"))
+	if err != nil || days < 0 {
+		http.Error(w, "Invalid number of days", http.StatusBadRequest)
+		return
+	}
+	h.settingsRepo.Set("slice_retention_days", strconv.Itoa(days))
+
+	templates.SliceRetentionSaved().Render(r.Context(), w)
+}
+
+// DefaultSliceCacheMB is the slice output cache budget when the setting was
+// never saved.
+const DefaultSliceCacheMB = 1024
+
+func (h *SettingsHandler) SaveSliceCache(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	mb, err := strconv.Atoi(r.FormValue("slice_cache_mb"))
+	if err != nil || mb < 0 {
+		http.Error(w, "Invalid cache size", http.StatusBadRequest)
+		return
+	}
+	h.settingsRepo.Set("slice_cache_mb", strconv.Itoa(mb))
+
+	templates.SliceCacheSaved().Render(r.Context(), w)
+}
+
 func (h *SettingsHandler) ForceScan(w http.ResponseWriter, r *http.Request) {
 	h.scanner.StartScan()
 	status := h.scanner.Status()
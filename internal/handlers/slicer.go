@@ -1,12 +1,18 @@
 package handlers
 
 import (
+	"encoding/json"
 	"fmt"
+	"html"
+	"image/png"
+	"io"
+	"log"
 	"net/http"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"3dmodels/internal/i18n"
 	"3dmodels/internal/middleware"
 	"3dmodels/internal/models"
 	"3dmodels/internal/repository"
@@ -70,7 +76,7 @@ func (h *SlicerHandler) Page(w http.ResponseWriter, r *http.Request) {
 				modelFiles, err := h.modelRepo.GetFilesByModel(modelID)
 				if err == nil {
 					for _, f := range modelFiles {
-						if f.ID == id {
+						if f.ID == id && slicer.IsSliceableExt(f.FileExt) {
 							files = append(files, f)
 						}
 					}
@@ -98,8 +104,10 @@ func (h *SlicerHandler) Page(w http.ResponseWriter, r *http.Request) {
 
 	// Load default settings for selected profile
 	var settings *models.PrintSettings
+	var presets []models.PrintSettings
 	if selectedProfileID > 0 {
 		settings, _ = h.slicerRepo.GetDefaultSettings(selectedProfileID)
+		presets, _ = h.slicerRepo.GetSettingsByProfile(selectedProfileID)
 	}
 
 	data := templates.SlicerPageData{
@@ -108,6 +116,7 @@ func (h *SlicerHandler) Page(w http.ResponseWriter, r *http.Request) {
 		ModelName:         modelName,
 		Profiles:          profiles,
 		Settings:          settings,
+		Presets:           presets,
 		SelectedProfileID: selectedProfileID,
 		Username:          username,
 		IsAdmin:           isAdmin,
@@ -151,6 +160,10 @@ func (h *SlicerHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 		PixelSizeUM:   parseFloat(r.FormValue("pixel_size_um")),
 		FileFormat:    r.FormValue("file_format"),
 	}
+	if _, ok := slicer.LookupOutputFormat(p.FileFormat); !ok {
+		http.Error(w, "Unsupported file format", http.StatusBadRequest)
+		return
+	}
 
 	if err := h.slicerRepo.CreateProfile(p); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -158,19 +171,9 @@ func (h *SlicerHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Also create default settings
-	s := &models.PrintSettings{
-		Name:             "Default",
-		ProfileID:        p.ID,
-		LayerHeightMM:    0.05,
-		ExposureTimeS:    2.0,
-		BottomExposureS:  30.0,
-		BottomLayers:     5,
-		LiftHeightMM:     6.0,
-		LiftSpeedMMPS:    2.0,
-		RetractSpeedMMPS: 4.0,
-		AntiAliasing:     1,
-		IsDefault:        true,
-	}
+	s := slicer.DefaultPrintSettings(p.ID)
+	s.Name = "Default"
+	s.IsDefault = true
 	h.slicerRepo.CreateSettings(s)
 
 	profiles, _ := h.slicerRepo.GetAllProfiles()
@@ -204,6 +207,10 @@ func (h *SlicerHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
 		PixelSizeUM:   parseFloat(r.FormValue("pixel_size_um")),
 		FileFormat:    r.FormValue("file_format"),
 	}
+	if _, ok := slicer.LookupOutputFormat(p.FileFormat); !ok {
+		http.Error(w, "Unsupported file format", http.StatusBadRequest)
+		return
+	}
 
 	if err := h.slicerRepo.UpdateProfile(p); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -241,6 +248,208 @@ func (h *SlicerHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// ExportProfiles downloads printer profiles and their print settings as a
+// JSON bundle: every profile, or only the one given by ?id=.
+func (h *SlicerHandler) ExportProfiles(w http.ResponseWriter, r *http.Request) {
+	var profiles []models.PrinterProfile
+	fileName := "printer-profiles.json"
+	if idStr := r.URL.Query().Get("id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid ID", http.StatusBadRequest)
+			return
+		}
+		p, err := h.slicerRepo.GetProfileByID(id)
+		if err != nil {
+			http.Error(w, "Profile not found", http.StatusNotFound)
+			return
+		}
+		profiles = []models.PrinterProfile{*p}
+		fileName = exportFileName(p.Name) + ".json"
+	} else {
+		var err error
+		if profiles, err = h.slicerRepo.GetAllProfiles(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	settings := make(map[int64][]models.PrintSettings, len(profiles))
+	for _, p := range profiles {
+		s, err := h.slicerRepo.GetSettingsByProfile(p.ID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		settings[p.ID] = s
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(slicer.NewProfileBundle(profiles, settings))
+}
+
+// exportFileName turns a profile name into a file name without characters
+// that need quoting in a Content-Disposition header.
+func exportFileName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r == '/' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return "printer-profile"
+	}
+	return name
+}
+
+// maxProfileImportSize bounds an uploaded profile file.
+const maxProfileImportSize = 1 << 20
+
+// ImportProfiles reads an uploaded JSON bundle, PrusaSlicer SLA preset or
+// Chitubox/UVtools machine definition (see slicer.ParseProfileFile). A
+// printer whose name matches an existing profile is not changed: its print
+// settings are added to that profile, replacing settings of the same name.
+// Settings without a printer go to the profile chosen in the form.
+func (h *SlicerHandler) ImportProfiles(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxProfileImportSize+1<<16)
+	renderResult := func(msg string, ok bool) {
+		profiles, _ := h.slicerRepo.GetAllProfiles()
+		templates.ProfileImportResult(profiles, msg, ok).Render(r.Context(), w)
+	}
+
+	file, fh, err := r.FormFile("file")
+	if err != nil {
+		renderResult(i18n.T(r.Context(), "settings.profile_import_no_file"), false)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxProfileImportSize+1))
+	if err != nil {
+		renderResult(err.Error(), false)
+		return
+	}
+	if len(data) > maxProfileImportSize {
+		renderResult(i18n.T(r.Context(), "settings.profile_import_too_large"), false)
+		return
+	}
+
+	bundle, err := slicer.ParseProfileFile(fh.Filename, data)
+	if err != nil {
+		renderResult(err.Error(), false)
+		return
+	}
+	targetID, _ := strconv.ParseInt(r.FormValue("profile_id"), 10, 64)
+	if len(bundle.Settings) > 0 {
+		if _, err := h.slicerRepo.GetProfileByID(targetID); err != nil {
+			renderResult(i18n.T(r.Context(), "settings.profile_import_no_target"), false)
+			return
+		}
+	}
+
+	nProfiles, nSettings, err := h.importProfileBundle(bundle, targetID)
+	if err != nil {
+		log.Printf("Profile import %s: %v", fh.Filename, err)
+		renderResult(err.Error(), false)
+		return
+	}
+	renderResult(i18n.T(r.Context(), "settings.profile_import_done", nProfiles, nSettings), true)
+}
+
+// importProfileBundle stores an imported bundle, returning how many
+// profiles were created and how many settings were created or replaced.
+func (h *SlicerHandler) importProfileBundle(b *slicer.ProfileBundle, targetID int64) (int, int, error) {
+	existing, err := h.slicerRepo.GetAllProfiles()
+	if err != nil {
+		return 0, 0, err
+	}
+	nProfiles, nSettings := 0, 0
+	for _, bp := range b.Profiles {
+		p := bp.Profile
+		isNew := true
+		for _, e := range existing {
+			if strings.EqualFold(e.Name, p.Name) {
+				p, isNew = e, false
+				break
+			}
+		}
+		if isNew {
+			if err := h.slicerRepo.CreateProfile(&p); err != nil {
+				return nProfiles, nSettings, fmt.Errorf("create profile %q: %w", p.Name, err)
+			}
+			existing = append(existing, p)
+			nProfiles++
+		}
+
+		settings := bp.Settings
+		if isNew && len(settings) == 0 {
+			s := slicer.DefaultPrintSettings(p.ID)
+			s.Name = "Default"
+			settings = []models.PrintSettings{*s}
+		}
+		n, err := h.importSettings(p.ID, settings, isNew)
+		nSettings += n
+		if err != nil {
+			return nProfiles, nSettings, err
+		}
+	}
+	if len(b.Settings) > 0 {
+		n, err := h.importSettings(targetID, b.Settings, false)
+		nSettings += n
+		if err != nil {
+			return nProfiles, nSettings, err
+		}
+	}
+	return nProfiles, nSettings, nil
+}
+
+// importSettings adds settings to a profile, replacing those with the same
+// name. On a new profile the settings marked default in the file, or else
+// the first ones, become the default.
+func (h *SlicerHandler) importSettings(profileID int64, settings []models.PrintSettings, isNew bool) (int, error) {
+	current, err := h.slicerRepo.GetSettingsByProfile(profileID)
+	if err != nil {
+		return 0, err
+	}
+	defaultIdx := -1
+	if isNew {
+		defaultIdx = 0
+		for i, s := range settings {
+			if s.IsDefault {
+				defaultIdx = i
+				break
+			}
+		}
+	}
+	n := 0
+	for i, s := range settings {
+		s.ProfileID = profileID
+		s.IsDefault = i == defaultIdx
+		replaced := false
+		for _, c := range current {
+			if strings.EqualFold(c.Name, s.Name) {
+				s.ID, s.IsDefault = c.ID, c.IsDefault
+				if err := h.slicerRepo.UpdateSettings(&s); err != nil {
+					return n, fmt.Errorf("update settings %q: %w", s.Name, err)
+				}
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			if err := h.slicerRepo.CreateSettings(&s); err != nil {
+				return n, fmt.Errorf("create settings %q: %w", s.Name, err)
+			}
+			current = append(current, s)
+		}
+		n++
+	}
+	return n, nil
+}
+
 // isSettingsRequest checks if the HTMX request originated from the settings page
 func isSettingsRequest(r *http.Request) bool {
 	referer := r.Header.Get("Hx-Current-Url")
@@ -250,6 +459,8 @@ func isSettingsRequest(r *http.Request) bool {
 	return strings.Contains(referer, "/settings")
 }
 
+// GetSettings renders the settings form of a profile with its default
+// resin preset, or the preset given by ?settings_id=.
 func (h *SlicerHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 	profileIDStr := chi.URLParam(r, "profileId")
 	profileID, err := strconv.ParseInt(profileIDStr, 10, 64)
@@ -258,61 +469,202 @@ func (h *SlicerHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	settings, err := h.slicerRepo.GetDefaultSettings(profileID)
-	if err != nil {
-		// Return empty default settings
-		settings = &models.PrintSettings{
-			ProfileID:        profileID,
-			LayerHeightMM:    0.05,
-			ExposureTimeS:    2.0,
-			BottomExposureS:  30.0,
-			BottomLayers:     5,
-			LiftHeightMM:     6.0,
-			LiftSpeedMMPS:    2.0,
-			RetractSpeedMMPS: 4.0,
-			AntiAliasing:     1,
+	var settings *models.PrintSettings
+	if id, err := strconv.ParseInt(r.URL.Query().Get("settings_id"), 10, 64); err == nil {
+		if s, err := h.slicerRepo.GetSettingsByID(id); err == nil && s.ProfileID == profileID {
+			settings = s
+		}
+	}
+	if settings == nil {
+		if settings, err = h.slicerRepo.GetDefaultSettings(profileID); err != nil {
+			// Return empty default settings
+			settings = slicer.DefaultPrintSettings(profileID)
 		}
 	}
 
-	profile, _ := h.slicerRepo.GetProfileByID(profileID)
+	h.renderSettingsForm(w, r, settings, "", false)
+}
 
-	templates.PrintSettingsForm(settings, profile).Render(r.Context(), w)
+// renderSettingsForm renders the settings form with the preset s selected
+// among the presets of its profile, and a status line if msg is set.
+func (h *SlicerHandler) renderSettingsForm(w http.ResponseWriter, r *http.Request, s *models.PrintSettings, msg string, isErr bool) {
+	presets, _ := h.slicerRepo.GetSettingsByProfile(s.ProfileID)
+	profile, _ := h.slicerRepo.GetProfileByID(s.ProfileID)
+	templates.PrintSettingsForm(s, presets, profile, msg, isErr).Render(r.Context(), w)
 }
 
-func (h *SlicerHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
-	idStr := chi.URLParam(r, "id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+// settingsFromURL loads the resin preset named by the {id} URL parameter.
+func (h *SlicerHandler) settingsFromURL(w http.ResponseWriter, r *http.Request) (*models.PrintSettings, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
 		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+	s, err := h.slicerRepo.GetSettingsByID(id)
+	if err != nil {
+		http.Error(w, "Settings not found", http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+// presetNameTaken reports whether another preset of the profile has name.
+func (h *SlicerHandler) presetNameTaken(profileID, exceptID int64, name string) bool {
+	presets, _ := h.slicerRepo.GetSettingsByProfile(profileID)
+	for _, p := range presets {
+		if p.ID != exceptID && strings.EqualFold(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateSettings saves the form into a resin preset, renaming it if the
+// form has a new name.
+func (h *SlicerHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.settingsFromURL(w, r)
+	if !ok {
 		return
 	}
 
 	r.ParseForm()
-	s := &models.PrintSettings{
-		ID:               id,
-		LayerHeightMM:    parseFloat(r.FormValue("layer_height_mm")),
-		ExposureTimeS:    parseFloat(r.FormValue("exposure_time_s")),
-		BottomExposureS:  parseFloat(r.FormValue("bottom_exposure_s")),
-		BottomLayers:     parseInt(r.FormValue("bottom_layers")),
-		LiftHeightMM:     parseFloat(r.FormValue("lift_height_mm")),
-		LiftSpeedMMPS:    parseFloat(r.FormValue("lift_speed_mmps")),
-		RetractSpeedMMPS: parseFloat(r.FormValue("retract_speed_mmps")),
-		AntiAliasing:     parseInt(r.FormValue("anti_aliasing")),
+	if name := strings.TrimSpace(r.FormValue("name")); name != "" && name != s.Name {
+		if h.presetNameTaken(s.ProfileID, s.ID, name) {
+			h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_name_taken", name), true)
+			return
+		}
+		s.Name = name
 	}
+	applySettingsForm(s, r)
 
 	if err := h.slicerRepo.UpdateSettings(s); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`<div class="text-green-400 text-sm mt-2">Saved</div>`))
+	h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_saved"), false)
+}
+
+// CreateSettings adds a resin preset to the profile from the form, on top
+// of the default settings. The name comes from an htmx prompt or the form.
+// The first preset of a profile becomes its default.
+func (h *SlicerHandler) CreateSettings(w http.ResponseWriter, r *http.Request) {
+	profileID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.slicerRepo.GetProfileByID(profileID); err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	r.ParseForm()
+	s := slicer.DefaultPrintSettings(profileID)
+	applySettingsForm(s, r)
+	s.Name = strings.TrimSpace(r.Header.Get("HX-Prompt"))
+	if s.Name == "" {
+		s.Name = strings.TrimSpace(r.FormValue("name"))
+	}
+	if s.Name == "" {
+		h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_name_required"), true)
+		return
+	}
+	if h.presetNameTaken(profileID, 0, s.Name) {
+		h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_name_taken", s.Name), true)
+		return
+	}
+	if _, err := h.slicerRepo.GetDefaultSettings(profileID); err != nil {
+		s.IsDefault = true
+	}
+
+	if err := h.slicerRepo.CreateSettings(s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_created"), false)
+}
+
+// CloneSettings copies a resin preset, as stored, under a free name.
+func (h *SlicerHandler) CloneSettings(w http.ResponseWriter, r *http.Request) {
+	src, ok := h.settingsFromURL(w, r)
+	if !ok {
+		return
+	}
+
+	s := *src
+	s.ID, s.IsDefault = 0, false
+	s.Name = i18n.T(r.Context(), "slicer.preset_copy_name", src.Name)
+	for n := 2; h.presetNameTaken(s.ProfileID, 0, s.Name); n++ {
+		s.Name = fmt.Sprintf("%s %d", i18n.T(r.Context(), "slicer.preset_copy_name", src.Name), n)
+	}
+
+	if err := h.slicerRepo.CreateSettings(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.renderSettingsForm(w, r, &s, i18n.T(r.Context(), "slicer.preset_created"), false)
+}
+
+// SetDefaultSettings makes a resin preset the one selected for its profile
+// when the slicer opens.
+func (h *SlicerHandler) SetDefaultSettings(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.settingsFromURL(w, r)
+	if !ok {
+		return
+	}
+	if err := h.slicerRepo.SetDefaultSettings(s.ProfileID, s.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.IsDefault = true
+	h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_default_set"), false)
+}
+
+// DeleteSettings removes a resin preset. The last preset of a profile
+// cannot be removed; if the default is removed, the next one takes its
+// place.
+func (h *SlicerHandler) DeleteSettings(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.settingsFromURL(w, r)
+	if !ok {
+		return
+	}
+	presets, err := h.slicerRepo.GetSettingsByProfile(s.ProfileID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(presets) <= 1 {
+		h.renderSettingsForm(w, r, s, i18n.T(r.Context(), "slicer.preset_last"), true)
+		return
+	}
+
+	if err := h.slicerRepo.DeleteSettings(s.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var next *models.PrintSettings
+	for i := range presets {
+		if presets[i].ID == s.ID {
+			continue
+		}
+		if next == nil || presets[i].IsDefault {
+			next = &presets[i]
+		}
+	}
+	if s.IsDefault {
+		if err := h.slicerRepo.SetDefaultSettings(next.ProfileID, next.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		next.IsDefault = true
+	}
+	h.renderSettingsForm(w, r, next, i18n.T(r.Context(), "slicer.preset_deleted", s.Name), false)
 }
 
 func (h *SlicerHandler) StartSlice(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 
-	fileIDsStr := r.FormValue("file_ids")
 	profileIDStr := r.FormValue("profile_id")
 	modelName := r.FormValue("model_name")
 	outputFormat := r.FormValue("output_format")
@@ -329,78 +681,105 @@ func (h *SlicerHandler) StartSlice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	settings, err := h.slicerRepo.GetDefaultSettings(profileID)
-	if err != nil {
+	// The resin preset chosen in the form, or the profile's default; the
+	// form's values are applied on top of it.
+	var settings *models.PrintSettings
+	if idStr := r.FormValue("settings_id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err == nil {
+			settings, err = h.slicerRepo.GetSettingsByID(id)
+		}
+		if err != nil || settings.ProfileID != profileID {
+			http.Error(w, "Settings not found", http.StatusNotFound)
+			return
+		}
+	} else if settings, err = h.slicerRepo.GetDefaultSettings(profileID); err != nil {
 		http.Error(w, "Settings not found", http.StatusNotFound)
 		return
 	}
 
-	// Override settings from form if provided
-	if v := r.FormValue("layer_height_mm"); v != "" {
-		settings.LayerHeightMM = parseFloat(v)
-	}
-	if v := r.FormValue("exposure_time_s"); v != "" {
-		settings.ExposureTimeS = parseFloat(v)
-	}
-	if v := r.FormValue("bottom_exposure_s"); v != "" {
-		settings.BottomExposureS = parseFloat(v)
-	}
-	if v := r.FormValue("bottom_layers"); v != "" {
-		settings.BottomLayers = parseInt(v)
-	}
-	if v := r.FormValue("lift_height_mm"); v != "" {
-		settings.LiftHeightMM = parseFloat(v)
-	}
-	if v := r.FormValue("lift_speed_mmps"); v != "" {
-		settings.LiftSpeedMMPS = parseFloat(v)
-	}
-	if v := r.FormValue("retract_speed_mmps"); v != "" {
-		settings.RetractSpeedMMPS = parseFloat(v)
-	}
-	if v := r.FormValue("anti_aliasing"); v != "" {
-		settings.AntiAliasing = parseInt(v)
-	}
-
-	// Resolve file paths
-	modelIDStr := r.FormValue("model_id")
-	modelID, _ := strconv.ParseInt(modelIDStr, 10, 64)
+	applySettingsForm(settings, r)
 
-	var filePaths []string
-	if fileIDsStr != "" && modelID > 0 {
-		modelFiles, err := h.modelRepo.GetFilesByModel(modelID)
+	var drainHoles []slicer.DrainHole
+	if settings.HollowEnabled {
+		drainHoles, err = parseDrainHoles(r.FormValue("drain_holes"))
 		if err != nil {
-			http.Error(w, "Failed to get model files", http.StatusInternalServerError)
+			http.Error(w, html.EscapeString(err.Error()), http.StatusBadRequest)
 			return
 		}
+	}
 
-		fileIDs := make(map[int64]bool)
-		for _, idStr := range strings.Split(fileIDsStr, ",") {
-			id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
-			if err == nil {
-				fileIDs[id] = true
-			}
-		}
-
-		for _, f := range modelFiles {
-			if fileIDs[f.ID] {
-				absPath := filepath.Join(h.scanPath, f.FilePath)
-				filePaths = append(filePaths, absPath)
-			}
-		}
+	files, err := h.resolveSliceFiles(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	if len(filePaths) == 0 {
+	if len(files) == 0 {
 		http.Error(w, "No valid files to slice", http.StatusBadRequest)
 		return
 	}
 
+	opts := sliceOptions{
+		Arrange:    r.FormValue("arrange") != "",
+		DrainHoles: drainHoles,
+	}
+	switch v := slicer.FillRule(r.FormValue("fill_rule")); v {
+	case slicer.FillEvenOdd, slicer.FillNonZero:
+		opts.FillRule = v
+	}
+	if goal, ok := slicer.ParseOrientGoal(r.FormValue("auto_orient")); ok {
+		opts.Orient = goal
+	}
+
+	modelID, _ := strconv.ParseInt(r.FormValue("model_id"), 10, 64)
+	h.startSlice(w, r, modelID, modelName, profile, settings, outputFormat, files, opts)
+}
+
+// sliceOptions are the slice request options kept in the job history, so a
+// job can be sliced again as it was.
+type sliceOptions struct {
+	FillRule   slicer.FillRule                  `json:"fill_rule,omitempty"`
+	Arrange    bool                             `json:"arrange,omitempty"`
+	DrainHoles []slicer.DrainHole               `json:"drain_holes,omitempty"`
+	Orient     slicer.OrientGoal                `json:"orient,omitempty"`
+	Transforms map[int64]slicer.ObjectTransform `json:"transforms,omitempty"` // by file ID
+}
+
+// startSlice queues a slice job, records it in the user's history and
+// returns its progress fragment.
+func (h *SlicerHandler) startSlice(w http.ResponseWriter, r *http.Request, modelID int64, modelName string,
+	profile *models.PrinterProfile, settings *models.PrintSettings, outputFormat string,
+	files []sliceFile, opts sliceOptions) {
+	rec := &models.SliceJobRecord{
+		UserID:       middleware.GetUserID(r.Context()),
+		ModelID:      modelID,
+		ModelName:    modelName,
+		ProfileID:    profile.ID,
+		ProfileName:  profile.Name,
+		OutputFormat: outputFormat,
+		Settings:     *settings,
+	}
+	opts.Transforms = make(map[int64]slicer.ObjectTransform, len(files))
 	req := slicer.SliceRequest{
-		FilePaths:  filePaths,
+		UserID:     rec.UserID,
 		Profile:    profile,
 		Settings:   settings,
 		ModelName:  modelName,
 		FileFormat: outputFormat,
+		FillRule:   opts.FillRule,
+		Arrange:    opts.Arrange,
+		DrainHoles: opts.DrainHoles,
+		Orient:     opts.Orient,
+		Record:     rec,
+	}
+	for _, f := range files {
+		rec.FileIDs = append(rec.FileIDs, f.ID)
+		opts.Transforms[f.ID] = f.Transform
+		req.FilePaths = append(req.FilePaths, f.Path)
+		req.Transforms = append(req.Transforms, f.Transform)
 	}
+	rec.Options, _ = json.Marshal(opts)
 
 	jobID, err := h.engine.StartSlice(req)
 	if err != nil {
@@ -412,10 +791,143 @@ func (h *SlicerHandler) StartSlice(w http.ResponseWriter, r *http.Request) {
 	templates.SliceProgress(job).Render(r.Context(), w)
 }
 
-func (h *SlicerHandler) SliceStatus(w http.ResponseWriter, r *http.Request) {
-	jobID := chi.URLParam(r, "jobId")
-	job, err := h.engine.GetJobStatus(jobID)
+// sliceFile is a model file selected for slicing.
+type sliceFile struct {
+	ID        int64
+	Path      string
+	Transform slicer.ObjectTransform
+}
+
+// resolveSliceFiles maps the submitted file_ids of model_id to absolute paths
+// and reads the per-file transform fields (suffixed with the file ID).
+func (h *SlicerHandler) resolveSliceFiles(r *http.Request) ([]sliceFile, error) {
+	fileIDsStr := r.FormValue("file_ids")
+	modelID, _ := strconv.ParseInt(r.FormValue("model_id"), 10, 64)
+	if fileIDsStr == "" || modelID <= 0 {
+		return nil, nil
+	}
+
+	var fileIDs []int64
+	for _, idStr := range strings.Split(fileIDsStr, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(idStr), 10, 64)
+		if err == nil {
+			fileIDs = append(fileIDs, id)
+		}
+	}
+
+	return h.modelSliceFiles(modelID, fileIDs, func(fileID int64) slicer.ObjectTransform {
+		field := func(name string) string {
+			return r.FormValue(fmt.Sprintf("%s_%d", name, fileID))
+		}
+		t := slicer.ObjectTransform{
+			RotateXDeg: parseFloat(field("rotate_x")),
+			RotateYDeg: parseFloat(field("rotate_y")),
+			RotateZDeg: parseFloat(field("rotate_z")),
+			OffsetXMM:  parseFloat(field("offset_x")),
+			OffsetYMM:  parseFloat(field("offset_y")),
+			Copies:     min(parseInt(field("copies")), slicer.MaxCopies),
+		}
+		if v := field("scale_pct"); v != "" {
+			t.Scale = parseFloat(v) / 100
+		}
+		return t
+	})
+}
+
+// modelSliceFiles returns the sliceable files of a model among fileIDs, in
+// the model's file order, with the transform given for each.
+func (h *SlicerHandler) modelSliceFiles(modelID int64, fileIDs []int64, transform func(fileID int64) slicer.ObjectTransform) ([]sliceFile, error) {
+	modelFiles, err := h.modelRepo.GetFilesByModel(modelID)
 	if err != nil {
+		return nil, fmt.Errorf("get model files: %w", err)
+	}
+
+	selected := make(map[int64]bool, len(fileIDs))
+	for _, id := range fileIDs {
+		selected[id] = true
+	}
+
+	var files []sliceFile
+	for _, f := range modelFiles {
+		if !selected[f.ID] || !slicer.IsSliceableExt(f.FileExt) {
+			continue
+		}
+		files = append(files, sliceFile{
+			ID:        f.ID,
+			Path:      filepath.Join(h.scanPath, f.FilePath),
+			Transform: transform(f.ID),
+		})
+	}
+	return files, nil
+}
+
+// PlateLayout arranges the selected files with their transforms and returns
+// a top-down preview of the plate, so the layout can be checked before slicing.
+func (h *SlicerHandler) PlateLayout(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	profileID, err := strconv.ParseInt(r.FormValue("profile_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid profile ID", http.StatusBadRequest)
+		return
+	}
+	profile, err := h.slicerRepo.GetProfileByID(profileID)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
+
+	files, err := h.resolveSliceFiles(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var meshes []*slicer.Mesh
+	var names []string
+	var meshTransforms []slicer.ObjectTransform
+	for _, f := range files {
+		mesh, err := slicer.ParseMesh(f.Path)
+		if err != nil {
+			log.Printf("Plate layout: skipping %s: %v", filepath.Base(f.Path), err)
+			continue
+		}
+		meshes = append(meshes, mesh)
+		names = append(names, filepath.Base(f.Path))
+		meshTransforms = append(meshTransforms, f.Transform)
+	}
+	if len(meshes) == 0 {
+		http.Error(w, "No valid files to slice", http.StatusBadRequest)
+		return
+	}
+
+	_, layout, err := slicer.BuildPlate(meshes, names, meshTransforms, profile, r.FormValue("arrange") != "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	templates.PlateLayoutPreview(layout).Render(r.Context(), w)
+}
+
+// ownedJob returns the status of a job if the user of the request owns it
+// or is an admin. Jobs of other users are reported as not found.
+func (h *SlicerHandler) ownedJob(r *http.Request, jobID string) (*models.SliceJob, bool) {
+	job, err := h.engine.GetJobStatus(jobID)
+	if err != nil || !canAccessJob(r, job.UserID) {
+		return nil, false
+	}
+	return job, true
+}
+
+// canAccessJob reports whether the user of the request owns a job or is an admin.
+func canAccessJob(r *http.Request, ownerID int64) bool {
+	return ownerID == middleware.GetUserID(r.Context()) || middleware.HasRole(r.Context(), "ROLE_ADMIN")
+}
+
+func (h *SlicerHandler) SliceStatus(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownedJob(r, chi.URLParam(r, "jobId"))
+	if !ok {
 		http.Error(w, "Job not found", http.StatusNotFound)
 		return
 	}
@@ -429,27 +941,322 @@ func (h *SlicerHandler) SliceStatus(w http.ResponseWriter, r *http.Request) {
 	templates.SliceProgress(job).Render(r.Context(), w)
 }
 
+// Download serves the file of a finished job: from the engine while the job
+// is in memory, then from the job history until retention removes it.
 func (h *SlicerHandler) Download(w http.ResponseWriter, r *http.Request) {
 	jobID := chi.URLParam(r, "jobId")
-	job, err := h.engine.GetJobStatus(jobID)
+
+	var outputPath, ext string
+	if job, ok := h.ownedJob(r, jobID); ok {
+		var err error
+		outputPath, err = h.engine.GetOutputFile(jobID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		ext = job.Extension
+	} else {
+		rec, err := h.slicerRepo.GetSliceJob(jobID)
+		if err != nil || !canAccessJob(r, rec.UserID) {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		if rec.Status != "complete" || rec.OutputPath == "" {
+			http.Error(w, "job not complete", http.StatusNotFound)
+			return
+		}
+		outputPath, ext = rec.OutputPath, rec.Extension
+	}
+
+	fileName := fmt.Sprintf("model.%s", ext)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+	http.ServeFile(w, r, outputPath)
+}
+
+// CancelJob stops a queued or running job of the user and returns its
+// progress fragment.
+func (h *SlicerHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobId")
+	if _, ok := h.ownedJob(r, jobID); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+	if err := h.engine.CancelJob(jobID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	job, _ := h.engine.GetJobStatus(jobID)
+	templates.SliceProgress(job).Render(r.Context(), w)
+}
+
+// sliceHistoryLimit caps the jobs listed on the history page.
+const sliceHistoryLimit = 100
+
+// History renders the "My slices" page with the user's past jobs.
+func (h *SlicerHandler) History(w http.ResponseWriter, r *http.Request) {
+	username := middleware.GetUsername(r.Context())
+	isAdmin := middleware.HasRole(r.Context(), "ROLE_ADMIN")
+
+	jobs, err := h.slicerRepo.GetSliceJobsByUser(middleware.GetUserID(r.Context()), sliceHistoryLimit)
 	if err != nil {
+		log.Printf("Slice history: %v", err)
+	}
+
+	templates.SliceHistoryPage(jobs, username, isAdmin).Render(r.Context(), w)
+}
+
+// Reslice queues a job again with the files, profile, settings snapshot and
+// options recorded in its history entry.
+func (h *SlicerHandler) Reslice(w http.ResponseWriter, r *http.Request) {
+	rec, err := h.slicerRepo.GetSliceJob(chi.URLParam(r, "jobId"))
+	if err != nil || !canAccessJob(r, rec.UserID) {
 		http.Error(w, "Job not found", http.StatusNotFound)
 		return
 	}
+	errorFragment := func(msg string) {
+		w.Write([]byte(fmt.Sprintf(`<div class="text-red-400 text-xs mt-1">%s</div>`, html.EscapeString(msg))))
+	}
+	if rec.ModelID == 0 || rec.ProfileID == 0 {
+		errorFragment("The model or printer profile of this job no longer exists")
+		return
+	}
+
+	profile, err := h.slicerRepo.GetProfileByID(rec.ProfileID)
+	if err != nil {
+		http.Error(w, "Profile not found", http.StatusNotFound)
+		return
+	}
 
-	outputPath, err := h.engine.GetOutputFile(jobID)
+	var opts sliceOptions
+	if err := json.Unmarshal(rec.Options, &opts); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	files, err := h.modelSliceFiles(rec.ModelID, rec.FileIDs, func(fileID int64) slicer.ObjectTransform {
+		return opts.Transforms[fileID]
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(files) == 0 {
+		errorFragment("No valid files to slice")
+		return
+	}
+
+	settings := rec.Settings
+	h.startSlice(w, r, rec.ModelID, rec.ModelName, profile, &settings, rec.OutputFormat, files, opts)
+}
+
+// JobLayers returns the per-layer summary of a job as JSON: area, islands
+// and bounding box of every layer sliced so far.
+func (h *SlicerHandler) JobLayers(w http.ResponseWriter, r *http.Request) {
+	job, ok := h.ownedJob(r, chi.URLParam(r, "jobId"))
+	if !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	layers := job.Layers
+	if layers == nil {
+		layers = []models.LayerSummary{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(layers); err != nil {
+		log.Printf("Job layers %s: %v", job.ID, err)
+	}
+}
+
+// JobLayerImage serves layer n (1-based) of a finished job as a grayscale
+// PNG, read back from the output file. The optional width query scales it
+// down for the layer scrubber.
+func (h *SlicerHandler) JobLayerImage(w http.ResponseWriter, r *http.Request) {
+	jobID := chi.URLParam(r, "jobId")
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil || n < 1 {
+		http.Error(w, "Invalid layer number", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.ownedJob(r, jobID); !ok {
+		http.Error(w, "Job not found", http.StatusNotFound)
+		return
+	}
+
+	img, err := h.engine.LayerImage(jobID, n)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	if width := parseInt(r.URL.Query().Get("width")); width > 0 {
+		img = slicer.ShrinkLayer(img, width)
+	}
 
-	fileName := fmt.Sprintf("model.%s", job.Extension)
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
-	http.ServeFile(w, r, outputPath)
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if err := png.Encode(w, img); err != nil {
+		log.Printf("Job layer %s/%d: %v", jobID, n, err)
+	}
+}
+
+// MeshPreview serves a sliceable model file as binary STL so the slicer's
+// 3D view can show OBJ and 3MF files as well.
+func (h *SlicerHandler) MeshPreview(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.modelRepo.GetFileByID(fileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if !slicer.IsSliceableExt(f.FileExt) {
+		http.Error(w, "Unsupported mesh format", http.StatusBadRequest)
+		return
+	}
+
+	mesh, err := slicer.ParseMesh(filepath.Join(h.scanPath, f.FilePath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "model/stl")
+	if err := slicer.WriteSTLBinary(w, mesh); err != nil {
+		log.Printf("Mesh preview %d: %v", fileID, err)
+	}
+}
+
+// CheckMesh parses a model file and runs the repair analysis on it without
+// slicing, returning the report fragment.
+func (h *SlicerHandler) CheckMesh(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.modelRepo.GetFileByID(fileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	mesh, err := slicer.ParseMesh(filepath.Join(h.scanPath, f.FilePath))
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf(`<div class="text-red-400 text-xs mt-1">%s</div>`, html.EscapeString(err.Error()))))
+		return
+	}
+
+	report := slicer.RepairMesh(mesh)
+	templates.MeshRepairSummary(report).Render(r.Context(), w)
+}
+
+// OrientMesh suggests the rotation of a mesh file for the goal in the query,
+// so it can be previewed and copied into the file's transform.
+func (h *SlicerHandler) OrientMesh(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+	goal, ok := slicer.ParseOrientGoal(r.URL.Query().Get("goal"))
+	if !ok {
+		goal = slicer.OrientSupports
+	}
+
+	f, err := h.modelRepo.GetFileByID(fileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+
+	mesh, err := slicer.ParseMesh(filepath.Join(h.scanPath, f.FilePath))
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf(`<div class="text-red-400 text-xs mt-1">%s</div>`, html.EscapeString(err.Error()))))
+		return
+	}
+	slicer.RepairMesh(mesh)
+
+	angle := 0.0
+	if v := r.URL.Query().Get("support_angle_deg"); v != "" {
+		angle = parseFloat(v)
+	}
+	o := slicer.OptimizeOrientation(mesh, goal, angle)
+	templates.OrientationSuggestion(fileID, goal, o).Render(r.Context(), w)
+}
+
+// PrintFileInfo decodes a sliced print file from the library and returns the
+// fragment with its print parameters and preview.
+func (h *SlicerHandler) PrintFileInfo(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.modelRepo.GetFileByID(fileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if !slicer.IsPrintFileExt(f.FileExt) {
+		http.Error(w, "Unsupported print file format", http.StatusBadRequest)
+		return
+	}
 
-	// Cleanup after download
-	go h.engine.CleanupJob(jobID)
+	pf, err := slicer.OpenPrintFile(filepath.Join(h.scanPath, f.FilePath))
+	if err != nil {
+		w.Write([]byte(fmt.Sprintf(`<div class="text-red-400 text-xs mt-1">%s</div>`, html.EscapeString(err.Error()))))
+		return
+	}
+	defer pf.Close()
+	templates.PrintFileDetails(fileID, pf).Render(r.Context(), w)
+}
+
+// PrintFilePreview serves preview n of a sliced print file as a PNG.
+func (h *SlicerHandler) PrintFilePreview(w http.ResponseWriter, r *http.Request) {
+	fileID, err := strconv.ParseInt(chi.URLParam(r, "fileId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+	n, err := strconv.Atoi(chi.URLParam(r, "n"))
+	if err != nil {
+		http.Error(w, "Invalid preview index", http.StatusBadRequest)
+		return
+	}
+
+	f, err := h.modelRepo.GetFileByID(fileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	}
+	if !slicer.IsPrintFileExt(f.FileExt) {
+		http.Error(w, "Unsupported print file format", http.StatusBadRequest)
+		return
+	}
+
+	pf, err := slicer.OpenPrintFile(filepath.Join(h.scanPath, f.FilePath))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	defer pf.Close()
+	if n < 0 || n >= len(pf.Previews) {
+		http.Error(w, "Preview not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if err := png.Encode(w, pf.Previews[n]); err != nil {
+		log.Printf("Print file preview %d: %v", fileID, err)
+	}
 }
 
 func parseFloat(s string) float64 {
@@ -461,3 +1268,97 @@ func parseInt(s string) int {
 	v, _ := strconv.Atoi(s)
 	return v
 }
+
+// applySettingsForm overrides settings with the values submitted by the
+// slicer settings form. Missing fields keep their stored value.
+func applySettingsForm(s *models.PrintSettings, r *http.Request) {
+	if v := r.FormValue("layer_height_mm"); v != "" {
+		s.LayerHeightMM = parseFloat(v)
+	}
+	if v := r.FormValue("exposure_time_s"); v != "" {
+		s.ExposureTimeS = parseFloat(v)
+	}
+	if v := r.FormValue("bottom_exposure_s"); v != "" {
+		s.BottomExposureS = parseFloat(v)
+	}
+	if v := r.FormValue("bottom_layers"); v != "" {
+		s.BottomLayers = parseInt(v)
+	}
+	if v := r.FormValue("lift_height_mm"); v != "" {
+		s.LiftHeightMM = parseFloat(v)
+	}
+	if v := r.FormValue("lift_speed_mmps"); v != "" {
+		s.LiftSpeedMMPS = parseFloat(v)
+	}
+	if v := r.FormValue("retract_speed_mmps"); v != "" {
+		s.RetractSpeedMMPS = parseFloat(v)
+	}
+	if v := r.FormValue("anti_aliasing"); v != "" {
+		s.AntiAliasing = parseInt(v)
+	}
+	if v := r.FormValue("resin_price_per_l"); v != "" {
+		s.ResinPricePerL = parseFloat(v)
+	}
+	if _, ok := r.Form["resin_brand"]; ok {
+		s.ResinBrand = strings.TrimSpace(r.FormValue("resin_brand"))
+		s.ResinColor = slicer.NormalizeResinColor(r.FormValue("resin_color"))
+	}
+
+	// The hollowing, support and advanced sections are always submitted as a whole;
+	// an unchecked checkbox is simply absent.
+	if _, ok := r.Form["hollow_wall_mm"]; ok {
+		s.HollowEnabled = r.FormValue("hollow_enabled") != ""
+		s.HollowWallMM = parseFloat(r.FormValue("hollow_wall_mm"))
+		s.InfillSpacingMM = parseFloat(r.FormValue("infill_spacing_mm"))
+		s.InfillThicknessMM = parseFloat(r.FormValue("infill_thickness_mm"))
+		s.DrainHoleDiameterMM = parseFloat(r.FormValue("drain_hole_diameter_mm"))
+	}
+	if _, ok := r.Form["support_type"]; ok {
+		s.SupportsEnabled = r.FormValue("supports_enabled") != ""
+		s.SupportType = slicer.SupportPillar
+		if r.FormValue("support_type") == slicer.SupportTree {
+			s.SupportType = slicer.SupportTree
+		}
+		s.SupportTipDiameterMM = parseFloat(r.FormValue("support_tip_diameter_mm"))
+		s.SupportDensityPct = parseFloat(r.FormValue("support_density_pct"))
+		s.SupportAngleDeg = parseFloat(r.FormValue("support_angle_deg"))
+	}
+	if _, ok := r.Form["xy_compensation_um"]; ok {
+		s.XYCompensationUM = parseFloat(r.FormValue("xy_compensation_um"))
+		s.ElephantFootUM = parseFloat(r.FormValue("elephant_foot_um"))
+	}
+	if _, ok := r.Form["transition_layers"]; ok {
+		s.TransitionLayers = parseInt(r.FormValue("transition_layers"))
+		s.LightOffDelayS = parseFloat(r.FormValue("light_off_delay_s"))
+		s.BottomLightOffDelayS = parseFloat(r.FormValue("bottom_light_off_delay_s"))
+		s.WaitBeforeCureS = parseFloat(r.FormValue("wait_before_cure_s"))
+		s.WaitAfterCureS = parseFloat(r.FormValue("wait_after_cure_s"))
+		s.WaitAfterLiftS = parseFloat(r.FormValue("wait_after_lift_s"))
+		s.LiftHeight2MM = parseFloat(r.FormValue("lift_height2_mm"))
+		s.LiftSpeed2MMPS = parseFloat(r.FormValue("lift_speed2_mmps"))
+		s.RetractHeight2MM = parseFloat(r.FormValue("retract_height2_mm"))
+		s.RetractSpeed2MMPS = parseFloat(r.FormValue("retract_speed2_mmps"))
+		s.LightPWM = parseInt(r.FormValue("light_pwm"))
+		s.BottomLightPWM = parseInt(r.FormValue("bottom_light_pwm"))
+	}
+}
+
+// parseDrainHoles reads drain hole positions written as "x,y" pairs in plate
+// millimeters, separated by semicolons or new lines.
+func parseDrainHoles(v string) ([]slicer.DrainHole, error) {
+	var holes []slicer.DrainHole
+	for _, pair := range strings.FieldsFunc(v, func(r rune) bool { return r == ';' || r == '\n' }) {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		xs, ys, ok := strings.Cut(pair, ",")
+		x, errX := strconv.ParseFloat(strings.TrimSpace(xs), 64)
+		y, errY := strconv.ParseFloat(strings.TrimSpace(ys), 64)
+		if !ok || errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid drain hole position %q, expected x,y in mm", pair)
+		}
+		holes = append(holes, slicer.DrainHole{XMM: x, YMM: y})
+	}
+	return holes, nil
+}
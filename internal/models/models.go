@@ -14,7 +14,7 @@ type PrinterProfile struct {
 	ResolutionX   int       `json:"resolution_x"`
 	ResolutionY   int       `json:"resolution_y"`
 	PixelSizeUM   float64   `json:"pixel_size_um"`
-	FileFormat    string    `json:"file_format"` // "photon" or "dlp"
+	FileFormat    string    `json:"file_format"` // a slicer.OutputFormat ID
 	IsBuiltIn     bool      `json:"is_built_in"`
 	CreatedAt     time.Time `json:"created_at"`
 }
@@ -33,17 +33,167 @@ type PrintSettings struct {
 	AntiAliasing     int       `json:"anti_aliasing"`
 	IsDefault        bool      `json:"is_default"`
 	CreatedAt        time.Time `json:"created_at"`
+
+	// Advanced exposure and motion. The lift is LiftHeightMM at LiftSpeedMMPS
+	// and then LiftHeight2MM at LiftSpeed2MMPS; the retract covers the same
+	// distance at RetractSpeedMMPS, its last RetractHeight2MM at
+	// RetractSpeed2MMPS (TSMC). Zero heights make a single-stage move.
+	TransitionLayers     int     `json:"transition_layers"` // exposure steps from bottom to normal
+	LightOffDelayS       float64 `json:"light_off_delay_s"`
+	BottomLightOffDelayS float64 `json:"bottom_light_off_delay_s"`
+	WaitBeforeCureS      float64 `json:"wait_before_cure_s"`
+	WaitAfterCureS       float64 `json:"wait_after_cure_s"`
+	WaitAfterLiftS       float64 `json:"wait_after_lift_s"`
+	LiftHeight2MM        float64 `json:"lift_height2_mm"`
+	LiftSpeed2MMPS       float64 `json:"lift_speed2_mmps"`
+	RetractHeight2MM     float64 `json:"retract_height2_mm"`
+	RetractSpeed2MMPS    float64 `json:"retract_speed2_mmps"`
+	LightPWM             int     `json:"light_pwm"` // 1-255
+	BottomLightPWM       int     `json:"bottom_light_pwm"`
+
+	// Dimensional compensation
+	XYCompensationUM float64 `json:"xy_compensation_um"` // contour offset, > 0 grows the part
+	ElephantFootUM   float64 `json:"elephant_foot_um"`   // extra shrink of the bottom layers
+
+	// Hollowing
+	HollowEnabled       bool    `json:"hollow_enabled"`
+	HollowWallMM        float64 `json:"hollow_wall_mm"`
+	InfillSpacingMM     float64 `json:"infill_spacing_mm"`      // 0 = no lattice
+	InfillThicknessMM   float64 `json:"infill_thickness_mm"`    // lattice bar width
+	DrainHoleDiameterMM float64 `json:"drain_hole_diameter_mm"` // 0 = no drain holes
+
+	// Supports
+	SupportsEnabled      bool    `json:"supports_enabled"`
+	SupportType          string  `json:"support_type"` // "pillar" or "tree"
+	SupportTipDiameterMM float64 `json:"support_tip_diameter_mm"`
+	SupportDensityPct    float64 `json:"support_density_pct"` // 1-100
+	SupportAngleDeg      float64 `json:"support_angle_deg"`   // faces flatter than this get supports
+
+	// Resin
+	ResinPricePerL float64 `json:"resin_price_per_l"` // 0 = no cost estimate
+	ResinBrand     string  `json:"resin_brand"`
+	ResinColor     string  `json:"resin_color"` // #rrggbb, empty if not set
 }
 
 type SliceJob struct {
-	ID           string `json:"id"`
-	Status       string `json:"status"` // pending, slicing, encoding, complete, error
-	Progress     int    `json:"progress"`
-	TotalLayers  int    `json:"total_layers"`
-	CurrentLayer int    `json:"current_layer"`
-	Message      string `json:"message"`
-	Extension    string `json:"extension"`
-	OutputPath   string `json:"-"`
+	ID            string `json:"id"`
+	UserID        int64  `json:"user_id"`
+	Status        string `json:"status"`                   // pending, slicing, encoding, complete, error, cancelled
+	QueuePosition int    `json:"queue_position,omitempty"` // 1-based while pending
+	Progress      int    `json:"progress"`
+	TotalLayers   int    `json:"total_layers"`
+	CurrentLayer  int    `json:"current_layer"`
+	Message       string `json:"message"`
+	Extension     string `json:"extension"`
+	OutputPath    string `json:"-"`
+
+	// Diagnostics
+	OpenContours      int               `json:"open_contours"`
+	OpenContourLayers []int             `json:"open_contour_layers,omitempty"` // 1-based, capped
+	Repair            *MeshRepairReport `json:"repair,omitempty"`
+
+	// Hollowing results
+	Hollowed      bool    `json:"hollowed"`
+	ResinSavedML  float64 `json:"resin_saved_ml"`
+	ResinSavedPct float64 `json:"resin_saved_pct"`
+	DrainHoles    int     `json:"drain_holes"`
+
+	Supports int `json:"supports"` // support tips generated
+
+	// Estimates
+	PrintTimeS float64 `json:"print_time_s"`
+	ResinML    float64 `json:"resin_ml"`
+	ResinCost  float64 `json:"resin_cost"` // 0 when the settings have no resin price
+
+	Layers []LayerSummary `json:"-"` // served separately, one per sliced layer
+}
+
+// SliceJobRecord is the persisted history entry of a slice job.
+type SliceJobRecord struct {
+	ID           string        `json:"id"`
+	UserID       int64         `json:"user_id"`
+	ModelID      int64         `json:"model_id"` // 0 once the model is deleted
+	ModelName    string        `json:"model_name"`
+	FileIDs      []int64       `json:"file_ids"`
+	ProfileID    int64         `json:"profile_id"` // 0 once the profile is deleted
+	ProfileName  string        `json:"profile_name"`
+	OutputFormat string        `json:"output_format"` // an output format ID, empty = profile format
+	Settings     PrintSettings `json:"settings"`      // snapshot taken when the job was queued
+	Options      []byte        `json:"-"`             // JSON of the remaining slice request options
+	Status       string        `json:"status"`
+	Message      string        `json:"message"`
+	TotalLayers  int           `json:"total_layers"`
+	PrintTimeS   float64       `json:"print_time_s"`
+	ResinML      float64       `json:"resin_ml"`
+	ResinCost    float64       `json:"resin_cost"`
+	Extension    string        `json:"extension"`
+	OutputPath   string        `json:"-"` // empty once the file is gone
+	OutputSize   int64         `json:"output_size"`
+	CreatedAt    time.Time     `json:"created_at"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	FinishedAt   *time.Time    `json:"finished_at,omitempty"`
+}
+
+// LayerSummary describes one sliced layer for inspection.
+type LayerSummary struct {
+	Layer   int        `json:"layer"` // 1-based
+	ZMM     float64    `json:"z_mm"`
+	AreaMM2 float64    `json:"area_mm2"`
+	Islands int        `json:"islands"`
+	BBox    *LayerBBox `json:"bbox,omitempty"` // nil for empty layers
+}
+
+// LayerBBox is the bounding box of a layer's lit pixels, in pixels.
+type LayerBBox struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+// MeshRepairReport describes the problems found (and fixed) in a mesh before slicing.
+type MeshRepairReport struct {
+	InputTriangles   int `json:"input_triangles"`
+	OutputTriangles  int `json:"output_triangles"`
+	WeldedVertices   int `json:"welded_vertices"`
+	DegenerateFaces  int `json:"degenerate_faces"`
+	DuplicateFaces   int `json:"duplicate_faces"`
+	FlippedFaces     int `json:"flipped_faces"`
+	InvertedShells   int `json:"inverted_shells"`
+	UnnestedShells   int `json:"unnested_shells"` // oriented without checking for cavities
+	Shells           int `json:"shells"`
+	HolesClosed      int `json:"holes_closed"`
+	OpenHoles        int `json:"open_holes"`     // holes too large or irregular to close
+	BoundaryEdges    int `json:"boundary_edges"` // left after repair
+	NonManifoldEdges int `json:"non_manifold_edges"`
+}
+
+// Add accumulates another report, used when several files are merged.
+func (r *MeshRepairReport) Add(o *MeshRepairReport) {
+	r.InputTriangles += o.InputTriangles
+	r.OutputTriangles += o.OutputTriangles
+	r.WeldedVertices += o.WeldedVertices
+	r.DegenerateFaces += o.DegenerateFaces
+	r.DuplicateFaces += o.DuplicateFaces
+	r.FlippedFaces += o.FlippedFaces
+	r.InvertedShells += o.InvertedShells
+	r.UnnestedShells += o.UnnestedShells
+	r.Shells += o.Shells
+	r.HolesClosed += o.HolesClosed
+	r.OpenHoles += o.OpenHoles
+	r.BoundaryEdges += o.BoundaryEdges
+	r.NonManifoldEdges += o.NonManifoldEdges
+}
+
+// HasIssues reports whether anything was repaired or remains broken.
+func (r *MeshRepairReport) HasIssues() bool {
+	return r.DegenerateFaces > 0 || r.DuplicateFaces > 0 || r.FlippedFaces > 0 ||
+		r.HolesClosed > 0 || r.OpenHoles > 0 || r.BoundaryEdges > 0 || r.NonManifoldEdges > 0
+}
+
+// IsWatertight reports whether the repaired mesh is closed and manifold.
+func (r *MeshRepairReport) IsWatertight() bool {
+	return r.BoundaryEdges == 0 && r.NonManifoldEdges == 0
 }
 
 type Author struct {
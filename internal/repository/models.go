@@ -316,6 +316,19 @@ func (r *ModelRepository) GetFileByPath(path string) (*models.ModelFile, error)
 	return f, nil
 }
 
+func (r *ModelRepository) GetFileByID(id int64) (*models.ModelFile, error) {
+	f := &models.ModelFile{}
+	err := r.db.QueryRow(`
+		SELECT id, model_id, file_path, file_name, file_ext, file_size
+		FROM model_files WHERE id = $1`, id).Scan(
+		&f.ID, &f.ModelID, &f.FilePath, &f.FileName, &f.FileExt, &f.FileSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
 func (r *ModelRepository) AddFile(f *models.ModelFile) error {
 	err := r.db.QueryRow(`
 		INSERT INTO model_files (model_id, file_path, file_name, file_ext, file_size)
@@ -2,7 +2,11 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"3dmodels/internal/models"
 )
@@ -89,11 +93,39 @@ func (r *SlicerRepository) DeleteProfile(id int64) error {
 
 // --- Print Settings ---
 
+const settingsColumns = `id, name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s,
+		       bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps,
+		       anti_aliasing, is_default, created_at,
+		       hollow_enabled, hollow_wall_mm, infill_spacing_mm, infill_thickness_mm,
+		       drain_hole_diameter_mm, supports_enabled, support_type, support_tip_diameter_mm,
+		       support_density_pct, support_angle_deg, resin_price_per_l, resin_brand, resin_color,
+		       transition_layers, light_off_delay_s, bottom_light_off_delay_s, wait_before_cure_s,
+		       wait_after_cure_s, wait_after_lift_s, lift_height2_mm, lift_speed2_mmps,
+		       retract_height2_mm, retract_speed2_mmps, light_pwm, bottom_light_pwm,
+		       xy_compensation_um, elephant_foot_um`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSettings(row rowScanner) (models.PrintSettings, error) {
+	var s models.PrintSettings
+	err := row.Scan(&s.ID, &s.Name, &s.ProfileID, &s.LayerHeightMM, &s.ExposureTimeS,
+		&s.BottomExposureS, &s.BottomLayers, &s.LiftHeightMM, &s.LiftSpeedMMPS,
+		&s.RetractSpeedMMPS, &s.AntiAliasing, &s.IsDefault, &s.CreatedAt,
+		&s.HollowEnabled, &s.HollowWallMM, &s.InfillSpacingMM, &s.InfillThicknessMM,
+		&s.DrainHoleDiameterMM, &s.SupportsEnabled, &s.SupportType, &s.SupportTipDiameterMM,
+		&s.SupportDensityPct, &s.SupportAngleDeg, &s.ResinPricePerL, &s.ResinBrand, &s.ResinColor,
+		&s.TransitionLayers, &s.LightOffDelayS, &s.BottomLightOffDelayS, &s.WaitBeforeCureS,
+		&s.WaitAfterCureS, &s.WaitAfterLiftS, &s.LiftHeight2MM, &s.LiftSpeed2MMPS,
+		&s.RetractHeight2MM, &s.RetractSpeed2MMPS, &s.LightPWM, &s.BottomLightPWM,
+		&s.XYCompensationUM, &s.ElephantFootUM)
+	return s, err
+}
+
 func (r *SlicerRepository) GetSettingsByProfile(profileID int64) ([]models.PrintSettings, error) {
 	rows, err := r.db.Query(`
-		SELECT id, name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s,
-		       bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps,
-		       anti_aliasing, is_default, created_at
+		SELECT `+settingsColumns+`
 		FROM print_settings
 		WHERE profile_id = $1
 		ORDER BY is_default DESC, name`, profileID)
@@ -104,10 +136,8 @@ func (r *SlicerRepository) GetSettingsByProfile(profileID int64) ([]models.Print
 
 	var settings []models.PrintSettings
 	for rows.Next() {
-		var s models.PrintSettings
-		if err := rows.Scan(&s.ID, &s.Name, &s.ProfileID, &s.LayerHeightMM, &s.ExposureTimeS,
-			&s.BottomExposureS, &s.BottomLayers, &s.LiftHeightMM, &s.LiftSpeedMMPS,
-			&s.RetractSpeedMMPS, &s.AntiAliasing, &s.IsDefault, &s.CreatedAt); err != nil {
+		s, err := scanSettings(rows)
+		if err != nil {
 			return nil, fmt.Errorf("scan settings: %w", err)
 		}
 		settings = append(settings, s)
@@ -116,15 +146,9 @@ func (r *SlicerRepository) GetSettingsByProfile(profileID int64) ([]models.Print
 }
 
 func (r *SlicerRepository) GetSettingsByID(id int64) (*models.PrintSettings, error) {
-	var s models.PrintSettings
-	err := r.db.QueryRow(`
-		SELECT id, name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s,
-		       bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps,
-		       anti_aliasing, is_default, created_at
-		FROM print_settings WHERE id = $1`, id).Scan(
-		&s.ID, &s.Name, &s.ProfileID, &s.LayerHeightMM, &s.ExposureTimeS,
-		&s.BottomExposureS, &s.BottomLayers, &s.LiftHeightMM, &s.LiftSpeedMMPS,
-		&s.RetractSpeedMMPS, &s.AntiAliasing, &s.IsDefault, &s.CreatedAt)
+	s, err := scanSettings(r.db.QueryRow(`
+		SELECT `+settingsColumns+`
+		FROM print_settings WHERE id = $1`, id))
 	if err != nil {
 		return nil, fmt.Errorf("get settings %d: %w", id, err)
 	}
@@ -132,16 +156,10 @@ func (r *SlicerRepository) GetSettingsByID(id int64) (*models.PrintSettings, err
 }
 
 func (r *SlicerRepository) GetDefaultSettings(profileID int64) (*models.PrintSettings, error) {
-	var s models.PrintSettings
-	err := r.db.QueryRow(`
-		SELECT id, name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s,
-		       bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps,
-		       anti_aliasing, is_default, created_at
+	s, err := scanSettings(r.db.QueryRow(`
+		SELECT `+settingsColumns+`
 		FROM print_settings WHERE profile_id = $1 AND is_default = TRUE
-		LIMIT 1`, profileID).Scan(
-		&s.ID, &s.Name, &s.ProfileID, &s.LayerHeightMM, &s.ExposureTimeS,
-		&s.BottomExposureS, &s.BottomLayers, &s.LiftHeightMM, &s.LiftSpeedMMPS,
-		&s.RetractSpeedMMPS, &s.AntiAliasing, &s.IsDefault, &s.CreatedAt)
+		LIMIT 1`, profileID))
 	if err != nil {
 		return nil, fmt.Errorf("get default settings for profile %d: %w", profileID, err)
 	}
@@ -152,12 +170,32 @@ func (r *SlicerRepository) CreateSettings(s *models.PrintSettings) error {
 	return r.db.QueryRow(`
 		INSERT INTO print_settings (name, profile_id, layer_height_mm, exposure_time_s, bottom_exposure_s,
 		                            bottom_layers, lift_height_mm, lift_speed_mmps, retract_speed_mmps,
-		                            anti_aliasing, is_default)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		                            anti_aliasing, is_default,
+		                            hollow_enabled, hollow_wall_mm, infill_spacing_mm, infill_thickness_mm,
+		                            drain_hole_diameter_mm, supports_enabled, support_type,
+		                            support_tip_diameter_mm, support_density_pct, support_angle_deg,
+		                            resin_price_per_l, resin_brand, resin_color,
+		                            transition_layers, light_off_delay_s, bottom_light_off_delay_s,
+		                            wait_before_cure_s, wait_after_cure_s, wait_after_lift_s,
+		                            lift_height2_mm, lift_speed2_mmps, retract_height2_mm,
+		                            retract_speed2_mmps, light_pwm, bottom_light_pwm,
+		                            xy_compensation_um, elephant_foot_um)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16,
+		        $17, $18, $19, $20, $21, $22, $23, $24, $25, $26, $27, $28, $29, $30,
+		        $31, $32, $33, $34, $35, $36, $37, $38)
 		RETURNING id`,
 		s.Name, s.ProfileID, s.LayerHeightMM, s.ExposureTimeS, s.BottomExposureS,
 		s.BottomLayers, s.LiftHeightMM, s.LiftSpeedMMPS, s.RetractSpeedMMPS,
 		s.AntiAliasing, s.IsDefault,
+		s.HollowEnabled, s.HollowWallMM, s.InfillSpacingMM, s.InfillThicknessMM,
+		s.DrainHoleDiameterMM, s.SupportsEnabled, s.SupportType,
+		s.SupportTipDiameterMM, s.SupportDensityPct, s.SupportAngleDeg,
+		s.ResinPricePerL, s.ResinBrand, s.ResinColor,
+		s.TransitionLayers, s.LightOffDelayS, s.BottomLightOffDelayS,
+		s.WaitBeforeCureS, s.WaitAfterCureS, s.WaitAfterLiftS,
+		s.LiftHeight2MM, s.LiftSpeed2MMPS, s.RetractHeight2MM,
+		s.RetractSpeed2MMPS, s.LightPWM, s.BottomLightPWM,
+		s.XYCompensationUM, s.ElephantFootUM,
 	).Scan(&s.ID)
 }
 
@@ -166,11 +204,37 @@ func (r *SlicerRepository) UpdateSettings(s *models.PrintSettings) error {
 		UPDATE print_settings
 		SET name = $1, layer_height_mm = $2, exposure_time_s = $3, bottom_exposure_s = $4,
 		    bottom_layers = $5, lift_height_mm = $6, lift_speed_mmps = $7, retract_speed_mmps = $8,
-		    anti_aliasing = $9, is_default = $10
-		WHERE id = $11`,
+		    anti_aliasing = $9, is_default = $10,
+		    hollow_enabled = $11, hollow_wall_mm = $12, infill_spacing_mm = $13,
+		    infill_thickness_mm = $14, drain_hole_diameter_mm = $15,
+		    supports_enabled = $16, support_type = $17, support_tip_diameter_mm = $18,
+		    support_density_pct = $19, support_angle_deg = $20, resin_price_per_l = $21,
+		    resin_brand = $22, resin_color = $23,
+		    transition_layers = $24, light_off_delay_s = $25, bottom_light_off_delay_s = $26,
+		    wait_before_cure_s = $27, wait_after_cure_s = $28, wait_after_lift_s = $29,
+		    lift_height2_mm = $30, lift_speed2_mmps = $31, retract_height2_mm = $32,
+		    retract_speed2_mmps = $33, light_pwm = $34, bottom_light_pwm = $35,
+		    xy_compensation_um = $36, elephant_foot_um = $37
+		WHERE id = $38`,
 		s.Name, s.LayerHeightMM, s.ExposureTimeS, s.BottomExposureS,
 		s.BottomLayers, s.LiftHeightMM, s.LiftSpeedMMPS, s.RetractSpeedMMPS,
-		s.AntiAliasing, s.IsDefault, s.ID)
+		s.AntiAliasing, s.IsDefault,
+		s.HollowEnabled, s.HollowWallMM, s.InfillSpacingMM,
+		s.InfillThicknessMM, s.DrainHoleDiameterMM,
+		s.SupportsEnabled, s.SupportType, s.SupportTipDiameterMM,
+		s.SupportDensityPct, s.SupportAngleDeg, s.ResinPricePerL, s.ResinBrand, s.ResinColor,
+		s.TransitionLayers, s.LightOffDelayS, s.BottomLightOffDelayS,
+		s.WaitBeforeCureS, s.WaitAfterCureS, s.WaitAfterLiftS,
+		s.LiftHeight2MM, s.LiftSpeed2MMPS, s.RetractHeight2MM,
+		s.RetractSpeed2MMPS, s.LightPWM, s.BottomLightPWM,
+		s.XYCompensationUM, s.ElephantFootUM, s.ID)
+	return err
+}
+
+// SetDefaultSettings makes the settings id the only default of their
+// profile.
+func (r *SlicerRepository) SetDefaultSettings(profileID, id int64) error {
+	_, err := r.db.Exec(`UPDATE print_settings SET is_default = (id = $2) WHERE profile_id = $1`, profileID, id)
 	return err
 }
 
@@ -178,3 +242,151 @@ func (r *SlicerRepository) DeleteSettings(id int64) error {
 	_, err := r.db.Exec(`DELETE FROM print_settings WHERE id = $1`, id)
 	return err
 }
+
+// --- Slice Jobs ---
+
+const sliceJobColumns = `id, user_id, model_id, model_name, file_ids, profile_id, profile_name,
+		       output_format, settings, options, status, message, total_layers,
+		       print_time_s, resin_ml, resin_cost, extension, output_path, output_size,
+		       created_at, started_at, finished_at`
+
+func scanSliceJob(row rowScanner) (models.SliceJobRecord, error) {
+	var j models.SliceJobRecord
+	var userID, modelID, profileID sql.NullInt64
+	var fileIDs string
+	var settings []byte
+	var startedAt, finishedAt sql.NullTime
+	err := row.Scan(&j.ID, &userID, &modelID, &j.ModelName, &fileIDs, &profileID, &j.ProfileName,
+		&j.OutputFormat, &settings, &j.Options, &j.Status, &j.Message, &j.TotalLayers,
+		&j.PrintTimeS, &j.ResinML, &j.ResinCost, &j.Extension, &j.OutputPath, &j.OutputSize,
+		&j.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return j, err
+	}
+	j.UserID = userID.Int64
+	j.ModelID = modelID.Int64
+	j.ProfileID = profileID.Int64
+	for _, s := range strings.Split(fileIDs, ",") {
+		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
+			j.FileIDs = append(j.FileIDs, id)
+		}
+	}
+	if err := json.Unmarshal(settings, &j.Settings); err != nil {
+		return j, fmt.Errorf("decode settings snapshot: %w", err)
+	}
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	return j, nil
+}
+
+// nullID maps a zero ID to NULL for the nullable references.
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id > 0}
+}
+
+func (r *SlicerRepository) CreateSliceJob(j *models.SliceJobRecord) error {
+	settings, err := json.Marshal(j.Settings)
+	if err != nil {
+		return fmt.Errorf("encode settings snapshot: %w", err)
+	}
+	options := j.Options
+	if len(options) == 0 {
+		options = []byte("{}")
+	}
+	fileIDs := make([]string, len(j.FileIDs))
+	for i, id := range j.FileIDs {
+		fileIDs[i] = strconv.FormatInt(id, 10)
+	}
+	return r.db.QueryRow(`
+		INSERT INTO slice_jobs (id, user_id, model_id, model_name, file_ids, profile_id, profile_name,
+		                        output_format, settings, options, status, message)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING created_at`,
+		j.ID, nullID(j.UserID), nullID(j.ModelID), j.ModelName, strings.Join(fileIDs, ","),
+		nullID(j.ProfileID), j.ProfileName, j.OutputFormat, settings, options, j.Status, j.Message,
+	).Scan(&j.CreatedAt)
+}
+
+// UpdateSliceJob stores the progress and results of a job.
+func (r *SlicerRepository) UpdateSliceJob(j *models.SliceJobRecord) error {
+	_, err := r.db.Exec(`
+		UPDATE slice_jobs
+		SET status = $1, message = $2, total_layers = $3, print_time_s = $4, resin_ml = $5,
+		    resin_cost = $6, extension = $7, output_path = $8, output_size = $9,
+		    started_at = $10, finished_at = $11
+		WHERE id = $12`,
+		j.Status, j.Message, j.TotalLayers, j.PrintTimeS, j.ResinML,
+		j.ResinCost, j.Extension, j.OutputPath, j.OutputSize,
+		j.StartedAt, j.FinishedAt, j.ID)
+	if err != nil {
+		return fmt.Errorf("update slice job %s: %w", j.ID, err)
+	}
+	return nil
+}
+
+func (r *SlicerRepository) GetSliceJob(id string) (*models.SliceJobRecord, error) {
+	j, err := scanSliceJob(r.db.QueryRow(`
+		SELECT `+sliceJobColumns+`
+		FROM slice_jobs WHERE id = $1`, id))
+	if err != nil {
+		return nil, fmt.Errorf("get slice job %s: %w", id, err)
+	}
+	return &j, nil
+}
+
+// GetSliceJobsByUser returns the most recent jobs of a user, newest first.
+func (r *SlicerRepository) GetSliceJobsByUser(userID int64, limit int) ([]models.SliceJobRecord, error) {
+	return r.querySliceJobs(`
+		SELECT `+sliceJobColumns+`
+		FROM slice_jobs
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2`, userID, limit)
+}
+
+// ExpiredSliceJobs returns the finished jobs created before the given time.
+func (r *SlicerRepository) ExpiredSliceJobs(before time.Time) ([]models.SliceJobRecord, error) {
+	return r.querySliceJobs(`
+		SELECT `+sliceJobColumns+`
+		FROM slice_jobs
+		WHERE created_at < $1 AND status IN ('complete', 'error', 'cancelled')`, before)
+}
+
+func (r *SlicerRepository) querySliceJobs(query string, args ...any) ([]models.SliceJobRecord, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query slice jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []models.SliceJobRecord
+	for rows.Next() {
+		j, err := scanSliceJob(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan slice job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+func (r *SlicerRepository) DeleteSliceJob(id string) error {
+	_, err := r.db.Exec(`DELETE FROM slice_jobs WHERE id = $1`, id)
+	return err
+}
+
+// InterruptSliceJobs marks the jobs left unfinished by a previous run as failed.
+func (r *SlicerRepository) InterruptSliceJobs() (int64, error) {
+	res, err := r.db.Exec(`
+		UPDATE slice_jobs
+		SET status = 'error', message = 'Interrupted by a server restart', finished_at = NOW()
+		WHERE status NOT IN ('complete', 'error', 'cancelled')`)
+	if err != nil {
+		return 0, fmt.Errorf("interrupt slice jobs: %w", err)
+	}
+	return res.RowsAffected()
+}
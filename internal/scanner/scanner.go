@@ -19,6 +19,11 @@ var (
 	model3DExts = map[string]bool{
 		".stl": true, ".obj": true, ".lys": true,
 		".3mf": true, ".3ds": true,
+		// Sliced print files, decoded by the slicer package
+		".photon": true, ".dlp": true, ".ctb": true, ".cbddlp": true, ".goo": true,
+		".pws": true, ".pw0": true, ".pwmo": true, ".pwma": true, ".pwmx": true,
+		".pwmb": true, ".px6s": true, ".pm3": true, ".pm3m": true,
+		".sl1": true, ".sl1s": true,
 	}
 	imageExts = map[string]bool{
 		".png": true, ".jpg": true, ".jpeg": true,
@@ -0,0 +1,275 @@
+package slicer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"3dmodels/internal/models"
+)
+
+// cacheVersion is part of every fingerprint: bump it when the slicer or a
+// writer changes the output produced for the same inputs.
+const cacheVersion = 2
+
+// outputCache keeps finished output files by input fingerprint, and evicts
+// the least recently used ones when their total size exceeds the budget.
+type outputCache struct {
+	mu      sync.Mutex
+	dir     string
+	budget  func() int64 // bytes; zero or less disables the cache
+	entries map[string]*cacheEntry
+	size    int64
+}
+
+type cacheEntry struct {
+	ext      string
+	size     int64 // output file and metadata
+	lastUsed time.Time
+}
+
+// cachedResult is stored next to a cached file: the results of the job
+// that produced it, restored on every hit.
+type cachedResult struct {
+	Job    models.SliceJob       `json:"job"`
+	Layers []models.LayerSummary `json:"layers"`
+}
+
+// newOutputCache opens the cache in dir, indexing the files already there
+// by modification time.
+func newOutputCache(dir string, budget func() int64) (*outputCache, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	c := &outputCache{dir: dir, budget: budget, entries: make(map[string]*cacheEntry)}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read cache directory: %w", err)
+	}
+	for _, f := range files {
+		name := f.Name()
+		ext := filepath.Ext(name)
+		if f.IsDir() || ext == ".json" || ext == ".tmp" || ext == "" {
+			continue
+		}
+		key := strings.TrimSuffix(name, ext)
+		out, err1 := f.Info()
+		meta, err2 := os.Stat(c.metaPath(key))
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		e := &cacheEntry{ext: ext[1:], size: out.Size() + meta.Size(), lastUsed: out.ModTime()}
+		c.entries[key] = e
+		c.size += e.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *outputCache) enabled() bool {
+	return c.budget() > 0
+}
+
+func (c *outputCache) filePath(key, ext string) string {
+	return filepath.Join(c.dir, key+"."+ext)
+}
+
+func (c *outputCache) metaPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// get returns the cached file and results for key, marking them as used.
+func (c *outputCache) get(key string) (string, *cachedResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || !c.enabled() {
+		return "", nil, false
+	}
+	data, err := os.ReadFile(c.metaPath(key))
+	var res cachedResult
+	if err == nil {
+		err = json.Unmarshal(data, &res)
+	}
+	if err != nil {
+		log.Printf("Slice cache: dropping %s: %v", key, err)
+		c.remove(key)
+		return "", nil, false
+	}
+
+	path := c.filePath(key, e.ext)
+	e.lastUsed = time.Now()
+	os.Chtimes(path, e.lastUsed, e.lastUsed)
+	return path, &res, true
+}
+
+// put adds the output file of a completed job under key.
+func (c *outputCache) put(key string, job *models.SliceJob) error {
+	if !c.enabled() {
+		return nil
+	}
+	meta, err := json.Marshal(cachedResult{Job: *job, Layers: job.Layers})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; ok {
+		return nil
+	}
+	path := c.filePath(key, job.Extension)
+	if err := linkOrCopy(job.OutputPath, path+".tmp"); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	if err := os.WriteFile(c.metaPath(key), meta, 0o644); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	e := &cacheEntry{ext: job.Extension, size: fi.Size() + int64(len(meta)), lastUsed: time.Now()}
+	c.entries[key] = e
+	c.size += e.size
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used entries until the cache fits its
+// budget. c.mu must be held.
+func (c *outputCache) evict() {
+	budget := c.budget()
+	if c.size <= budget || len(c.entries) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for k := range c.entries {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].lastUsed.Before(c.entries[keys[j]].lastUsed)
+	})
+	for _, k := range keys {
+		if c.size <= budget {
+			break
+		}
+		c.remove(k)
+	}
+}
+
+// remove deletes an entry and its files. c.mu must be held.
+func (c *outputCache) remove(key string) {
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+	os.Remove(c.filePath(key, e.ext))
+	os.Remove(c.metaPath(key))
+	c.size -= e.size
+	delete(c.entries, key)
+}
+
+// fingerprint identifies the output of a request: the contents of its
+// files and everything in the request that ends up in the output file.
+func fingerprint(req SliceRequest) (string, error) {
+	in := struct {
+		Version    int
+		Files      []string
+		Profile    models.PrinterProfile
+		Settings   models.PrintSettings
+		ModelName  string
+		FileFormat string
+		FillRule   FillRule
+		Transforms []ObjectTransform
+		Arrange    bool
+		DrainHoles []DrainHole
+		Orient     OrientGoal
+	}{
+		Version:    cacheVersion,
+		Profile:    *req.Profile,
+		Settings:   *req.Settings,
+		ModelName:  req.ModelName,
+		FileFormat: req.FileFormat,
+		FillRule:   req.FillRule,
+		Transforms: req.Transforms,
+		Arrange:    req.Arrange,
+		DrainHoles: req.DrainHoles,
+		Orient:     req.Orient,
+	}
+	// Identity fields and the resin price don't change the output.
+	in.Profile.ID, in.Profile.IsBuiltIn, in.Profile.CreatedAt = 0, false, time.Time{}
+	in.Settings.ID, in.Settings.ProfileID, in.Settings.IsDefault, in.Settings.CreatedAt = 0, 0, false, time.Time{}
+	in.Settings.ResinPricePerL = 0
+
+	for _, fp := range req.FilePaths {
+		sum, err := fileSHA256(fp)
+		if err != nil {
+			return "", err
+		}
+		in.Files = append(in.Files, sum)
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// linkOrCopy makes dst a hard link to src, or a copy of it when linking
+// fails (e.g. across file systems).
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
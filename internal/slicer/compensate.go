@@ -0,0 +1,190 @@
+package slicer
+
+import (
+	"math"
+
+	"3dmodels/internal/models"
+)
+
+const (
+	// maxMiterRatio limits how far a vertex moves at a sharp corner, in
+	// multiples of the offset, so acute angles don't grow long spikes.
+	maxMiterRatio = 2.0
+	// minOffsetPointMM drops consecutive points closer than this before
+	// offsetting, as their edge has no usable direction.
+	minOffsetPointMM = 1e-6
+)
+
+// LayerCompensationMM returns the XY offset of layer i (from 0) in mm: the
+// XY compensation, less the elephant-foot compensation on the bottom layers.
+// Positive values grow the part.
+func LayerCompensationMM(settings *models.PrintSettings, i int) float64 {
+	um := settings.XYCompensationUM
+	if i < settings.BottomLayers {
+		um -= settings.ElephantFootUM
+	}
+	return um / 1000
+}
+
+// OffsetContours moves every contour by deltaMM away from the solid, or into
+// it when deltaMM is negative, so the part grows or shrinks in XY and holes
+// do the opposite. Which side is solid follows the fill rule: the winding for
+// nonzero (SliceAtZ runs outer contours counter-clockwise and holes
+// clockwise), how many other contours enclose the contour for even-odd.
+//
+// The result is oriented with the solid on the left and must be rasterized
+// with FillPositive: where a shrink makes a wall collapse, the crossed
+// contours wind negatively and stay empty. Contours that shrink to nothing
+// are dropped.
+func OffsetContours(contours []Contour, deltaMM float64, rule FillRule) []Contour {
+	if deltaMM == 0 || len(contours) == 0 {
+		return contours
+	}
+
+	var bounds []contourBounds
+	if rule != FillNonZero {
+		bounds = make([]contourBounds, len(contours))
+		for i, c := range contours {
+			bounds[i] = boundsOf(c)
+		}
+	}
+
+	out := make([]Contour, 0, len(contours))
+	for i, c := range contours {
+		c = dedupContour(c)
+		area := contourArea(c)
+		if len(c) < 3 || area == 0 {
+			continue
+		}
+		solidInside := area > 0
+		if rule != FillNonZero {
+			solidInside = enclosingCount(contours, bounds, i)%2 == 0
+		}
+		if solidInside != (area > 0) {
+			c = reversedContour(c)
+			area = -area
+		}
+		offset := offsetContour(c, deltaMM)
+		if collapsed(c, offset) {
+			continue
+		}
+		out = append(out, offset)
+	}
+	return out
+}
+
+// offsetContour moves every edge of c by d to its right (to its left when
+// negative), placing each vertex on the miter of its two edges.
+func offsetContour(c Contour, d float64) Contour {
+	n := len(c)
+	normals := make([]Point2D, n)
+	for i := range c {
+		a, b := c[i], c[(i+1)%n]
+		dx, dy := b.X-a.X, b.Y-a.Y
+		l := math.Hypot(dx, dy)
+		normals[i] = Point2D{X: dy / l, Y: -dx / l}
+	}
+
+	out := make(Contour, n)
+	for i := range c {
+		n1, n2 := normals[(i+n-1)%n], normals[i]
+		mx, my := n1.X+n2.X, n1.Y+n2.Y
+		// The miter point is 1 away from both edge lines
+		if k := 1 + n1.X*n2.X + n1.Y*n2.Y; k > 1e-9 {
+			mx, my = mx/k, my/k
+		} else {
+			mx, my = n2.X*maxMiterRatio, n2.Y*maxMiterRatio
+		}
+		if l := math.Hypot(mx, my); l > maxMiterRatio {
+			mx, my = mx/l*maxMiterRatio, my/l*maxMiterRatio
+		}
+		out[i] = Point2D{X: c[i].X + d*mx, Y: c[i].Y + d*my}
+	}
+	return out
+}
+
+// collapsed reports whether an offset contour has shrunk past nothing: its
+// orientation flipped, or every edge points backwards (a convex contour
+// shrunk through its center is turned around, not mirrored).
+func collapsed(c, offset Contour) bool {
+	if a, b := contourArea(c), contourArea(offset); b == 0 || (a > 0) != (b > 0) {
+		return true
+	}
+	n := len(c)
+	for i := range c {
+		j := (i + 1) % n
+		if (c[j].X-c[i].X)*(offset[j].X-offset[i].X)+(c[j].Y-c[i].Y)*(offset[j].Y-offset[i].Y) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// dedupContour drops points that repeat the previous one, and a last point
+// that closes the contour onto the first.
+func dedupContour(c Contour) Contour {
+	out := make(Contour, 0, len(c))
+	for _, p := range c {
+		if len(out) > 0 && math.Hypot(p.X-out[len(out)-1].X, p.Y-out[len(out)-1].Y) < minOffsetPointMM {
+			continue
+		}
+		out = append(out, p)
+	}
+	for len(out) > 1 && math.Hypot(out[0].X-out[len(out)-1].X, out[0].Y-out[len(out)-1].Y) < minOffsetPointMM {
+		out = out[:len(out)-1]
+	}
+	return out
+}
+
+func reversedContour(c Contour) Contour {
+	out := make(Contour, len(c))
+	for i, p := range c {
+		out[len(c)-1-i] = p
+	}
+	return out
+}
+
+type contourBounds struct {
+	minX, minY, maxX, maxY float64
+}
+
+func boundsOf(c Contour) contourBounds {
+	b := contourBounds{math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)}
+	for _, p := range c {
+		b.minX, b.maxX = math.Min(b.minX, p.X), math.Max(b.maxX, p.X)
+		b.minY, b.maxY = math.Min(b.minY, p.Y), math.Max(b.maxY, p.Y)
+	}
+	return b
+}
+
+// enclosingCount returns how many of the other contours enclose the first
+// point of contours[i].
+func enclosingCount(contours []Contour, bounds []contourBounds, i int) int {
+	if len(contours[i]) == 0 {
+		return 0
+	}
+	p := contours[i][0]
+	count := 0
+	for j, c := range contours {
+		b := bounds[j]
+		if j == i || p.X < b.minX || p.X > b.maxX || p.Y < b.minY || p.Y > b.maxY {
+			continue
+		}
+		if pointInContour(p, c) {
+			count++
+		}
+	}
+	return count
+}
+
+// pointInContour tests p against c with the even-odd rule.
+func pointInContour(p Point2D, c Contour) bool {
+	inside := false
+	for i, j := 0, len(c)-1; i < len(c); j, i = i, i+1 {
+		a, b := c[i], c[j]
+		if (a.Y > p.Y) != (b.Y > p.Y) && p.X < (b.X-a.X)*(p.Y-a.Y)/(b.Y-a.Y)+a.X {
+			inside = !inside
+		}
+	}
+	return inside
+}
@@ -0,0 +1,713 @@
+package slicer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"time"
+
+	"3dmodels/internal/models"
+)
+
+// Chitubox .ctb format, versions 3 and 4. The layout follows the header's
+// offsets: header, large and small previews, print parameters, slicer info
+// with the machine name, the v4 parameters and disclaimer, the layer table,
+// and then every layer as its extended definition followed by its data.
+// Layer data is a 7-bit grayscale RLE, XOR-encrypted with a per-file key.
+const (
+	ctbMagic    = 0x12fd0086
+	cbddlpMagic = 0x12fd0019 // .cbddlp and Chitubox .photon: 1-bit layers, not encrypted
+
+	ctbHeaderSize      = 112
+	ctbPreviewHeadSize = 32
+	ctbParamsSize      = 60
+	ctbSlicerInfoSize  = 76
+	ctbParamsV4Size    = 464
+	ctbLayerDefSize    = 36
+	ctbLayerDefExSize  = 84
+
+	ctbAntiAliasFlag    = 0x07 // ctb files; 0x0f when the layers are anti-aliased
+	ctbPerLayerV3       = 0x40 // per-layer parameters are read from LayerDefEx
+	ctbPerLayerV4       = 0x50
+	ctbSoftwareVersion  = 0x01090000
+	ctbPreviewRepeat    = 0x20 // run flag in an RGB15 preview pixel
+	ctbPreviewRunLimit  = 0xfff
+	ctbResinDensityGML  = 1.1
+	ctbLargePreviewSize = 400
+	ctbSmallPreviewSize = 200
+)
+
+const ctbDisclaimer = "Layout and record format for the ctb and cbddlp file types are the copyrighted programs or codes of CBD Technology (China) Inc..The Customer or User shall not in any manner reproduce, distribute, modify, decompile, disassemble, decrypt, extract, reverse engineer, lease, assign, or sublicense the said programs or codes."
+
+// CTBInfo describes the print recorded in a CTB file.
+type CTBInfo struct {
+	Version      int // 3 or 4
+	MachineName  string
+	AntiAliasing int
+	PrintTimeS   float64
+	LargePreview image.Image
+	SmallPreview image.Image
+}
+
+type ctbHeader struct {
+	Magic              uint32
+	Version            uint32
+	BedXMM             float32
+	BedYMM             float32
+	BedZMM             float32
+	Unknown1           uint32
+	Unknown2           uint32
+	TotalHeightMM      float32
+	LayerHeightMM      float32
+	ExposureS          float32
+	BottomExposureS    float32
+	LightOffDelayS     float32
+	BottomLayers       uint32
+	ResolutionX        uint32
+	ResolutionY        uint32
+	LargePreviewOffset uint32
+	LayerTableOffset   uint32
+	LayerCount         uint32
+	SmallPreviewOffset uint32
+	PrintTimeS         uint32
+	ProjectorType      uint32
+	PrintParamsOffset  uint32
+	PrintParamsSize    uint32
+	AntiAliasLevel     uint32
+	LightPWM           uint16
+	BottomLightPWM     uint16
+	EncryptionKey      uint32
+	SlicerInfoOffset   uint32
+	SlicerInfoSize     uint32
+}
+
+type ctbPreviewHeader struct {
+	ResolutionX uint32
+	ResolutionY uint32
+	DataOffset  uint32
+	DataLength  uint32
+	Unknown     [4]uint32
+}
+
+type ctbPrintParams struct {
+	BottomLiftHeightMM   float32
+	BottomLiftSpeedMMM   float32 // mm/min
+	LiftHeightMM         float32
+	LiftSpeedMMM         float32
+	RetractSpeedMMM      float32
+	VolumeML             float32
+	WeightG              float32
+	Cost                 float32
+	BottomLightOffDelayS float32
+	LightOffDelayS       float32
+	BottomLayers         uint32
+	Padding              [4]uint32
+}
+
+type ctbSlicerInfo struct {
+	BottomLiftHeight2MM   float32
+	BottomLiftSpeed2MMM   float32
+	LiftHeight2MM         float32
+	LiftSpeed2MMM         float32
+	RetractHeight2MM      float32
+	RetractSpeed2MMM      float32
+	RestTimeAfterLiftS    float32
+	MachineNameOffset     uint32
+	MachineNameSize       uint32
+	AntiAliasFlag         uint8
+	Padding1              uint16
+	PerLayerSettings      uint8
+	ModifiedMinutes       uint32
+	AntiAliasLevel        uint32
+	SoftwareVersion       uint32
+	RestTimeAfterRetractS float32
+	RestTimeAfterLift2S   float32
+	TransitionLayers      uint32
+	PrintParamsV4Offset   uint32
+	Padding2              [2]uint32
+}
+
+type ctbPrintParamsV4 struct {
+	BottomRetractSpeedMMM  float32
+	BottomRetractSpeed2MMM float32
+	Padding1               uint32
+	Four1                  float32
+	Padding2               uint32
+	Four2                  float32
+	RestTimeAfterRetractS  float32
+	RestTimeAfterLiftS     float32
+	RestTimeBeforeLiftS    float32
+	BottomRetractHeight2MM float32
+	Unknown1               float32
+	Unknown2               uint32
+	Unknown3               uint32
+	LastLayerIndex         uint32
+	Padding3               [4]uint32
+	DisclaimerOffset       uint32
+	DisclaimerLength       uint32
+	Reserved               [384]byte
+}
+
+type ctbLayerDef struct {
+	PositionZMM    float32
+	ExposureS      float32
+	LightOffDelayS float32
+	DataOffset     uint32
+	DataLength     uint32
+	PageNumber     uint32
+	TableSize      uint32
+	Unknown        [2]uint32
+}
+
+type ctbLayerDefEx struct {
+	ctbLayerDef
+	TotalSize             uint32
+	LiftHeightMM          float32
+	LiftSpeedMMM          float32
+	LiftHeight2MM         float32
+	LiftSpeed2MMM         float32
+	RetractSpeedMMM       float32
+	RetractHeight2MM      float32
+	RetractSpeed2MMM      float32
+	RestTimeBeforeLiftS   float32
+	RestTimeAfterLiftS    float32
+	RestTimeAfterRetractS float32
+	LightPWM              float32
+}
+
+// EncodeCTBLayer encodes a layer with the CTB 7-bit grayscale RLE. A run is
+// a color byte with bit 7 set when a length follows; the length uses one to
+// four bytes, the count of leading one bits in the first byte giving the
+// number of extra bytes.
+func EncodeCTBLayer(img *image.Gray) []byte {
+	var out []byte
+	var color byte
+	run := 0
+
+	flush := func() {
+		if run == 0 {
+			return
+		}
+		if run == 1 {
+			out = append(out, color)
+			return
+		}
+		out = append(out, color|0x80)
+		switch {
+		case run <= 0x7f:
+			out = append(out, byte(run))
+		case run <= 0x3fff:
+			out = append(out, byte(run>>8)|0x80, byte(run))
+		case run <= 0x1fffff:
+			out = append(out, byte(run>>16)|0xc0, byte(run>>8), byte(run))
+		default:
+			out = append(out, byte(run>>24)|0xe0, byte(run>>16), byte(run>>8), byte(run))
+		}
+	}
+
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for _, v := range img.Pix[y*img.Stride : y*img.Stride+b.Dx()] {
+			c := v >> 1
+			if run > 0 && c == color && run < 0xfffffff {
+				run++
+				continue
+			}
+			flush()
+			color, run = c, 1
+		}
+	}
+	flush()
+	return out
+}
+
+// ctbCrypt XORs layer data with the keystream derived from the file key and
+// the layer index. Applying it twice gives the data back; a zero key means
+// the file isn't encrypted.
+func ctbCrypt(key uint32, layer int, data []byte) []byte {
+	if key == 0 {
+		return data
+	}
+	init := key*0x2d83cdac + 0xd8a83423
+	k := (uint32(layer)*0x1e1530cd + 0xec3d47cd) * init
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[i] = b ^ byte(k>>(8*uint(i%4)))
+		if i%4 == 3 {
+			k += init
+		}
+	}
+	return out
+}
+
+// encodeCTBPreview encodes a preview as RLE RGB15: 5 bits per channel with
+// bit 5 marking a run, followed by a 12-bit run length tagged 0x3000.
+func encodeCTBPreview(img image.Image) []byte {
+	var out []byte
+	var color uint16
+	run := 0
+
+	flush := func() {
+		switch {
+		case run == 1:
+			out = binary.LittleEndian.AppendUint16(out, color)
+		case run > 1:
+			out = binary.LittleEndian.AppendUint16(out, color|ctbPreviewRepeat)
+			out = binary.LittleEndian.AppendUint16(out, uint16(run-1)|0x3000)
+		}
+	}
+
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			c := uint16(r>>11)<<11 | uint16(g>>11)<<6 | uint16(bl>>11)
+			if run > 0 && c == color && run < ctbPreviewRunLimit {
+				run++
+				continue
+			}
+			flush()
+			color, run = c, 1
+		}
+	}
+	flush()
+	return out
+}
+
+// CTBWriter streams a .ctb file: the header blocks and an empty layer table
+// come first, then every layer as its extended definition and encrypted
+// data, each filling in its table entry.
+type CTBWriter struct {
+	w            LayerOutput
+	settings     *models.PrintSettings
+	key          uint32
+	params       ctbPrintParams
+	paramsOffset uint32
+	tableOffset  uint32
+	offset       uint32 // where the next layer's definition goes
+	layers       layerCounter
+}
+
+// NewCTBWriter writes everything before the layer data of a .ctb file with
+// layerCount layers. The resin volume is filled in by Close.
+func NewCTBWriter(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, info CTBInfo, layerCount int) (*CTBWriter, error) {
+	if info.Version != 3 && info.Version != 4 {
+		return nil, fmt.Errorf("unsupported CTB version %d", info.Version)
+	}
+
+	var keyBuf [4]byte
+	if _, err := rand.Read(keyBuf[:]); err != nil {
+		return nil, fmt.Errorf("generate key: %w", err)
+	}
+	key := binary.LittleEndian.Uint32(keyBuf[:]) | 1 // never 0, which means unencrypted
+
+	var large, small []byte
+	if info.LargePreview != nil {
+		large = encodeCTBPreview(info.LargePreview)
+	}
+	if info.SmallPreview != nil {
+		small = encodeCTBPreview(info.SmallPreview)
+	}
+
+	// Lay out every block before writing, so the header can point at them
+	largeOffset := uint32(ctbHeaderSize)
+	smallOffset := largeOffset + ctbPreviewHeadSize + uint32(len(large))
+	paramsOffset := smallOffset + ctbPreviewHeadSize + uint32(len(small))
+	slicerOffset := paramsOffset + ctbParamsSize
+	machineOffset := slicerOffset + ctbSlicerInfoSize
+	next := machineOffset + uint32(len(info.MachineName))
+	var paramsV4Offset, disclaimerOffset uint32
+	if info.Version >= 4 {
+		paramsV4Offset = next
+		disclaimerOffset = paramsV4Offset + ctbParamsV4Size
+		next = disclaimerOffset + uint32(len(ctbDisclaimer))
+	}
+	tableOffset := next
+
+	liftSpeed := float32(settings.LiftSpeedMMPS * 60)
+	retractSpeed := float32(settings.RetractSpeedMMPS * 60)
+	liftSpeed2 := float32(settings.LiftSpeed2MMPS * 60)
+	retractSpeed2 := float32(settings.RetractSpeed2MMPS * 60)
+	_, retractHeight2 := retractHeights(settings)
+	header := ctbHeader{
+		Magic:              ctbMagic,
+		Version:            uint32(info.Version),
+		BedXMM:             float32(profile.BuildWidthMM),
+		BedYMM:             float32(profile.BuildDepthMM),
+		BedZMM:             float32(profile.BuildHeightMM),
+		TotalHeightMM:      float32(float64(layerCount) * settings.LayerHeightMM),
+		LayerHeightMM:      float32(settings.LayerHeightMM),
+		ExposureS:          float32(settings.ExposureTimeS),
+		BottomExposureS:    float32(settings.BottomExposureS),
+		LightOffDelayS:     float32(settings.LightOffDelayS),
+		BottomLayers:       uint32(settings.BottomLayers),
+		ResolutionX:        uint32(profile.ResolutionX),
+		ResolutionY:        uint32(profile.ResolutionY),
+		LargePreviewOffset: largeOffset,
+		LayerTableOffset:   tableOffset,
+		LayerCount:         uint32(layerCount),
+		SmallPreviewOffset: smallOffset,
+		PrintTimeS:         uint32(info.PrintTimeS),
+		PrintParamsOffset:  paramsOffset,
+		PrintParamsSize:    ctbParamsSize,
+		AntiAliasLevel:     uint32(max(info.AntiAliasing, 1)),
+		LightPWM:           lightPWM(settings.LightPWM),
+		BottomLightPWM:     lightPWM(settings.BottomLightPWM),
+		EncryptionKey:      key,
+		SlicerInfoOffset:   slicerOffset,
+		SlicerInfoSize:     ctbSlicerInfoSize,
+	}
+	params := ctbPrintParams{
+		BottomLiftHeightMM:   float32(settings.LiftHeightMM),
+		BottomLiftSpeedMMM:   liftSpeed,
+		LiftHeightMM:         float32(settings.LiftHeightMM),
+		LiftSpeedMMM:         liftSpeed,
+		RetractSpeedMMM:      retractSpeed,
+		BottomLightOffDelayS: float32(settings.BottomLightOffDelayS),
+		LightOffDelayS:       float32(settings.LightOffDelayS),
+		BottomLayers:         uint32(settings.BottomLayers),
+	}
+	slicerInfo := ctbSlicerInfo{
+		BottomLiftHeight2MM:   float32(settings.LiftHeight2MM),
+		BottomLiftSpeed2MMM:   liftSpeed2,
+		LiftHeight2MM:         float32(settings.LiftHeight2MM),
+		LiftSpeed2MMM:         liftSpeed2,
+		RetractHeight2MM:      float32(retractHeight2),
+		RetractSpeed2MMM:      retractSpeed2,
+		RestTimeAfterLiftS:    float32(settings.WaitAfterLiftS),
+		RestTimeAfterRetractS: float32(settings.WaitBeforeCureS),
+		RestTimeAfterLift2S:   float32(settings.WaitAfterLiftS),
+		TransitionLayers:      uint32(settings.TransitionLayers),
+		MachineNameOffset:     machineOffset,
+		MachineNameSize:       uint32(len(info.MachineName)),
+		AntiAliasFlag:         ctbAntiAliasFlag,
+		PerLayerSettings:      ctbPerLayerV3,
+		ModifiedMinutes:       uint32(time.Now().Unix() / 60),
+		AntiAliasLevel:        header.AntiAliasLevel,
+		SoftwareVersion:       ctbSoftwareVersion,
+		PrintParamsV4Offset:   paramsV4Offset,
+	}
+	if info.AntiAliasing > 1 {
+		slicerInfo.AntiAliasFlag |= 0x08
+	}
+	if info.Version >= 4 {
+		slicerInfo.PerLayerSettings = ctbPerLayerV4
+	}
+
+	var buf bytes.Buffer
+	put := func(v any) {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	put(&header)
+	for _, p := range []struct {
+		img    image.Image
+		data   []byte
+		offset uint32
+	}{{info.LargePreview, large, largeOffset}, {info.SmallPreview, small, smallOffset}} {
+		var ph ctbPreviewHeader
+		if p.img != nil {
+			ph.ResolutionX = uint32(p.img.Bounds().Dx())
+			ph.ResolutionY = uint32(p.img.Bounds().Dy())
+			ph.DataOffset = p.offset + ctbPreviewHeadSize
+			ph.DataLength = uint32(len(p.data))
+		}
+		put(&ph)
+		buf.Write(p.data)
+	}
+	put(&params)
+	put(&slicerInfo)
+	buf.WriteString(info.MachineName)
+	if info.Version >= 4 {
+		put(&ctbPrintParamsV4{
+			BottomRetractSpeedMMM:  retractSpeed,
+			BottomRetractSpeed2MMM: retractSpeed2,
+			Four1:                  4,
+			Four2:                  4,
+			RestTimeAfterRetractS:  float32(settings.WaitBeforeCureS),
+			RestTimeAfterLiftS:     float32(settings.WaitAfterLiftS),
+			RestTimeBeforeLiftS:    float32(settings.WaitAfterCureS),
+			BottomRetractHeight2MM: float32(retractHeight2),
+			LastLayerIndex:         uint32(max(layerCount-1, 0)),
+			DisclaimerOffset:       disclaimerOffset,
+			DisclaimerLength:       uint32(len(ctbDisclaimer)),
+		})
+		buf.WriteString(ctbDisclaimer)
+	}
+	if uint32(buf.Len()) != tableOffset {
+		return nil, fmt.Errorf("CTB layout mismatch: wrote %d bytes before the layer table", buf.Len())
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	if err := writeZeros(w, int64(layerCount)*ctbLayerDefSize); err != nil {
+		return nil, fmt.Errorf("write layer table: %w", err)
+	}
+
+	return &CTBWriter{
+		w:            w,
+		settings:     settings,
+		key:          key,
+		params:       params,
+		paramsOffset: paramsOffset,
+		tableOffset:  tableOffset,
+		offset:       tableOffset + uint32(layerCount)*ctbLayerDefSize,
+		layers:       layerCounter{total: layerCount},
+	}, nil
+}
+
+// WriteLayer encodes a layer with EncodeCTBLayer, encrypts it and appends it.
+func (cw *CTBWriter) WriteLayer(img *image.Gray) error {
+	i, err := cw.layers.take()
+	if err != nil {
+		return err
+	}
+	data := ctbCrypt(cw.key, i, EncodeCTBLayer(img))
+
+	s := cw.settings
+	pwm := s.LightPWM
+	if i < s.BottomLayers {
+		pwm = s.BottomLightPWM
+	}
+	_, retractHeight2 := retractHeights(s)
+	def := ctbLayerDefEx{
+		ctbLayerDef: ctbLayerDef{
+			PositionZMM:    float32(float64(i+1) * s.LayerHeightMM),
+			ExposureS:      float32(LayerExposure(s, i)),
+			LightOffDelayS: float32(LayerLightOffDelay(s, i)),
+			DataOffset:     cw.offset + ctbLayerDefExSize,
+			DataLength:     uint32(len(data)),
+			TableSize:      ctbLayerDefExSize,
+		},
+		TotalSize:             ctbLayerDefExSize + uint32(len(data)),
+		LiftHeightMM:          cw.params.LiftHeightMM,
+		LiftSpeedMMM:          cw.params.LiftSpeedMMM,
+		LiftHeight2MM:         float32(s.LiftHeight2MM),
+		LiftSpeed2MMM:         float32(s.LiftSpeed2MMPS * 60),
+		RetractSpeedMMM:       cw.params.RetractSpeedMMM,
+		RetractHeight2MM:      float32(retractHeight2),
+		RetractSpeed2MMM:      float32(s.RetractSpeed2MMPS * 60),
+		RestTimeBeforeLiftS:   float32(s.WaitAfterCureS),
+		RestTimeAfterLiftS:    float32(s.WaitAfterLiftS),
+		RestTimeAfterRetractS: float32(s.WaitBeforeCureS),
+		LightPWM:              float32(lightPWM(pwm)),
+	}
+	if err := writeStructAt(cw.w, binary.LittleEndian, &def.ctbLayerDef, int64(cw.tableOffset)+int64(i)*ctbLayerDefSize); err != nil {
+		return fmt.Errorf("write layer table entry %d: %w", i, err)
+	}
+	if err := binary.Write(cw.w, binary.LittleEndian, &def); err != nil {
+		return fmt.Errorf("write layer definition %d: %w", i, err)
+	}
+	if _, err := cw.w.Write(data); err != nil {
+		return fmt.Errorf("write layer data %d: %w", i, err)
+	}
+	cw.offset += def.TotalSize
+	return nil
+}
+
+// Close patches the resin volume and weight into the print parameters.
+func (cw *CTBWriter) Close(volumeML float64) error {
+	if err := cw.layers.check(); err != nil {
+		return err
+	}
+	cw.params.VolumeML = float32(volumeML)
+	cw.params.WeightG = cw.params.VolumeML * ctbResinDensityGML
+	if err := writeStructAt(cw.w, binary.LittleEndian, &cw.params, int64(cw.paramsOffset)); err != nil {
+		return fmt.Errorf("write print parameters: %w", err)
+	}
+	return nil
+}
+
+// DecodeCTB reads a .ctb file of version 2 to 4, or a .cbddlp file. Only the
+// first layer table of an anti-aliased cbddlp is read, so its layers come
+// back in black and white.
+func DecodeCTB(r io.ReaderAt, size int64) (*PrintFile, error) {
+	var h ctbHeader
+	if size < ctbHeaderSize {
+		return nil, fmt.Errorf("file too small for a CTB header")
+	}
+	if err := binary.Read(io.NewSectionReader(r, 0, ctbHeaderSize), binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if h.Magic != ctbMagic && h.Magic != cbddlpMagic {
+		return nil, fmt.Errorf("not a CTB file")
+	}
+
+	f := &PrintFile{
+		Format:          "ctb",
+		Version:         int(h.Version),
+		ResolutionX:     int(h.ResolutionX),
+		ResolutionY:     int(h.ResolutionY),
+		BedXMM:          float64(h.BedXMM),
+		BedYMM:          float64(h.BedYMM),
+		BedZMM:          float64(h.BedZMM),
+		LayerHeightMM:   float64(h.LayerHeightMM),
+		ExposureS:       float64(h.ExposureS),
+		BottomExposureS: float64(h.BottomExposureS),
+		BottomLayers:    int(h.BottomLayers),
+		AntiAliasing:    int(max(h.AntiAliasLevel, 1)),
+		PrintTimeS:      float64(h.PrintTimeS),
+		LayerCount:      int(h.LayerCount),
+		r:               r,
+	}
+	if h.Magic == cbddlpMagic {
+		f.Format = "cbddlp"
+	}
+
+	for _, offset := range []uint32{h.LargePreviewOffset, h.SmallPreviewOffset} {
+		if offset == 0 {
+			continue
+		}
+		img, err := readCTBPreview(r, size, offset)
+		if err != nil {
+			return nil, err
+		}
+		if img != nil {
+			f.Previews = append(f.Previews, img)
+		}
+	}
+
+	if h.PrintParamsOffset != 0 && h.PrintParamsSize >= ctbParamsSize {
+		var p ctbPrintParams
+		if err := binary.Read(io.NewSectionReader(r, int64(h.PrintParamsOffset), ctbParamsSize), binary.LittleEndian, &p); err != nil {
+			return nil, fmt.Errorf("read print parameters: %w", err)
+		}
+		f.LiftHeightMM = float64(p.LiftHeightMM)
+		f.LiftSpeedMMPS = float64(p.LiftSpeedMMM) / 60
+		f.RetractSpeedMMPS = float64(p.RetractSpeedMMM) / 60
+		f.VolumeML = float64(p.VolumeML)
+	}
+	if h.SlicerInfoOffset != 0 && h.SlicerInfoSize >= ctbSlicerInfoSize {
+		var si ctbSlicerInfo
+		if err := binary.Read(io.NewSectionReader(r, int64(h.SlicerInfoOffset), ctbSlicerInfoSize), binary.LittleEndian, &si); err != nil {
+			return nil, fmt.Errorf("read slicer info: %w", err)
+		}
+		if si.MachineNameSize > 0 && int64(si.MachineNameOffset)+int64(si.MachineNameSize) <= size {
+			name := make([]byte, si.MachineNameSize)
+			if _, err := r.ReadAt(name, int64(si.MachineNameOffset)); err != nil {
+				return nil, fmt.Errorf("read machine name: %w", err)
+			}
+			f.MachineName = cString(name)
+		}
+	}
+
+	if int64(h.LayerTableOffset)+int64(f.LayerCount)*ctbLayerDefSize > size {
+		return nil, fmt.Errorf("layer table out of bounds")
+	}
+	table := io.NewSectionReader(r, int64(h.LayerTableOffset), int64(f.LayerCount)*ctbLayerDefSize)
+	for i := 0; i < f.LayerCount; i++ {
+		var def ctbLayerDef
+		if err := binary.Read(table, binary.LittleEndian, &def); err != nil {
+			return nil, fmt.Errorf("read layer definition %d: %w", i, err)
+		}
+		f.layers = append(f.layers, printFileLayer{offset: int64(def.DataOffset), length: int(def.DataLength)})
+	}
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	width, height := f.ResolutionX, f.ResolutionY
+	if h.Magic == cbddlpMagic {
+		f.decode = func(data []byte, _ int) (*image.Gray, error) {
+			return decodePhotonLayer(data, width, height)
+		}
+		return f, nil
+	}
+	key := h.EncryptionKey
+	f.decode = func(data []byte, layer int) (*image.Gray, error) {
+		return decodeCTBLayer(ctbCrypt(key, layer, data), width, height)
+	}
+	return f, nil
+}
+
+// readCTBPreview reads the preview whose header is at offset, or returns nil
+// when the header is empty or points outside the file. Sizes above
+// maxPreviewSize, or more pixels than DataLength bytes can encode, are an
+// error.
+func readCTBPreview(r io.ReaderAt, size int64, offset uint32) (image.Image, error) {
+	var ph ctbPreviewHeader
+	if err := binary.Read(io.NewSectionReader(r, int64(offset), ctbPreviewHeadSize), binary.LittleEndian, &ph); err != nil {
+		return nil, fmt.Errorf("read preview: %w", err)
+	}
+	if ph.ResolutionX == 0 || ph.ResolutionY == 0 || int64(ph.DataOffset)+int64(ph.DataLength) > size {
+		return nil, nil
+	}
+	// A run of up to ctbPreviewRunLimit+1 pixels takes 4 bytes
+	pixels := int64(ph.ResolutionX) * int64(ph.ResolutionY)
+	if ph.ResolutionX > maxPreviewSize || ph.ResolutionY > maxPreviewSize ||
+		pixels > (int64(ph.DataLength)+3)/4*(ctbPreviewRunLimit+1) {
+		return nil, fmt.Errorf("invalid %dx%d preview of %d bytes", ph.ResolutionX, ph.ResolutionY, ph.DataLength)
+	}
+	data := make([]byte, ph.DataLength)
+	if _, err := r.ReadAt(data, int64(ph.DataOffset)); err != nil {
+		return nil, fmt.Errorf("read preview: %w", err)
+	}
+	return decodeCTBPreview(data, int(ph.ResolutionX), int(ph.ResolutionY)), nil
+}
+
+// decodeCTBLayer is the inverse of EncodeCTBLayer.
+func decodeCTBLayer(data []byte, width, height int) (*image.Gray, error) {
+	w := newRunWriter(width, height)
+	for i := 0; i < len(data); {
+		c := data[i] & 0x7f
+		v := c<<1 | c>>6
+		run := 1
+		if data[i]&0x80 != 0 {
+			if i+1 >= len(data) {
+				return nil, fmt.Errorf("truncated run at byte %d", i)
+			}
+			l := data[i+1]
+			var extra int
+			switch {
+			case l&0x80 == 0:
+				run = int(l)
+			case l&0xc0 == 0x80:
+				run, extra = int(l&0x3f), 1
+			case l&0xe0 == 0xc0:
+				run, extra = int(l&0x1f), 2
+			case l&0xf0 == 0xe0:
+				run, extra = int(l&0x0f), 3
+			default:
+				return nil, fmt.Errorf("invalid run length at byte %d", i+1)
+			}
+			if i+2+extra > len(data) {
+				return nil, fmt.Errorf("truncated run at byte %d", i)
+			}
+			for _, b := range data[i+2 : i+2+extra] {
+				run = run<<8 | int(b)
+			}
+			i += 1 + extra
+		}
+		i++
+		if err := w.put(v, run); err != nil {
+			return nil, err
+		}
+	}
+	return w.finish()
+}
+
+// decodeCTBPreview is the inverse of encodeCTBPreview. Pixels the data
+// doesn't cover are left black.
+func decodeCTBPreview(data []byte, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	pos := 0
+	for i := 0; i+1 < len(data) && pos < width*height; i += 2 {
+		c := binary.LittleEndian.Uint16(data[i:])
+		run := 1
+		if c&ctbPreviewRepeat != 0 && i+3 < len(data) {
+			i += 2
+			run = int(binary.LittleEndian.Uint16(data[i:])&ctbPreviewRunLimit) + 1
+		}
+		r, g, b := byte(c>>11), byte(c>>6&0x1f), byte(c&0x1f)
+		for ; run > 0 && pos < width*height; run-- {
+			img.Pix[4*pos] = r<<3 | r>>2
+			img.Pix[4*pos+1] = g<<3 | g>>2
+			img.Pix[4*pos+2] = b<<3 | b>>2
+			img.Pix[4*pos+3] = 0xff
+			pos++
+		}
+	}
+	return img
+}
@@ -2,6 +2,7 @@ package slicer
 
 import (
 	"encoding/binary"
+	"fmt"
 	"image"
 	"io"
 	"math"
@@ -16,8 +17,19 @@ const (
 	layerdefMagic = "LAYERDEF"
 )
 
-// WriteDLPFile writes an Anycubic binary .dlp file.
-func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.PrintSettings, layers []*image.Gray) error {
+// DLPWriter streams an Anycubic binary .dlp file: the sections up to an
+// empty LAYERDEF table come first, and each layer fills in its entry.
+type DLPWriter struct {
+	w           LayerOutput
+	settings    *models.PrintSettings
+	tableOffset uint32
+	offset      uint32 // where the next layer's data goes
+	layers      layerCounter
+}
+
+// NewDLPWriter writes everything before the layer data of a .dlp file. The
+// preview is drawn at 224x168; nil leaves it black.
+func NewDLPWriter(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, preview image.Image, layerCount int) (*DLPWriter, error) {
 	// 1. Calculate Offsets
 	// Main Header: 72 bytes
 	// HEADER section: 8 (magic) + 80 (data) = 88 bytes
@@ -28,15 +40,7 @@ func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.
 	previewOffset := headerOffset + 88
 	layerdefOffset := previewOffset + 75284
 	
-	// Encode layers first to know their sizes and offsets
-	encodedLayers := make([][]byte, len(layers))
-	totalDataSize := uint32(0)
-	for i, img := range layers {
-		encodedLayers[i] = RLEEncode(img) // Reuse Photon RLE for now, Anycubic often uses similar
-		totalDataSize += uint32(len(encodedLayers[i]))
-	}
-	
-	layerDataStart := layerdefOffset + 16 + uint32(len(layers))*32
+	layerDataStart := layerdefOffset + 16 + uint32(layerCount)*32
 
 	// 2. Write Main Header (72 bytes)
 	mainHeader := make([]byte, 72)
@@ -49,7 +53,7 @@ func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.
 	binary.LittleEndian.PutUint32(mainHeader[28:32], layerdefOffset)
 	// Remaining bytes are padding/reserved
 	if _, err := w.Write(mainHeader); err != nil {
-		return err
+		return nil, err
 	}
 
 	// 3. Write HEADER section (88 bytes)
@@ -60,7 +64,11 @@ func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.
 	putFloat32(hSec[12:16], float32(settings.LayerHeightMM))
 	putFloat32(hSec[16:20], float32(settings.ExposureTimeS))
 	putFloat32(hSec[20:24], float32(settings.BottomExposureS))
-	putFloat32(hSec[24:28], 0.5) // Off time
+	offTime := float32(0.5)
+	if settings.LightOffDelayS > 0 {
+		offTime = float32(settings.LightOffDelayS)
+	}
+	putFloat32(hSec[24:28], offTime)
 	binary.LittleEndian.PutUint32(hSec[28:32], uint32(settings.BottomLayers))
 	putFloat32(hSec[32:36], float32(profile.BuildWidthMM))
 	putFloat32(hSec[36:40], float32(profile.BuildDepthMM))
@@ -69,7 +77,7 @@ func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.
 	binary.LittleEndian.PutUint32(hSec[44:48], uint32(profile.ResolutionX))
 	binary.LittleEndian.PutUint32(hSec[48:52], uint32(profile.ResolutionY))
 	if _, err := w.Write(hSec); err != nil {
-		return err
+		return nil, err
 	}
 
 	// 4. Write PREVIEW section (75284 bytes)
@@ -78,48 +86,146 @@ func WriteDLPFile(w io.Writer, profile *models.PrinterProfile, settings *models.
 	binary.LittleEndian.PutUint32(pSec[8:12], 75276) // Preview data length
 	binary.LittleEndian.PutUint32(pSec[12:16], 224) // Width
 	binary.LittleEndian.PutUint32(pSec[16:20], 168) // Height
-	// Fill preview with black (0x0000 in RGB565) or a simple pattern
-	// ... (pixels start at 20)
+	// Pixels start at 20, RGB565 little-endian
+	if preview != nil {
+		copy(pSec[20:], encodeRGB565(preview, binary.LittleEndian))
+	}
 	if _, err := w.Write(pSec); err != nil {
-		return err
+		return nil, err
 	}
 
-	// 5. Write LAYERDEF section
+	// 5. Write LAYERDEF section, its entries filled in by WriteLayer
 	lDefHeader := make([]byte, 16)
 	copy(lDefHeader[0:8], layerdefMagic)
-	binary.LittleEndian.PutUint32(lDefHeader[8:12], uint32(len(layers))*32 + 4)
-	binary.LittleEndian.PutUint32(lDefHeader[12:16], uint32(len(layers)))
+	binary.LittleEndian.PutUint32(lDefHeader[8:12], uint32(layerCount)*32 + 4)
+	binary.LittleEndian.PutUint32(lDefHeader[12:16], uint32(layerCount))
 	if _, err := w.Write(lDefHeader); err != nil {
-		return err
+		return nil, err
 	}
-
-	currentOffset := layerDataStart
-	for i := 0; i < len(layers); i++ {
-		lEntry := make([]byte, 32)
-		binary.LittleEndian.PutUint32(lEntry[0:4], currentOffset)
-		binary.LittleEndian.PutUint32(lEntry[4:8], uint32(len(encodedLayers[i])))
-		putFloat32(lEntry[8:12], float32(float64(i+1)*settings.LayerHeightMM))
-		putFloat32(lEntry[12:16], float32(settings.ExposureTimeS))
-		if i < settings.BottomLayers {
-			putFloat32(lEntry[12:16], float32(settings.BottomExposureS))
-		}
-		// Padding 16 bytes
-		if _, err := w.Write(lEntry); err != nil {
-			return err
-		}
-		currentOffset += uint32(len(encodedLayers[i]))
+	if err := writeZeros(w, int64(layerCount)*32); err != nil {
+		return nil, err
 	}
 
-	// 6. Write Layer Data
-	for _, data := range encodedLayers {
-		if _, err := w.Write(data); err != nil {
-			return err
-		}
+	return &DLPWriter{
+		w:           w,
+		settings:    settings,
+		tableOffset: layerdefOffset + 16,
+		offset:      layerDataStart,
+		layers:      layerCounter{total: layerCount},
+	}, nil
+}
+
+// WriteLayer encodes a layer with RLEEncode and appends it.
+func (dw *DLPWriter) WriteLayer(img *image.Gray) error {
+	i, err := dw.layers.take()
+	if err != nil {
+		return err
 	}
+	data := RLEEncode(img) // Reuse Photon RLE for now, Anycubic often uses similar
 
+	lEntry := make([]byte, 32)
+	binary.LittleEndian.PutUint32(lEntry[0:4], dw.offset)
+	binary.LittleEndian.PutUint32(lEntry[4:8], uint32(len(data)))
+	putFloat32(lEntry[8:12], float32(float64(i+1)*dw.settings.LayerHeightMM))
+	putFloat32(lEntry[12:16], float32(LayerExposure(dw.settings, i)))
+	// Padding 16 bytes
+	if _, err := dw.w.WriteAt(lEntry, int64(dw.tableOffset)+int64(i)*32); err != nil {
+		return err
+	}
+	if _, err := dw.w.Write(data); err != nil {
+		return err
+	}
+	dw.offset += uint32(len(data))
 	return nil
 }
 
+// Close checks that every layer was written; the .dlp header carries no
+// totals.
+func (dw *DLPWriter) Close(volumeML float64) error {
+	return dw.layers.check()
+}
+
 func putFloat32(b []byte, v float32) {
 	binary.LittleEndian.PutUint32(b, math.Float32bits(v))
 }
+
+// DecodeDLP reads a .dlp file written by DLPWriter. Files whose first
+// section isn't a HEADER at the fixed offset are read as Photon Workshop
+// containers, which Anycubic also ships under this extension.
+func DecodeDLP(r io.ReaderAt, size int64) (*PrintFile, error) {
+	main := make([]byte, 72+88)
+	if size < int64(len(main)) {
+		return nil, fmt.Errorf("file too small for a DLP header")
+	}
+	if _, err := r.ReadAt(main, 0); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if string(main[0:8]) != anycubicMagic {
+		return nil, fmt.Errorf("not a DLP file")
+	}
+	if binary.LittleEndian.Uint32(main[12:16]) != 72 || cString(main[72:80]) != headerMagic {
+		return DecodePWS(r, size, "dlp")
+	}
+
+	h := main[72:]
+	u32 := func(offset int) uint32 { return binary.LittleEndian.Uint32(h[offset:]) }
+	f32 := func(offset int) float64 { return float64(math.Float32frombits(u32(offset))) }
+	f := &PrintFile{
+		Format:          "dlp",
+		Version:         int(binary.LittleEndian.Uint32(main[8:12])),
+		LayerHeightMM:   f32(12),
+		ExposureS:       f32(16),
+		BottomExposureS: f32(20),
+		BottomLayers:    int(u32(28)),
+		BedXMM:          f32(32),
+		BedYMM:          f32(36),
+		BedZMM:          f32(40),
+		ResolutionX:     int(u32(44)),
+		ResolutionY:     int(u32(48)),
+		AntiAliasing:    1,
+		r:               r,
+	}
+
+	previewOffset := int64(binary.LittleEndian.Uint32(main[20:24]))
+	head := make([]byte, 20)
+	if _, err := r.ReadAt(head, previewOffset); err != nil {
+		return nil, fmt.Errorf("read preview: %w", err)
+	}
+	pw, ph := int64(binary.LittleEndian.Uint32(head[12:])), int64(binary.LittleEndian.Uint32(head[16:]))
+	if pw > 0 && ph > 0 && pw <= maxPreviewSize && ph <= maxPreviewSize && pw*ph*2 <= size-previewOffset-20 {
+		data := make([]byte, pw*ph*2)
+		if _, err := r.ReadAt(data, previewOffset+20); err != nil {
+			return nil, fmt.Errorf("read preview: %w", err)
+		}
+		f.Previews = append(f.Previews, decodeRGB565(data, int(pw), int(ph), binary.LittleEndian))
+	}
+
+	defOffset := int64(binary.LittleEndian.Uint32(main[28:32]))
+	if _, err := r.ReadAt(head[:16], defOffset); err != nil {
+		return nil, fmt.Errorf("read layer table: %w", err)
+	}
+	f.LayerCount = int(binary.LittleEndian.Uint32(head[12:16]))
+	if defOffset+16+int64(f.LayerCount)*32 > size {
+		return nil, fmt.Errorf("layer table out of bounds")
+	}
+	table := make([]byte, f.LayerCount*32)
+	if _, err := r.ReadAt(table, defOffset+16); err != nil {
+		return nil, fmt.Errorf("read layer table: %w", err)
+	}
+	for i := 0; i < f.LayerCount; i++ {
+		entry := table[i*32:]
+		f.layers = append(f.layers, printFileLayer{
+			offset: int64(binary.LittleEndian.Uint32(entry[0:])),
+			length: int(binary.LittleEndian.Uint32(entry[4:])),
+		})
+	}
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	width, height := f.ResolutionX, f.ResolutionY
+	f.decode = func(data []byte, _ int) (*image.Gray, error) {
+		return decodePhotonLayer(data, width, height)
+	}
+	return f, nil
+}
@@ -1,6 +1,7 @@
 package slicer
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"fmt"
@@ -15,25 +16,78 @@ import (
 	"3dmodels/internal/models"
 )
 
+// maxReportedOpenLayers caps how many layer numbers with open contours are
+// kept on a job, so a badly broken mesh doesn't bloat the status payload.
+const maxReportedOpenLayers = 20
+
 type Engine struct {
-	mu   sync.Mutex
-	jobs map[string]*models.SliceJob
-	sem  chan struct{} // Concurrency semaphore
+	mu        sync.Mutex
+	jobs      map[string]*models.SliceJob
+	records   map[string]*models.SliceJobRecord // history entries of the jobs in jobs
+	queue     []queuedJob                       // pending jobs, first in first out
+	running   int
+	workers   int             // max concurrent jobs
+	cancelled map[string]bool // running jobs asked to stop
+	store     JobStore
+	outputDir string
+	cache     *outputCache // nil until EnableCache
+}
+
+type queuedJob struct {
+	job *models.SliceJob
+	req SliceRequest
+}
+
+// EnableCache makes the engine reuse the output of identical requests,
+// keeping up to budget() bytes of files in dir.
+func (e *Engine) EnableCache(dir string, budget func() int64) error {
+	c, err := newOutputCache(dir, budget)
+	if err != nil {
+		return err
+	}
+	e.cache = c
+	return nil
 }
 
-func NewEngine() *Engine {
+// JobStore keeps the history of slice jobs, so finished files survive
+// restarts until the retention policy removes them.
+type JobStore interface {
+	CreateSliceJob(j *models.SliceJobRecord) error
+	UpdateSliceJob(j *models.SliceJobRecord) error
+	ExpiredSliceJobs(before time.Time) ([]models.SliceJobRecord, error)
+	DeleteSliceJob(id string) error
+}
+
+// NewEngine creates an engine running up to workers jobs at once and
+// writing its files to outputDir (the system temp directory if empty).
+// A nil store disables the job history.
+func NewEngine(store JobStore, outputDir string, workers int) *Engine {
+	if workers < 1 {
+		workers = 1
+	}
 	return &Engine{
-		jobs: make(map[string]*models.SliceJob),
-		sem:  make(chan struct{}, 1), // Only 1 concurrent slice job
+		jobs:      make(map[string]*models.SliceJob),
+		records:   make(map[string]*models.SliceJobRecord),
+		workers:   workers,
+		cancelled: make(map[string]bool),
+		store:     store,
+		outputDir: outputDir,
 	}
 }
 
 type SliceRequest struct {
+	UserID     int64 // owner of the job
 	FilePaths  []string
 	Profile    *models.PrinterProfile
 	Settings   *models.PrintSettings
 	ModelName  string
-	FileFormat string // "photon" or "dlp" (overrides profile)
+	FileFormat string                 // an OutputFormat ID (overrides profile)
+	FillRule   FillRule               // empty = nonzero for multi-object plates, even-odd otherwise
+	Transforms []ObjectTransform      // parallel to FilePaths
+	Arrange    bool                   // pack objects on the plate instead of centering each
+	DrainHoles []DrainHole            // user drain holes; empty = placed automatically
+	Orient     OrientGoal             // auto-orient every file; replaces the X/Y rotation of its transform
+	Record     *models.SliceJobRecord // history entry to keep for the job; nil = not recorded
 }
 
 func (e *Engine) StartSlice(req SliceRequest) (string, error) {
@@ -47,23 +101,190 @@ func (e *Engine) StartSlice(req SliceRequest) (string, error) {
 	jobID := generateID()
 	job := &models.SliceJob{
 		ID:      jobID,
+		UserID:  req.UserID,
 		Status:  "pending",
 		Message: "Waiting in queue...",
 	}
 
+	rec := req.Record
+	if e.store == nil {
+		rec = nil
+	}
+	if rec != nil {
+		rec.ID = jobID
+		rec.Status = job.Status
+		rec.Message = job.Message
+		if err := e.store.CreateSliceJob(rec); err != nil {
+			return "", fmt.Errorf("record slice job: %w", err)
+		}
+	}
+
 	e.mu.Lock()
 	e.jobs[jobID] = job
+	if rec != nil {
+		e.records[jobID] = rec
+	}
+	e.queue = append(e.queue, queuedJob{job: job, req: req})
+	e.dispatch()
 	e.mu.Unlock()
 
-	go func() {
-		// Acquire semaphore
-		e.sem <- struct{}{}
-		defer func() { <-e.sem }()
+	return jobID, nil
+}
+
+// dispatch starts queued jobs while there are free workers. e.mu must be held.
+func (e *Engine) dispatch() {
+	for e.running < e.workers && len(e.queue) > 0 {
+		q := e.queue[0]
+		e.queue = e.queue[1:]
+		e.running++
+		go e.run(q.job, q.req)
+	}
+}
+
+func (e *Engine) run(job *models.SliceJob, req SliceRequest) {
+	e.mu.Lock()
+	rec := e.records[job.ID]
+	e.mu.Unlock()
+	if rec != nil {
+		now := time.Now()
+		rec.Status = "slicing"
+		rec.StartedAt = &now
+		if err := e.store.UpdateSliceJob(rec); err != nil {
+			log.Printf("Slice job %s: %v", job.ID, err)
+		}
+	}
 
+	key := ""
+	if e.cache != nil && e.cache.enabled() {
+		var err error
+		if key, err = fingerprint(req); err != nil {
+			log.Printf("Slice cache: %v", err)
+			key = ""
+		}
+	}
+	if key == "" || !e.restoreCached(job, req, key) {
 		e.sliceWorker(job, req)
-	}()
+		if key != "" {
+			e.cacheOutput(job, key)
+		}
+	}
+	e.finishJob(job)
 
-	return jobID, nil
+	e.mu.Lock()
+	e.running--
+	e.dispatch()
+	e.mu.Unlock()
+}
+
+// restoreCached completes a job with the cached output for key, if any.
+func (e *Engine) restoreCached(job *models.SliceJob, req SliceRequest, key string) bool {
+	cachedPath, res, ok := e.cache.get(key)
+	if !ok {
+		return false
+	}
+	out, err := e.createOutputFile(res.Job.Extension)
+	if err != nil {
+		log.Printf("Slice cache: %v", err)
+		return false
+	}
+	out.Close()
+	os.Remove(out.Name())
+	if err := linkOrCopy(cachedPath, out.Name()); err != nil {
+		log.Printf("Slice cache: %v", err)
+		return false
+	}
+
+	restored := res.Job
+	restored.ID = job.ID
+	restored.UserID = job.UserID
+	restored.Status = "complete"
+	restored.Progress = 100
+	restored.CurrentLayer = restored.TotalLayers
+	restored.Message = "Complete (cached)"
+	restored.OutputPath = out.Name()
+	restored.ResinCost = restored.ResinML / 1000 * req.Settings.ResinPricePerL
+	restored.Layers = res.Layers
+
+	e.mu.Lock()
+	*job = restored
+	e.mu.Unlock()
+	log.Printf("Slice job %s: reused cached output %s", job.ID, key)
+	return true
+}
+
+// cacheOutput adds the output of a completed job to the cache.
+func (e *Engine) cacheOutput(job *models.SliceJob, key string) {
+	e.mu.Lock()
+	if job.Status != "complete" {
+		e.mu.Unlock()
+		return
+	}
+	cp := *job
+	cp.Layers = job.Layers[:len(job.Layers):len(job.Layers)]
+	e.mu.Unlock()
+
+	if err := e.cache.put(key, &cp); err != nil {
+		log.Printf("Slice cache: %v", err)
+	}
+}
+
+// finishJob records the outcome of a job that is done, one way or another,
+// and schedules its cleanup after 30 minutes.
+func (e *Engine) finishJob(job *models.SliceJob) {
+	e.mu.Lock()
+	delete(e.cancelled, job.ID)
+	rec := e.records[job.ID]
+	e.mu.Unlock()
+
+	if rec != nil {
+		e.recordResult(job, rec)
+	}
+	time.AfterFunc(30*time.Minute, func() { e.CleanupJob(job.ID) })
+}
+
+// CancelJob stops a job: a queued job is dropped at once, a running one
+// stops before its next layer. Jobs already writing their file finish.
+func (e *Engine) CancelJob(jobID string) error {
+	e.mu.Lock()
+	job, ok := e.jobs[jobID]
+	if !ok {
+		e.mu.Unlock()
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+	switch job.Status {
+	case "complete", "error", "cancelled":
+		e.mu.Unlock()
+		return fmt.Errorf("job already finished")
+	}
+
+	for i, q := range e.queue {
+		if q.job == job {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			job.Status = "cancelled"
+			job.Message = "Cancelled"
+			e.mu.Unlock()
+			e.finishJob(job)
+			return nil
+		}
+	}
+
+	e.cancelled[jobID] = true
+	job.Message = "Cancelling..."
+	e.mu.Unlock()
+	return nil
+}
+
+// stopIfCancelled marks the job as cancelled if that was asked for, and
+// reports whether the worker must stop.
+func (e *Engine) stopIfCancelled(job *models.SliceJob) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if !e.cancelled[job.ID] {
+		return false
+	}
+	job.Status = "cancelled"
+	job.Message = "Cancelled"
+	return true
 }
 
 func (e *Engine) GetJobStatus(jobID string) (*models.SliceJob, error) {
@@ -77,6 +298,18 @@ func (e *Engine) GetJobStatus(jobID string) (*models.SliceJob, error) {
 
 	// Return a copy
 	cp := *job
+	for i, q := range e.queue {
+		if q.job == job {
+			cp.QueuePosition = i + 1
+			break
+		}
+	}
+	cp.OpenContourLayers = append([]int(nil), job.OpenContourLayers...)
+	cp.Layers = job.Layers[:len(job.Layers):len(job.Layers)]
+	if job.Repair != nil {
+		r := *job.Repair
+		cp.Repair = &r
+	}
 	return &cp, nil
 }
 
@@ -94,19 +327,106 @@ func (e *Engine) GetOutputFile(jobID string) (string, error) {
 	return job.OutputPath, nil
 }
 
-// CleanupJob removes a job and its output file.
+// LayerImage decodes layer n (1-based) back from a finished job's output file.
+func (e *Engine) LayerImage(jobID string, n int) (*image.Gray, error) {
+	outputPath, err := e.GetOutputFile(jobID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenPrintFile(outputPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Layer(n - 1)
+}
+
+// CleanupJob removes a job from memory. Its output file is removed too,
+// unless the job is in the history: then the retention policy removes it.
 func (e *Engine) CleanupJob(jobID string) {
 	e.mu.Lock()
 	job, ok := e.jobs[jobID]
 	if ok {
-		if job.OutputPath != "" {
+		if _, recorded := e.records[jobID]; !recorded && job.OutputPath != "" {
 			os.Remove(job.OutputPath)
 		}
 		delete(e.jobs, jobID)
+		delete(e.records, jobID)
 	}
 	e.mu.Unlock()
 }
 
+// recordResult copies the outcome of a finished job into its history entry.
+func (e *Engine) recordResult(job *models.SliceJob, rec *models.SliceJobRecord) {
+	e.mu.Lock()
+	rec.Status = job.Status
+	rec.Message = job.Message
+	rec.TotalLayers = job.TotalLayers
+	rec.PrintTimeS = job.PrintTimeS
+	rec.ResinML = job.ResinML
+	rec.ResinCost = job.ResinCost
+	rec.Extension = job.Extension
+	rec.OutputPath = job.OutputPath
+	e.mu.Unlock()
+
+	if fi, err := os.Stat(rec.OutputPath); rec.OutputPath != "" && err == nil {
+		rec.OutputSize = fi.Size()
+	}
+	now := time.Now()
+	rec.FinishedAt = &now
+	if err := e.store.UpdateSliceJob(rec); err != nil {
+		log.Printf("Slice job %s: %v", rec.ID, err)
+	}
+}
+
+// StartRetention removes, once an hour, the history entries and files of
+// the jobs older than keepDays() days. Zero or less keeps everything.
+func (e *Engine) StartRetention(ctx context.Context, keepDays func() int) {
+	if e.store == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+
+		for {
+			e.removeExpired(keepDays())
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (e *Engine) removeExpired(keepDays int) {
+	if keepDays <= 0 {
+		return
+	}
+	expired, err := e.store.ExpiredSliceJobs(time.Now().AddDate(0, 0, -keepDays))
+	if err != nil {
+		log.Printf("Slice retention: %v", err)
+		return
+	}
+	for _, j := range expired {
+		if j.OutputPath != "" {
+			if err := os.Remove(j.OutputPath); err != nil && !os.IsNotExist(err) {
+				log.Printf("Slice retention: %v", err)
+				continue
+			}
+		}
+		if err := e.store.DeleteSliceJob(j.ID); err != nil {
+			log.Printf("Slice retention: %v", err)
+			continue
+		}
+		e.CleanupJob(j.ID)
+	}
+	if len(expired) > 0 {
+		log.Printf("Slice retention: removed %d jobs older than %d days", len(expired), keepDays)
+	}
+}
+
 func (e *Engine) updateJob(job *models.SliceJob, status string, progress int, msg string) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
@@ -123,19 +443,18 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 		}
 	}()
 
-	// Schedule cleanup after 30 minutes
-	go func() {
-		time.Sleep(30 * time.Minute)
-		e.CleanupJob(job.ID)
-	}()
-
-	// Step 1: Parse all STL files and merge
+	// Step 1: Parse all mesh files and merge
 	e.updateJob(job, "slicing", 0, "Initializing...")
 
-	var merged *Mesh
+	var meshes []*Mesh
+	var names []string
+	var transforms []ObjectTransform
 	validFileCount := 0
 	for i, fp := range req.FilePaths {
-		mesh, err := ParseSTL(fp)
+		if e.stopIfCancelled(job) {
+			return
+		}
+		mesh, err := ParseMesh(fp)
 		if err != nil {
 			// Log the error but skip to next file instead of failing
 			log.Printf("Warning: Skipping file %s: %v", filepath.Base(fp), err)
@@ -148,38 +467,69 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 			mesh.MaxBound[0], mesh.MaxBound[1], mesh.MaxBound[2],
 			len(mesh.Triangles))
 
-		validFileCount++
-
-		// Center on plate
-		centerX := req.Profile.BuildWidthMM / 2
-		centerY := req.Profile.BuildDepthMM / 2
-		mesh.CenterOnPlate(centerX, centerY)
-
-		log.Printf("DEBUG: After CenterOnPlate - Bounds: [%.4f,%.4f,%.4f] to [%.4f,%.4f,%.4f]",
-			mesh.MinBound[0], mesh.MinBound[1], mesh.MinBound[2],
-			mesh.MaxBound[0], mesh.MaxBound[1], mesh.MaxBound[2])
-
-		if merged == nil {
-			merged = mesh
-		} else {
-			merged.MergeMesh(mesh)
+		e.updateJob(job, "slicing", int(float64(i)/float64(len(req.FilePaths))*5), fmt.Sprintf("Repairing %s...", filepath.Base(fp)))
+		report := RepairMesh(mesh)
+		if len(mesh.Triangles) == 0 {
+			log.Printf("Warning: Skipping file %s: no triangles left after repair", filepath.Base(fp))
+			continue
+		}
+		if report.HasIssues() {
+			log.Printf("Mesh repair %s: %+v", filepath.Base(fp), *report)
 		}
+		e.mu.Lock()
+		if job.Repair == nil {
+			job.Repair = &models.MeshRepairReport{}
+		}
+		job.Repair.Add(report)
+		e.mu.Unlock()
 
-		log.Printf("DEBUG: After merge - Bounds: [%.4f,%.4f,%.4f] to [%.4f,%.4f,%.4f], Total triangles: %d",
-			merged.MinBound[0], merged.MinBound[1], merged.MinBound[2],
-			merged.MaxBound[0], merged.MaxBound[1], merged.MaxBound[2],
-			len(merged.Triangles))
+		validFileCount++
+		meshes = append(meshes, mesh)
+		names = append(names, filepath.Base(fp))
+		var t ObjectTransform
+		if i < len(req.Transforms) {
+			t = req.Transforms[i]
+		}
+		if req.Orient != "" {
+			if e.stopIfCancelled(job) {
+				return
+			}
+			e.updateJob(job, "slicing", int(float64(i)/float64(len(req.FilePaths))*5), fmt.Sprintf("Orienting %s...", filepath.Base(fp)))
+			o := OptimizeOrientation(mesh, req.Orient, req.Settings.SupportAngleDeg)
+			log.Printf("Auto-orient %s (%s): X=%.0f Y=%.0f, overhang %.0fmm², height %.1fmm",
+				filepath.Base(fp), req.Orient, o.RotateXDeg, o.RotateYDeg, o.OverhangAreaMM2, o.HeightMM)
+			t.RotateXDeg, t.RotateYDeg = o.RotateXDeg, o.RotateYDeg
+		}
+		transforms = append(transforms, t)
 
 		pct := int(float64(i+1) / float64(len(req.FilePaths)) * 5) // 0-5% for parsing
 		e.updateJob(job, "slicing", pct, fmt.Sprintf("Parsed %d/%d files", validFileCount, len(req.FilePaths)))
 	}
 
 	// Check if any files were successfully parsed
-	if merged == nil {
-		e.setError(job, "No valid STL files could be parsed. Please check the files and try again.")
+	if len(meshes) == 0 {
+		e.setError(job, "No valid mesh files could be parsed. Please check the files and try again.")
+		return
+	}
+
+	if e.stopIfCancelled(job) {
+		return
+	}
+	merged, layout, err := BuildPlate(meshes, names, transforms, req.Profile, req.Arrange)
+	if err != nil {
+		e.setError(job, fmt.Sprintf("Failed to arrange plate: %v", err))
+		return
+	}
+	if len(layout.Objects) > 1 && !layout.Fits() {
+		e.setError(job, "The objects don't fit on the build plate. Reduce copies or scale, or adjust the offsets.")
 		return
 	}
 
+	log.Printf("DEBUG: Plate - Bounds: [%.4f,%.4f,%.4f] to [%.4f,%.4f,%.4f], Objects: %d, Total triangles: %d",
+		merged.MinBound[0], merged.MinBound[1], merged.MinBound[2],
+		merged.MaxBound[0], merged.MaxBound[1], merged.MaxBound[2],
+		len(layout.Objects), len(merged.Triangles))
+
 	if validFileCount < len(req.FilePaths) {
 		log.Printf("Warning: Only %d of %d files were valid and will be sliced", validFileCount, len(req.FilePaths))
 	}
@@ -194,7 +544,7 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 
 	// Validate mesh height is not NaN or Infinite
 	if math.IsNaN(meshHeight) || math.IsInf(meshHeight, 0) {
-		e.setError(job, fmt.Sprintf("Invalid model geometry detected (mesh height is %.2f). The STL file may be corrupted or contain invalid vertex coordinates.", meshHeight))
+		e.setError(job, fmt.Sprintf("Invalid model geometry detected (mesh height is %.2f). The mesh file may be corrupted or contain invalid vertex coordinates.", meshHeight))
 		return
 	}
 
@@ -240,8 +590,27 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 			meshHeight, merged.MinBound[2], merged.MaxBound[2])
 	}
 
+	// Supports lift the model and stand on a raft from the plate up
+	if req.Settings.SupportsEnabled {
+		if e.stopIfCancelled(job) {
+			return
+		}
+		e.updateJob(job, "slicing", 5, "Generating supports...")
+		supports, count := GenerateSupports(merged, req.Settings)
+		merged.MergeMesh(supports)
+		meshHeight = float64(merged.MaxBound[2] - merged.MinBound[2])
+		log.Printf("Supports: %d tips, %d triangles, height now %.2fmm", count, len(supports.Triangles), meshHeight)
+		if meshHeight > limitZ {
+			e.setError(job, fmt.Sprintf("The model with supports is %.1fmm tall and doesn't fit the build height (%.1fmm).", meshHeight, limitZ))
+			return
+		}
+		e.mu.Lock()
+		job.Supports = count
+		e.mu.Unlock()
+	}
+
 	if meshHeight < 0.001 {
-		e.setError(job, fmt.Sprintf("Model has zero or negative height (bounds Z: %.4f to %.4f, %d triangles). Check if the STL file is valid.",
+		e.setError(job, fmt.Sprintf("Model has zero or negative height (bounds Z: %.4f to %.4f, %d triangles). Check if the mesh file is valid.",
 			merged.MinBound[2], merged.MaxBound[2], len(merged.Triangles)))
 		return
 	}
@@ -269,14 +638,10 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 	if fileFormat == "" {
 		fileFormat = req.Profile.FileFormat
 	}
-	isDLP := fileFormat == "dlp"
-	var encodedLayers [][]byte
-	var dlpLayers []*image.Gray
-
-	if isDLP {
-		dlpLayers = make([]*image.Gray, totalLayers)
-	} else {
-		encodedLayers = make([][]byte, totalLayers)
+	format, ok := LookupOutputFormat(fileFormat)
+	if !ok {
+		e.setError(job, fmt.Sprintf("Unsupported output format %q", fileFormat))
+		return
 	}
 
 	aaLevel := req.Settings.AntiAliasing
@@ -298,54 +663,222 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 	offsetX := req.Profile.BuildWidthMM / 2
 	offsetY := req.Profile.BuildDepthMM / 2
 
+	// Overlapping parts of a multi-file plate, and supports sinking into the
+	// model, must be unioned rather than cancelled out: that needs nonzero.
+	fillRule := req.FillRule
+	if fillRule == "" {
+		fillRule = FillEvenOdd
+		if len(layout.Objects) > 1 || req.Settings.SupportsEnabled {
+			fillRule = FillNonZero
+		}
+	}
+
+	// Hollowing needs every layer's neighbourhood, so its cavity is planned
+	// in a pre-pass and carved out of each layer as it is rasterized.
+	sliceStart := 5
+	var hollow *hollowPlan
+	if req.Settings.HollowEnabled {
+		if e.stopIfCancelled(job) {
+			return
+		}
+		sliceStart = 25
+		hollow = planHollowing(merged, req.Profile, req.Settings, totalLayers, offsetX, offsetY, fillRule, req.DrainHoles,
+			func(layer int) bool {
+				if e.stopIfCancelled(job) {
+					return false
+				}
+				e.mu.Lock()
+				job.Progress = 5 + int(float64(layer)/float64(totalLayers)*20) // 5-25%
+				job.Message = fmt.Sprintf("Hollowing layer %d/%d", layer, totalLayers)
+				e.mu.Unlock()
+				return true
+			})
+		if hollow == nil {
+			return
+		}
+		if hollow.skippedHoles > 0 {
+			log.Printf("Hollowing: %d drain holes don't reach a cavity and were skipped", hollow.skippedHoles)
+		}
+	}
+
+	// Open the output file: each layer is written to it as soon as it is
+	// sliced, so memory use doesn't grow with the layer count
+	ext := format.Ext
+	printTimeS := estimateLiftPrintTime(req.Settings, totalLayers)
+	if format.ID == "sl1" || format.ID == "sl1s" {
+		printTimeS = SL1PrintTime(req.Settings, totalLayers)
+	}
+	out, err := e.createOutputFile(ext)
+	if err != nil {
+		e.setError(job, fmt.Sprintf("Failed to create temp file: %v", err))
+		return
+	}
+	written := false
+	defer func() {
+		if !written {
+			out.Close()
+			os.Remove(out.Name())
+		}
+	}()
+	lw, err := newLayerWriter(out, format, req, totalLayers, aaLevel, printTimeS, newPlatePreview(merged, req.Profile), hollow != nil)
+	if err != nil {
+		e.setError(job, fmt.Sprintf("Failed to write .%s file: %v", ext, err))
+		return
+	}
+
+	litPixels := 0.0
+	// Same pixel size the rasterizer and the hollowing plan use
+	pixelMM := req.Profile.PixelSizeUM / 1000.0
+	pixelAreaMM2 := pixelMM * pixelMM
+
 	for i := 0; i < totalLayers; i++ {
+		if e.stopIfCancelled(job) {
+			return
+		}
+
 		// Slice at middle of each layer. After CenterOnPlate, MinBound[2] == 0
 		z := float32(float64(i)*layerHeight + layerHeight/2)
 
-		contours := SliceAtZ(merged, z)
+		contours, openContours := SliceAtZ(merged, z)
+		layerRule := fillRule
+		if d := LayerCompensationMM(req.Settings, i); d != 0 {
+			contours = OffsetContours(contours, d, fillRule)
+			layerRule = FillPositive
+		}
 		SortContoursByArea(contours)
 
 		var layerImg *image.Gray
 		if aaLevel > 1 {
-			layerImg = RasterizeLayerAA(contours, req.Profile, offsetX, offsetY, aaLevel)
+			layerImg = RasterizeLayerAA(contours, req.Profile, offsetX, offsetY, aaLevel, layerRule)
 		} else {
-			layerImg = RasterizeLayer(contours, req.Profile, offsetX, offsetY)
+			layerImg = RasterizeLayer(contours, req.Profile, offsetX, offsetY, layerRule)
+		}
+		if hollow != nil {
+			hollow.Apply(layerImg, i)
 		}
 
-		if isDLP {
-			dlpLayers[i] = layerImg
-		} else {
-			encodedLayers[i] = RLEEncode(layerImg)
+		pixels := exposedPixels(layerImg)
+		litPixels += pixels
+		summary := models.LayerSummary{
+			Layer:   i + 1,
+			ZMM:     float64(i+1) * layerHeight,
+			AreaMM2: pixels * pixelAreaMM2,
+		}
+		islands, bbox := layerIslands(layerImg)
+		summary.Islands = islands
+		if !bbox.Empty() {
+			summary.BBox = &models.LayerBBox{X: bbox.Min.X, Y: bbox.Min.Y, Width: bbox.Dx(), Height: bbox.Dy()}
+		}
+
+		if err := lw.WriteLayer(layerImg); err != nil {
+			e.setError(job, fmt.Sprintf("Failed to write layer %d: %v", i+1, err))
+			return
 		}
 
 		e.mu.Lock()
+		if openContours > 0 {
+			job.OpenContours += openContours
+			if len(job.OpenContourLayers) < maxReportedOpenLayers {
+				job.OpenContourLayers = append(job.OpenContourLayers, i+1)
+			}
+		}
 		job.CurrentLayer = i + 1
-		job.Progress = 5 + int(float64(i+1)/float64(totalLayers)*85) // 5-90%
+		job.Layers = append(job.Layers, summary)
+		job.Progress = sliceStart + int(float64(i+1)/float64(totalLayers)*float64(90-sliceStart)) // up to 90%
 		job.Message = fmt.Sprintf("Slicing layer %d/%d", i+1, totalLayers)
 		e.mu.Unlock()
 	}
 
-	// Step 4: Write output file
-	ext := "photon"
-	if isDLP {
-		ext = "dlp"
+	if hollow != nil {
+		e.mu.Lock()
+		job.Hollowed = true
+		job.ResinSavedML, job.ResinSavedPct = hollow.SavedML()
+		job.DrainHoles = len(hollow.holes)
+		e.mu.Unlock()
 	}
-	e.updateJob(job, "encoding", 92, fmt.Sprintf("Writing .%s file...", ext))
 
-	tmpFile, err := os.CreateTemp("", "slice-*."+ext)
-	if err != nil {
-		e.setError(job, fmt.Sprintf("Failed to create temp file: %v", err))
+	e.updateJob(job, "encoding", 92, fmt.Sprintf("Writing .%s file...", ext))
+	resinML := litPixels * pixelAreaMM2 * layerHeight / 1000
+	if err := lw.Close(resinML); err != nil {
+		e.setError(job, fmt.Sprintf("Failed to write .%s file: %v", ext, err))
+		return
+	}
+	if err := out.Close(); err != nil {
+		e.setError(job, fmt.Sprintf("Failed to write .%s file: %v", ext, err))
 		return
 	}
+	written = true
 
-	if isDLP {
-		if err := WriteDLPFile(tmpFile, req.Profile, req.Settings, dlpLayers); err != nil {
-			tmpFile.Close()
-			os.Remove(tmpFile.Name())
-			e.setError(job, fmt.Sprintf("Failed to write DLP file: %v", err))
-			return
+	if job.OpenContours > 0 {
+		log.Printf("Warning: job %s has %d open contours (first layers: %v)", job.ID, job.OpenContours, job.OpenContourLayers)
+	}
+
+	// Done
+	e.mu.Lock()
+	job.Status = "complete"
+	job.Progress = 100
+	job.Message = "Complete"
+	job.Extension = ext
+	job.OutputPath = out.Name()
+	job.PrintTimeS = printTimeS
+	job.ResinML = resinML
+	job.ResinCost = resinML / 1000 * req.Settings.ResinPricePerL
+	e.mu.Unlock()
+}
+
+// newLayerWriter starts the file of the given format in out, with the
+// previews and the print information known before slicing.
+func newLayerWriter(out *os.File, format OutputFormat, req SliceRequest, totalLayers, aaLevel int, printTimeS float64, preview *platePreview, hollowed bool) (LayerWriter, error) {
+	switch {
+	case format.ID == "dlp":
+		return NewDLPWriter(out, req.Profile, req.Settings, preview.Render(pwsPreviewWidth, pwsPreviewHeight), totalLayers)
+	case format.ID == "sl1" || format.ID == "sl1s":
+		info := SL1Info{
+			JobName:      req.ModelName,
+			PrinterModel: "SL1",
+			PrintTimeS:   printTimeS,
+			Supports:     req.Settings.SupportsEnabled,
+			Hollow:       hollowed,
+		}
+		if format.ID == "sl1s" {
+			info.PrinterModel = "SL1S"
+		}
+		for _, t := range sl1Thumbnails {
+			info.Thumbnails = append(info.Thumbnails, preview.Render(t[0], t[1]))
+		}
+		return NewSL1Writer(out, req.Profile, req.Settings, info, totalLayers)
+	case format.ID == "ctb" || format.ID == "ctb3":
+		info := CTBInfo{
+			Version:      4,
+			MachineName:  req.Profile.Name,
+			AntiAliasing: aaLevel,
+			PrintTimeS:   printTimeS,
+			LargePreview: preview.Render(ctbLargePreviewSize, ctbLargePreviewSize*3/4),
+			SmallPreview: preview.Render(ctbSmallPreviewSize, ctbSmallPreviewSize*5/8),
+		}
+		if format.ID == "ctb3" {
+			info.Version = 3
+		}
+		return NewCTBWriter(out, req.Profile, req.Settings, info, totalLayers)
+	case IsPWSFormat(format.ID):
+		info := PWSInfo{
+			Format:       format.ID,
+			AntiAliasing: aaLevel,
+			PrintTimeS:   printTimeS,
+			Preview:      preview.Render(pwsPreviewWidth, pwsPreviewHeight),
+		}
+		return NewPWSWriter(out, req.Profile, req.Settings, info, totalLayers)
+	case format.ID == "goo":
+		info := GOOInfo{
+			MachineName:  req.Profile.Name,
+			ProfileName:  req.Settings.Name,
+			AntiAliasing: aaLevel,
+			PrintTimeS:   printTimeS,
+			SmallPreview: preview.Render(gooSmallPreviewSize, gooSmallPreviewSize),
+			BigPreview:   preview.Render(gooBigPreviewSize, gooBigPreviewSize),
 		}
-	} else {
+		return NewGOOWriter(out, req.Profile, req.Settings, info, totalLayers)
+	default:
 		header := PhotonHeader{
 			BedXMM:           float32(req.Profile.BuildWidthMM),
 			BedYMM:           float32(req.Profile.BuildDepthMM),
@@ -354,6 +887,7 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 			ExposureS:        float32(req.Settings.ExposureTimeS),
 			BottomExposureS:  float32(req.Settings.BottomExposureS),
 			BottomLayers:     uint32(req.Settings.BottomLayers),
+			TransitionLayers: uint32(max(req.Settings.TransitionLayers, 0)),
 			ResolutionX:      uint32(req.Profile.ResolutionX),
 			ResolutionY:      uint32(req.Profile.ResolutionY),
 			LayerCount:       uint32(totalLayers),
@@ -361,25 +895,45 @@ func (e *Engine) sliceWorker(job *models.SliceJob, req SliceRequest) {
 			LiftSpeedMMPS:    float32(req.Settings.LiftSpeedMMPS),
 			RetractSpeedMMPS: float32(req.Settings.RetractSpeedMMPS),
 			AntiAliasing:     uint32(aaLevel),
+			LargePreview:     preview.Render(ctbLargePreviewSize, ctbLargePreviewSize*3/4),
+			SmallPreview:     preview.Render(ctbSmallPreviewSize, ctbSmallPreviewSize*5/8),
 		}
+		return NewPhotonWriter(out, header)
+	}
+}
 
-		if err := WritePhotonFile(tmpFile, header, encodedLayers); err != nil {
-			tmpFile.Close()
-			os.Remove(tmpFile.Name())
-			e.setError(job, fmt.Sprintf("Failed to write photon file: %v", err))
-			return
+// createOutputFile creates a new output file in the engine's directory.
+func (e *Engine) createOutputFile(ext string) (*os.File, error) {
+	if e.outputDir != "" {
+		if err := os.MkdirAll(e.outputDir, 0o755); err != nil {
+			return nil, fmt.Errorf("create output directory: %w", err)
 		}
 	}
-	tmpFile.Close()
+	return os.CreateTemp(e.outputDir, "slice-*."+ext)
+}
 
-	// Done
-	e.mu.Lock()
-	job.Status = "complete"
-	job.Progress = 100
-	job.Message = "Complete"
-	job.Extension = ext
-	job.OutputPath = tmpFile.Name()
-	e.mu.Unlock()
+// estimateLiftPrintTime adds up, for every layer, the exposure, the
+// light-off delay and wait times, and the time to lift the plate and retract
+// it back in one or two stages.
+func estimateLiftPrintTime(settings *models.PrintSettings, layerCount int) float64 {
+	stage := func(height, speed float64) float64 {
+		if height <= 0 || speed <= 0 {
+			return 0
+		}
+		return height / speed
+	}
+	retract, retract2 := retractHeights(settings)
+	move := stage(settings.LiftHeightMM, settings.LiftSpeedMMPS) +
+		stage(settings.LiftHeight2MM, settings.LiftSpeed2MMPS) +
+		stage(retract, settings.RetractSpeedMMPS) +
+		stage(retract2, settings.RetractSpeed2MMPS)
+	wait := settings.WaitBeforeCureS + settings.WaitAfterCureS + settings.WaitAfterLiftS
+
+	total := float64(layerCount) * (move + wait)
+	for i := range layerCount {
+		total += LayerExposure(settings, i) + LayerLightOffDelay(settings, i)
+	}
+	return total
 }
 
 func (e *Engine) setError(job *models.SliceJob, msg string) {
@@ -0,0 +1,41 @@
+package slicer
+
+// OutputFormat is a printer file format the engine can write.
+type OutputFormat struct {
+	ID    string // value of PrinterProfile.FileFormat and SliceRequest.FileFormat
+	Label string
+	Ext   string // file extension, without the dot
+}
+
+// OutputFormats lists the supported formats; the first one is the default.
+var OutputFormats = []OutputFormat{
+	{ID: "photon", Label: "Anycubic Photon (.photon)", Ext: "photon"},
+	{ID: "dlp", Label: "Generic DLP (.dlp)", Ext: "dlp"},
+	{ID: "sl1", Label: "Prusa SL1 (.sl1)", Ext: "sl1"},
+	{ID: "sl1s", Label: "Prusa SL1S (.sl1s)", Ext: "sl1s"},
+	{ID: "ctb", Label: "Chitubox CTB v4 (.ctb)", Ext: "ctb"},
+	{ID: "ctb3", Label: "Chitubox CTB v3 (.ctb)", Ext: "ctb"},
+	{ID: "pws", Label: "Anycubic Photon S (.pws)", Ext: "pws"},
+	{ID: "pw0", Label: "Anycubic Photon Zero (.pw0)", Ext: "pw0"},
+	{ID: "pwmo", Label: "Anycubic Photon Mono (.pwmo)", Ext: "pwmo"},
+	{ID: "pwma", Label: "Anycubic Photon Mono 4K (.pwma)", Ext: "pwma"},
+	{ID: "pwmx", Label: "Anycubic Photon Mono X (.pwmx)", Ext: "pwmx"},
+	{ID: "px6s", Label: "Anycubic Photon Mono X 6Ks (.px6s)", Ext: "px6s"},
+	{ID: "pm3", Label: "Anycubic Photon M3 (.pm3)", Ext: "pm3"},
+	{ID: "pwmb", Label: "Anycubic Photon M3 Plus (.pwmb)", Ext: "pwmb"},
+	{ID: "pm3m", Label: "Anycubic Photon M3 Max (.pm3m)", Ext: "pm3m"},
+	{ID: "goo", Label: "Elegoo GOO (.goo)", Ext: "goo"},
+}
+
+// LookupOutputFormat finds a format by ID. The empty ID means the default.
+func LookupOutputFormat(id string) (OutputFormat, bool) {
+	if id == "" {
+		return OutputFormats[0], true
+	}
+	for _, f := range OutputFormats {
+		if f.ID == id {
+			return f, true
+		}
+	}
+	return OutputFormat{}, false
+}
@@ -0,0 +1,527 @@
+package slicer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"time"
+
+	"3dmodels/internal/models"
+)
+
+// Elegoo .goo format, big-endian. The header holds the machine and print
+// parameters with a small and a big RGB565 preview embedded in it; every
+// layer is a definition followed by its RLE data and a CRLF delimiter, and
+// the file ends with a fixed footer.
+const (
+	gooVersion          = "V3.0"
+	gooHeaderSize       = 195477
+	gooLayerDefSize     = 70
+	gooSmallPreviewSize = 116
+	gooBigPreviewSize   = 290
+	gooLayerMagic       = 0x55
+	gooResinDensityGML  = 1.1
+)
+
+var (
+	gooMagic     = [8]byte{0x07, 0x00, 0x00, 0x00, 'D', 'L', 'P', 0x00}
+	gooFooter    = []byte{0x00, 0x00, 0x00, 0x07, 0x00, 0x00, 0x00, 'D', 'L', 'P', 0x00}
+	gooDelimiter = [2]byte{0x0d, 0x0a}
+)
+
+// GOOInfo describes the print recorded in a GOO file.
+type GOOInfo struct {
+	MachineName  string
+	ProfileName  string
+	AntiAliasing int
+	PrintTimeS   float64
+	SmallPreview image.Image // 116 x 116
+	BigPreview   image.Image // 290 x 290
+}
+
+type gooHeaderInfo struct {
+	Version         [4]byte
+	Magic           [8]byte
+	SoftwareName    [32]byte
+	SoftwareVersion [24]byte
+	FileCreateTime  [24]byte
+	MachineName     [32]byte
+	MachineType     [32]byte
+	ProfileName     [32]byte
+	AntiAliasing    uint16
+	GreyLevel       uint16
+	BlurLevel       uint16
+}
+
+type gooHeaderParams struct {
+	LayerCount             uint32
+	ResolutionX            uint16
+	ResolutionY            uint16
+	MirrorX                bool
+	MirrorY                bool
+	DisplayWidthMM         float32
+	DisplayHeightMM        float32
+	MachineZMM             float32
+	LayerHeightMM          float32
+	ExposureS              float32
+	DelayMode              bool // false: light-off delay, true: wait times
+	LightOffDelayS         float32
+	BottomWaitAfterCureS   float32
+	BottomWaitAfterLiftS   float32
+	BottomWaitBeforeCureS  float32
+	WaitAfterCureS         float32
+	WaitAfterLiftS         float32
+	WaitBeforeCureS        float32
+	BottomExposureS        float32
+	BottomLayers           uint32
+	BottomLiftHeightMM     float32
+	BottomLiftSpeedMMM     float32 // mm/min
+	LiftHeightMM           float32
+	LiftSpeedMMM           float32
+	BottomRetractHeightMM  float32
+	BottomRetractSpeedMMM  float32
+	RetractHeightMM        float32
+	RetractSpeedMMM        float32
+	BottomLiftHeight2MM    float32
+	BottomLiftSpeed2MMM    float32
+	LiftHeight2MM          float32
+	LiftSpeed2MMM          float32
+	BottomRetractHeight2MM float32
+	BottomRetractSpeed2MMM float32
+	RetractHeight2MM       float32
+	RetractSpeed2MMM       float32
+	BottomLightPWM         uint16
+	LightPWM               uint16
+	PerLayerSettings       bool
+	PrintTimeS             uint32
+	VolumeML               float32
+	WeightG                float32
+	Cost                   float32
+	PriceUnit              [8]byte
+	LayerDefOffset         uint32
+	GrayScaleLevel         uint8 // 0: 8-bit gray values
+	TransitionLayers       uint16
+}
+
+type gooLayerDef struct {
+	Pause            uint16
+	PausePositionZMM float32
+	PositionZMM      float32
+	ExposureS        float32
+	LightOffDelayS   float32
+	WaitAfterCureS   float32
+	WaitAfterLiftS   float32
+	WaitBeforeCureS  float32
+	LiftHeightMM     float32
+	LiftSpeedMMM     float32
+	LiftHeight2MM    float32
+	LiftSpeed2MMM    float32
+	RetractHeightMM  float32
+	RetractSpeedMMM  float32
+	RetractHeight2MM float32
+	RetractSpeed2MMM float32
+	LightPWM         uint16
+	Delimiter        [2]byte
+	DataLength       uint32
+}
+
+// EncodeGOOLayer encodes a layer with the GOO RLE. The data starts with
+// 0x55 and ends with a checksum byte. In each run the top two bits of the
+// first byte give the color: 00 black, 11 white, 01 a gray value in the next
+// byte (10 is a difference from the previous color, only read). The next two
+// bits say how many bytes follow with the rest of the run length, whose top
+// four bits are in the first byte.
+func EncodeGOOLayer(img *image.Gray) []byte {
+	out := []byte{gooLayerMagic}
+	var color byte
+	run := 0
+
+	flush := func() {
+		if run == 0 {
+			return
+		}
+		var kind byte = 0b01
+		switch color {
+		case 0x00:
+			kind = 0b00
+		case 0xff:
+			kind = 0b11
+		}
+		extra := 0
+		switch {
+		case run > 0xfffff:
+			extra = 3
+		case run > 0xfff:
+			extra = 2
+		case run > 0xf:
+			extra = 1
+		}
+		out = append(out, kind<<6|byte(extra)<<4|byte(run>>(8*extra))&0xf)
+		if kind == 0b01 {
+			out = append(out, color)
+		}
+		for k := extra - 1; k >= 0; k-- {
+			out = append(out, byte(run>>(8*k)))
+		}
+	}
+
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for _, v := range img.Pix[y*img.Stride : y*img.Stride+b.Dx()] {
+			if run > 0 && v == color && run < 0xfffffff {
+				run++
+				continue
+			}
+			flush()
+			color, run = v, 1
+		}
+	}
+	flush()
+
+	return append(out, gooChecksum(out[1:]))
+}
+
+func gooChecksum(data []byte) byte {
+	var sum byte
+	for _, b := range data {
+		sum += b
+	}
+	return ^sum
+}
+
+// decodeGOOLayer is the inverse of EncodeGOOLayer.
+func decodeGOOLayer(data []byte, width, height int) (*image.Gray, error) {
+	if len(data) < 2 || data[0] != gooLayerMagic {
+		return nil, fmt.Errorf("bad layer magic")
+	}
+	body := data[1 : len(data)-1]
+	if gooChecksum(body) != data[len(data)-1] {
+		return nil, fmt.Errorf("bad layer checksum")
+	}
+
+	w := newRunWriter(width, height)
+	var prev byte
+	for i := 0; i < len(body); {
+		head := body[i]
+		i++
+		var color byte
+		run := 1
+		switch head >> 6 {
+		case 0b00:
+			color = 0x00
+		case 0b11:
+			color = 0xff
+		case 0b01:
+			if i >= len(body) {
+				return nil, fmt.Errorf("truncated run")
+			}
+			color = body[i]
+			i++
+		case 0b10:
+			diff := head & 0xf
+			if head&0x20 != 0 {
+				color = prev - diff
+			} else {
+				color = prev + diff
+			}
+			if head&0x10 != 0 {
+				if i >= len(body) {
+					return nil, fmt.Errorf("truncated run")
+				}
+				run = int(body[i])
+				i++
+			}
+		}
+		if head>>6 != 0b10 {
+			extra := int(head>>4) & 0x3
+			if i+extra > len(body) {
+				return nil, fmt.Errorf("truncated run")
+			}
+			run = int(head & 0xf)
+			for k := 0; k < extra; k++ {
+				run = run<<8 | int(body[i])
+				i++
+			}
+		}
+		if err := w.put(color, run); err != nil {
+			return nil, err
+		}
+		prev = color
+	}
+	return w.finish()
+}
+
+// gooWaitTimes reports whether the printer should use the wait times rather
+// than the light-off delay between layers.
+func gooWaitTimes(settings *models.PrintSettings) bool {
+	return settings.WaitBeforeCureS > 0 || settings.WaitAfterCureS > 0 || settings.WaitAfterLiftS > 0
+}
+
+// GOOWriter streams a .goo file. Each layer carries its own definition, so
+// only the header totals are patched once the layers are written.
+type GOOWriter struct {
+	w            LayerOutput
+	profile      *models.PrinterProfile
+	settings     *models.PrintSettings
+	params       gooHeaderParams
+	paramsOffset int64
+	layers       layerCounter
+}
+
+// NewGOOWriter writes the header of a .goo file with layerCount layers. The
+// resin volume is filled in by Close.
+func NewGOOWriter(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, info GOOInfo, layerCount int) (*GOOWriter, error) {
+	var buf bytes.Buffer
+	put := func(v any) {
+		binary.Write(&buf, binary.BigEndian, v)
+	}
+
+	var hi gooHeaderInfo
+	copy(hi.Version[:], gooVersion)
+	hi.Magic = gooMagic
+	copy(hi.SoftwareName[:], "3dmodels")
+	copy(hi.SoftwareVersion[:], "1.0")
+	copy(hi.FileCreateTime[:], time.Now().Format("2006-01-02 15:04:05"))
+	copy(hi.MachineName[:], info.MachineName)
+	copy(hi.MachineType[:], "MSLA")
+	copy(hi.ProfileName[:], info.ProfileName)
+	hi.AntiAliasing = uint16(max(info.AntiAliasing, 1))
+	hi.GreyLevel = 1
+	put(&hi)
+
+	for _, p := range []struct {
+		img  image.Image
+		size int
+	}{{info.SmallPreview, gooSmallPreviewSize}, {info.BigPreview, gooBigPreviewSize}} {
+		data := make([]byte, p.size*p.size*2)
+		if p.img != nil {
+			if b := p.img.Bounds(); b.Dx() != p.size || b.Dy() != p.size {
+				return nil, fmt.Errorf("GOO preview must be %dx%d, got %dx%d", p.size, p.size, b.Dx(), b.Dy())
+			}
+			data = encodeRGB565(p.img, binary.BigEndian)
+		}
+		buf.Write(data)
+		buf.Write(gooDelimiter[:])
+	}
+
+	liftSpeed := float32(settings.LiftSpeedMMPS * 60)
+	retractSpeed := float32(settings.RetractSpeedMMPS * 60)
+	liftSpeed2 := float32(settings.LiftSpeed2MMPS * 60)
+	retractSpeed2 := float32(settings.RetractSpeed2MMPS * 60)
+	lift := float32(settings.LiftHeightMM)
+	lift2 := float32(settings.LiftHeight2MM)
+	retract, retract2 := retractHeights(settings)
+	params := gooHeaderParams{
+		LayerCount:             uint32(layerCount),
+		ResolutionX:            uint16(profile.ResolutionX),
+		ResolutionY:            uint16(profile.ResolutionY),
+		DisplayWidthMM:         float32(profile.BuildWidthMM),
+		DisplayHeightMM:        float32(profile.BuildDepthMM),
+		MachineZMM:             float32(profile.BuildHeightMM),
+		LayerHeightMM:          float32(settings.LayerHeightMM),
+		ExposureS:              float32(settings.ExposureTimeS),
+		DelayMode:              gooWaitTimes(settings),
+		LightOffDelayS:         float32(settings.LightOffDelayS),
+		BottomWaitAfterCureS:   float32(settings.WaitAfterCureS),
+		BottomWaitAfterLiftS:   float32(settings.WaitAfterLiftS),
+		BottomWaitBeforeCureS:  float32(settings.WaitBeforeCureS),
+		WaitAfterCureS:         float32(settings.WaitAfterCureS),
+		WaitAfterLiftS:         float32(settings.WaitAfterLiftS),
+		WaitBeforeCureS:        float32(settings.WaitBeforeCureS),
+		BottomExposureS:        float32(settings.BottomExposureS),
+		BottomLayers:           uint32(settings.BottomLayers),
+		BottomLiftHeightMM:     lift,
+		BottomLiftSpeedMMM:     liftSpeed,
+		LiftHeightMM:           lift,
+		LiftSpeedMMM:           liftSpeed,
+		BottomRetractHeightMM:  float32(retract),
+		BottomRetractSpeedMMM:  retractSpeed,
+		RetractHeightMM:        float32(retract),
+		RetractSpeedMMM:        retractSpeed,
+		BottomLiftHeight2MM:    lift2,
+		BottomLiftSpeed2MMM:    liftSpeed2,
+		LiftHeight2MM:          lift2,
+		LiftSpeed2MMM:          liftSpeed2,
+		BottomRetractHeight2MM: float32(retract2),
+		BottomRetractSpeed2MMM: retractSpeed2,
+		RetractHeight2MM:       float32(retract2),
+		RetractSpeed2MMM:       retractSpeed2,
+		BottomLightPWM:         lightPWM(settings.BottomLightPWM),
+		LightPWM:               lightPWM(settings.LightPWM),
+		PerLayerSettings:       true,
+		PrintTimeS:             uint32(info.PrintTimeS),
+		LayerDefOffset:         gooHeaderSize,
+		TransitionLayers:       uint16(settings.TransitionLayers),
+	}
+	copy(params.PriceUnit[:], "$")
+	paramsOffset := int64(buf.Len())
+	put(&params)
+
+	if buf.Len() != gooHeaderSize {
+		return nil, fmt.Errorf("GOO header is %d bytes, want %d", buf.Len(), gooHeaderSize)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+
+	return &GOOWriter{
+		w:            w,
+		profile:      profile,
+		settings:     settings,
+		params:       params,
+		paramsOffset: paramsOffset,
+		layers:       layerCounter{total: layerCount},
+	}, nil
+}
+
+// WriteLayer encodes a layer with EncodeGOOLayer and appends it with its
+// definition.
+func (gw *GOOWriter) WriteLayer(img *image.Gray) error {
+	i, err := gw.layers.take()
+	if err != nil {
+		return err
+	}
+	data := EncodeGOOLayer(img)
+
+	s := gw.settings
+	pwm := gw.params.LightPWM
+	if i < s.BottomLayers {
+		pwm = gw.params.BottomLightPWM
+	}
+	def := gooLayerDef{
+		PausePositionZMM: float32(gw.profile.BuildHeightMM),
+		PositionZMM:      float32(float64(i+1) * s.LayerHeightMM),
+		ExposureS:        float32(LayerExposure(s, i)),
+		LightOffDelayS:   float32(LayerLightOffDelay(s, i)),
+		WaitAfterCureS:   gw.params.WaitAfterCureS,
+		WaitAfterLiftS:   gw.params.WaitAfterLiftS,
+		WaitBeforeCureS:  gw.params.WaitBeforeCureS,
+		LiftHeightMM:     gw.params.LiftHeightMM,
+		LiftSpeedMMM:     gw.params.LiftSpeedMMM,
+		LiftHeight2MM:    gw.params.LiftHeight2MM,
+		LiftSpeed2MMM:    gw.params.LiftSpeed2MMM,
+		RetractHeightMM:  gw.params.RetractHeightMM,
+		RetractSpeedMMM:  gw.params.RetractSpeedMMM,
+		RetractHeight2MM: gw.params.RetractHeight2MM,
+		RetractSpeed2MMM: gw.params.RetractSpeed2MMM,
+		LightPWM:         pwm,
+		Delimiter:        gooDelimiter,
+		DataLength:       uint32(len(data)),
+	}
+	if err := binary.Write(gw.w, binary.BigEndian, &def); err != nil {
+		return fmt.Errorf("write layer definition %d: %w", i, err)
+	}
+	if _, err := gw.w.Write(data); err != nil {
+		return fmt.Errorf("write layer data %d: %w", i, err)
+	}
+	if _, err := gw.w.Write(gooDelimiter[:]); err != nil {
+		return fmt.Errorf("write layer data %d: %w", i, err)
+	}
+	return nil
+}
+
+// Close writes the footer and patches the resin volume and weight into the
+// header.
+func (gw *GOOWriter) Close(volumeML float64) error {
+	if err := gw.layers.check(); err != nil {
+		return err
+	}
+	if _, err := gw.w.Write(gooFooter); err != nil {
+		return err
+	}
+	gw.params.VolumeML = float32(volumeML)
+	gw.params.WeightG = gw.params.VolumeML * gooResinDensityGML
+	if err := writeStructAt(gw.w, binary.BigEndian, &gw.params, gw.paramsOffset); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	return nil
+}
+
+// DecodeGOO reads a .goo file of the given size. Layers are decoded on demand
+// by PrintFile.Layer.
+func DecodeGOO(r io.ReaderAt, size int64) (*PrintFile, error) {
+	if size < gooHeaderSize+int64(len(gooFooter)) {
+		return nil, fmt.Errorf("file too small for a GOO header")
+	}
+	header := make([]byte, gooHeaderSize)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+
+	var hi gooHeaderInfo
+	hr := bytes.NewReader(header)
+	if err := binary.Read(hr, binary.BigEndian, &hi); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if hi.Magic != gooMagic {
+		return nil, fmt.Errorf("not a GOO file")
+	}
+
+	f := &PrintFile{
+		Format:       "goo",
+		Version:      int(hi.Version[1] - '0'),
+		MachineName:  cString(hi.MachineName[:]),
+		AntiAliasing: int(hi.AntiAliasing),
+		r:            r,
+	}
+	for _, size := range []int{gooSmallPreviewSize, gooBigPreviewSize} {
+		data := make([]byte, size*size*2+len(gooDelimiter))
+		if _, err := io.ReadFull(hr, data); err != nil {
+			return nil, fmt.Errorf("read preview: %w", err)
+		}
+		f.Previews = append(f.Previews, decodeRGB565(data, size, size, binary.BigEndian))
+	}
+
+	var p gooHeaderParams
+	if err := binary.Read(hr, binary.BigEndian, &p); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	f.ResolutionX = int(p.ResolutionX)
+	f.ResolutionY = int(p.ResolutionY)
+	f.BedXMM = float64(p.DisplayWidthMM)
+	f.BedYMM = float64(p.DisplayHeightMM)
+	f.BedZMM = float64(p.MachineZMM)
+	f.LayerHeightMM = float64(p.LayerHeightMM)
+	f.ExposureS = float64(p.ExposureS)
+	f.BottomExposureS = float64(p.BottomExposureS)
+	f.BottomLayers = int(p.BottomLayers)
+	f.LiftHeightMM = float64(p.LiftHeightMM + p.LiftHeight2MM)
+	f.LiftSpeedMMPS = float64(p.LiftSpeedMMM) / 60
+	f.RetractSpeedMMPS = float64(p.RetractSpeedMMM) / 60
+	f.PrintTimeS = float64(p.PrintTimeS)
+	f.VolumeML = float64(p.VolumeML)
+	f.LayerCount = int(p.LayerCount)
+
+	// Layers follow each other: walk the definitions to find the data
+	offset := int64(p.LayerDefOffset)
+	for i := 0; i < f.LayerCount; i++ {
+		var def gooLayerDef
+		if err := binary.Read(io.NewSectionReader(r, offset, gooLayerDefSize), binary.BigEndian, &def); err != nil {
+			return nil, fmt.Errorf("read layer definition %d: %w", i, err)
+		}
+		f.layers = append(f.layers, printFileLayer{offset: offset + gooLayerDefSize, length: int(def.DataLength)})
+		offset += gooLayerDefSize + int64(def.DataLength) + int64(len(gooDelimiter))
+		if offset > size {
+			return nil, fmt.Errorf("layer %d data out of bounds", i)
+		}
+	}
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	width, height := f.ResolutionX, f.ResolutionY
+	f.decode = func(data []byte, _ int) (*image.Gray, error) {
+		return decodeGOOLayer(data, width, height)
+	}
+	return f, nil
+}
+
+// cString returns a zero-padded fixed-size string field.
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,233 @@
+package slicer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"testing"
+
+	"3dmodels/internal/models"
+)
+
+// memOutput is an in-memory LayerOutput.
+type memOutput struct {
+	buf []byte
+}
+
+func (m *memOutput) Write(p []byte) (int, error) {
+	m.buf = append(m.buf, p...)
+	return len(p), nil
+}
+
+func (m *memOutput) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(m.buf) {
+		m.buf = append(m.buf, make([]byte, end-len(m.buf))...)
+	}
+	copy(m.buf[off:], p)
+	return len(p), nil
+}
+
+// testLayer is a named synthetic layer bitmap.
+type testLayer struct {
+	name string
+	img  *image.Gray
+}
+
+// testLayers returns layers of the given size covering the cases the RLE
+// encoders special-case: solid black and white, anti-aliased gray edges and
+// runs longer than the longest short length field.
+func testLayers(width, height int) []testLayer {
+	fill := func(f func(x, y int) byte) *image.Gray {
+		img := image.NewGray(image.Rect(0, 0, width, height))
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				img.Pix[y*img.Stride+x] = f(x, y)
+			}
+		}
+		return img
+	}
+	cx, cy, r := float64(width)/2, float64(height)/2, float64(min(width, height))/3
+	return []testLayer{
+		{"black", fill(func(x, y int) byte { return 0 })},
+		{"white", fill(func(x, y int) byte { return 0xff })},
+		{"anti-aliased", fill(func(x, y int) byte {
+			// A disc with a 3 pixel soft edge, and a gray ramp on the first row
+			if y == 0 {
+				return byte(x)
+			}
+			d := math.Hypot(float64(x)+0.5-cx, float64(y)+0.5-cy) - r
+			return byte(math.Round(255 * math.Max(0, math.Min(1, 0.5-d/3))))
+		})},
+		{"long runs", fill(func(x, y int) byte {
+			// Runs that wrap across rows: a white band, a long gray band and
+			// black elsewhere
+			i := y*width + x
+			switch {
+			case i < width*height/4:
+				return 0xff
+			case i < width*height/4+5000:
+				return 0x80
+			}
+			return 0
+		})},
+	}
+}
+
+// testPreviewColor is the 16-bit color of a preview test pattern: 8x8
+// blocks, so run-length encoded previews get runs.
+func testPreviewColor(x, y int) uint16 {
+	return uint16((x/8*31 + y/8*97) * 2654435761 >> 11)
+}
+
+// testPreview returns an image whose colors survive the RGB565 round trip.
+func testPreview(width, height int) *image.RGBA {
+	data := make([]byte, width*height*2)
+	for i := 0; i < width*height; i++ {
+		binary.BigEndian.PutUint16(data[2*i:], testPreviewColor(i%width, i/width))
+	}
+	return decodeRGB565(data, width, height, binary.BigEndian)
+}
+
+func testProfile(width, height int) *models.PrinterProfile {
+	return &models.PrinterProfile{
+		Name:          "Test",
+		BuildWidthMM:  float64(width) * 0.05,
+		BuildDepthMM:  float64(height) * 0.05,
+		BuildHeightMM: 150,
+		ResolutionX:   width,
+		ResolutionY:   height,
+		PixelSizeUM:   50,
+	}
+}
+
+// assertSameGray fails when two layer bitmaps differ in size or any pixel.
+func assertSameGray(t *testing.T, name string, got, want *image.Gray) {
+	t.Helper()
+	if got.Bounds().Size() != want.Bounds().Size() {
+		t.Fatalf("%s: size %v, want %v", name, got.Bounds().Size(), want.Bounds().Size())
+	}
+	w, h := want.Bounds().Dx(), want.Bounds().Dy()
+	for y := 0; y < h; y++ {
+		g := got.Pix[y*got.Stride : y*got.Stride+w]
+		e := want.Pix[y*want.Stride : y*want.Stride+w]
+		if !bytes.Equal(g, e) {
+			for x := range e {
+				if g[x] != e[x] {
+					t.Fatalf("%s: pixel (%d, %d) is %d, want %d", name, x, y, g[x], e[x])
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeGOOLayerRoundTrip(t *testing.T) {
+	for _, size := range []image.Point{{1, 1}, {37, 23}, {256, 64}, {1100, 1000}} {
+		for _, l := range testLayers(size.X, size.Y) {
+			data := EncodeGOOLayer(l.img)
+			got, err := decodeGOOLayer(data, size.X, size.Y)
+			if err != nil {
+				t.Fatalf("%v %s: %v", size, l.name, err)
+			}
+			assertSameGray(t, l.name, got, l.img)
+		}
+	}
+}
+
+func TestEncodeGOOLayerRunLengths(t *testing.T) {
+	// 1100x1000 white is a single run needing all three extra length bytes
+	img := testLayers(1100, 1000)[1].img
+	data := EncodeGOOLayer(img)
+	want := []byte{gooLayerMagic, 0b11<<6 | 3<<4 | 0x0, 0x10, 0xc8, 0xe0}
+	if !bytes.Equal(data[:len(want)], want) || len(data) != len(want)+1 {
+		t.Fatalf("white layer encoded as % x, want % x and a checksum", data, want)
+	}
+}
+
+func TestGOOWriterRoundTrip(t *testing.T) {
+	const width, height = 1100, 1000
+	profile := testProfile(width, height)
+	settings := DefaultPrintSettings(0)
+	settings.BottomLayers = 2
+	settings.LiftHeight2MM = 2
+	settings.LiftSpeed2MMPS = 5
+	settings.AntiAliasing = 4
+	layers := testLayers(width, height)
+	info := GOOInfo{
+		MachineName:  "Saturn Test",
+		ProfileName:  "Test",
+		AntiAliasing: settings.AntiAliasing,
+		PrintTimeS:   1234,
+		SmallPreview: testPreview(gooSmallPreviewSize, gooSmallPreviewSize),
+		BigPreview:   testPreview(gooBigPreviewSize, gooBigPreviewSize),
+	}
+
+	var out memOutput
+	w, err := NewGOOWriter(&out, profile, settings, info, len(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		if err := w.WriteLayer(l.img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(12.5); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(out.buf, gooFooter) {
+		t.Error("file does not end with the GOO footer")
+	}
+
+	f, err := DecodeGOO(bytes.NewReader(out.buf), int64(len(out.buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f32 := func(v float64) float64 { return float64(float32(v)) }
+	for _, c := range []struct {
+		name      string
+		got, want any
+	}{
+		{"Format", f.Format, "goo"},
+		{"Version", f.Version, 3},
+		{"MachineName", f.MachineName, info.MachineName},
+		{"ResolutionX", f.ResolutionX, width},
+		{"ResolutionY", f.ResolutionY, height},
+		{"BedXMM", f.BedXMM, f32(profile.BuildWidthMM)},
+		{"BedYMM", f.BedYMM, f32(profile.BuildDepthMM)},
+		{"BedZMM", f.BedZMM, f32(profile.BuildHeightMM)},
+		{"LayerHeightMM", f.LayerHeightMM, f32(settings.LayerHeightMM)},
+		{"ExposureS", f.ExposureS, f32(settings.ExposureTimeS)},
+		{"BottomExposureS", f.BottomExposureS, f32(settings.BottomExposureS)},
+		{"BottomLayers", f.BottomLayers, settings.BottomLayers},
+		{"LiftHeightMM", f.LiftHeightMM, f32(settings.LiftHeightMM + settings.LiftHeight2MM)},
+		{"LiftSpeedMMPS", f.LiftSpeedMMPS, settings.LiftSpeedMMPS},
+		{"RetractSpeedMMPS", f.RetractSpeedMMPS, settings.RetractSpeedMMPS},
+		{"AntiAliasing", f.AntiAliasing, settings.AntiAliasing},
+		{"PrintTimeS", f.PrintTimeS, info.PrintTimeS},
+		{"VolumeML", f.VolumeML, 12.5},
+		{"LayerCount", f.LayerCount, len(layers)},
+	} {
+		if c.got != c.want {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+
+	if len(f.Previews) != 2 {
+		t.Fatalf("got %d previews, want 2", len(f.Previews))
+	}
+	for i, want := range []*image.RGBA{info.SmallPreview.(*image.RGBA), info.BigPreview.(*image.RGBA)} {
+		got, ok := f.Previews[i].(*image.RGBA)
+		if !ok || got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.Pix) {
+			t.Errorf("preview %d differs from the one written", i)
+		}
+	}
+
+	for i, l := range layers {
+		got, err := f.Layer(i)
+		if err != nil {
+			t.Fatalf("layer %d: %v", i, err)
+		}
+		assertSameGray(t, l.name, got, l.img)
+	}
+}
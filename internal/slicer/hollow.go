@@ -0,0 +1,457 @@
+package slicer
+
+import (
+	"image"
+	"math"
+
+	"3dmodels/internal/models"
+)
+
+const (
+	defaultHollowWallMM = 2.0
+	// hollowCellsPerWall sets the resolution of the cavity grid: the wall
+	// thickness spans about this many grid cells.
+	hollowCellsPerWall = 10
+)
+
+// DrainHole is a user-chosen drain hole position in plate coordinates (mm,
+// origin at the front-left corner, as in PlateObject).
+type DrainHole struct {
+	XMM float64 `json:"x_mm"`
+	YMM float64 `json:"y_mm"`
+}
+
+// cavitySpan is a run of cavity cells [x0, x1) on one row of the grid.
+type cavitySpan struct {
+	row, x0, x1 int32
+}
+
+// plannedHole is a vertical drain hole punched through layers
+// [bottom, top]; top is the first layer where it reaches the cavity.
+type plannedHole struct {
+	px, py      float64 // center in native pixels
+	bottom, top int
+}
+
+// hollowPlan holds the result of the hollowing pre-pass: the cavity of every
+// layer on a coarse grid aligned with the output pixels, and the drain holes.
+// Apply then carves each rasterized layer.
+type hollowPlan struct {
+	cell           int // output pixels per grid cell
+	gx0, gy0       int // grid origin, in cells
+	width, height  int // output resolution
+	pixelMM        float64
+	layerHeightMM  float64
+	infillSpacing  float64 // mm, 0 = no lattice
+	infillWidth    float64 // mm
+	holeRadiusPx   float64
+	cavity         [][]cavitySpan
+	holes          []plannedHole
+	skippedHoles   int // user holes that never reached a cavity
+	removedPx      float64
+	remainingPx    float64
+	latticeColumns []bool
+	latticeRows    []bool
+}
+
+// planHollowing slices the mesh at grid resolution and finds every cell that
+// lies at least the wall thickness away from the outside, in XY and Z. Cells
+// are tracked through a run counter of consecutive solid layers, so only one
+// grid's worth of state is kept while the window of wall/layerHeight layers
+// above and below a layer is checked. Drain holes are placed at the user's
+// points, or at the deepest point of every cavity where it first appears.
+// progress is called after each layer is sliced; when it returns false the
+// planning stops and nil is returned.
+func planHollowing(mesh *Mesh, profile *models.PrinterProfile, settings *models.PrintSettings,
+	totalLayers int, offsetX, offsetY float64, rule FillRule, userHoles []DrainHole,
+	progress func(layer int) bool) *hollowPlan {
+
+	pixelMM := profile.PixelSizeUM / 1000.0
+	wall := settings.HollowWallMM
+	if wall <= 0 {
+		wall = defaultHollowWallMM
+	}
+	cell := int(wall / hollowCellsPerWall / pixelMM)
+	if cell < 1 {
+		cell = 1
+	}
+	cellMM := float64(cell) * pixelMM
+	wallCells := wall / cellMM
+	lag := int(math.Round(wall / settings.LayerHeightMM))
+	if lag < 1 {
+		lag = 1
+	}
+
+	plan := &hollowPlan{
+		cell:          cell,
+		width:         profile.ResolutionX,
+		height:        profile.ResolutionY,
+		pixelMM:       pixelMM,
+		layerHeightMM: settings.LayerHeightMM,
+		cavity:        make([][]cavitySpan, totalLayers),
+	}
+	if settings.InfillSpacingMM > 0 && settings.InfillThicknessMM > 0 {
+		plan.infillSpacing = settings.InfillSpacingMM
+		plan.infillWidth = settings.InfillThicknessMM
+	}
+	if settings.DrainHoleDiameterMM > 0 {
+		plan.holeRadiusPx = settings.DrainHoleDiameterMM / 2 / pixelMM
+	}
+
+	// Restrict the grid to the mesh footprint plus an empty border
+	toPxX := func(x float64) float64 { return (x-offsetX)/pixelMM + float64(plan.width)/2 }
+	toPxY := func(y float64) float64 { return float64(plan.height)/2 - (y-offsetY)/pixelMM }
+	maxCellsX := (plan.width + cell - 1) / cell
+	maxCellsY := (plan.height + cell - 1) / cell
+	clampCell := func(v, hi int) int { return max(0, min(v, hi)) }
+	gx0 := clampCell(int(math.Floor(toPxX(float64(mesh.MinBound[0]))/float64(cell)))-1, maxCellsX)
+	gx1 := clampCell(int(math.Ceil(toPxX(float64(mesh.MaxBound[0]))/float64(cell)))+1, maxCellsX)
+	gy0 := clampCell(int(math.Floor(toPxY(float64(mesh.MaxBound[1]))/float64(cell)))-1, maxCellsY)
+	gy1 := clampCell(int(math.Ceil(toPxY(float64(mesh.MinBound[1]))/float64(cell)))+1, maxCellsY)
+	gw, gh := gx1-gx0, gy1-gy0
+	plan.gx0, plan.gy0 = gx0, gy0
+	if gw <= 0 || gh <= 0 {
+		return plan
+	}
+
+	// A grid profile whose pixel (cx, cy) starts at output pixel
+	// ((gx0+cx)*cell, (gy0+cy)*cell)
+	grid := &models.PrinterProfile{ResolutionX: gw, ResolutionY: gh, PixelSizeUM: cellMM * 1000}
+	gridOffX := offsetX + (float64(gx0)+float64(gw)/2)*cellMM - float64(plan.width)/2*pixelMM
+	gridOffY := offsetY + float64(plan.height)/2*pixelMM - (float64(gy0)+float64(gh)/2)*cellMM
+
+	type pendingHole struct {
+		cx, cy int
+		px, py float64
+	}
+	var pending []pendingHole
+	if plan.holeRadiusPx > 0 {
+		for _, h := range userHoles {
+			px, py := toPxX(h.XMM), toPxY(h.YMM)
+			cx, cy := int(px)/cell-gx0, int(py)/cell-gy0
+			if px < 0 || py < 0 || cx < 0 || cy < 0 || cx >= gw || cy >= gh {
+				plan.skippedHoles++
+				continue
+			}
+			pending = append(pending, pendingHole{cx, cy, px, py})
+		}
+	}
+	autoHoles := plan.holeRadiusPx > 0 && len(userHoles) == 0
+
+	runs := make([]uint16, gw*gh)
+	dist := make([]float64, gw*gh)
+	cavity := make([]bool, gw*gh)
+	prevCavity := make([]bool, gw*gh)
+	seen := make([]bool, gw*gh)
+	var component []int
+	edt := newEDT(max(gw, gh))
+
+	for j := 0; j < totalLayers+lag; j++ {
+		if j < totalLayers {
+			z := float32(float64(j)*settings.LayerHeightMM + settings.LayerHeightMM/2)
+			contours, _ := SliceAtZ(mesh, z)
+			img := RasterizeLayer(contours, grid, gridOffX, gridOffY, rule)
+			for c, v := range img.Pix[:gw*gh] {
+				if v == 0 {
+					runs[c] = 0
+				} else if runs[c] < math.MaxUint16 {
+					runs[c]++
+				}
+			}
+			if progress != nil && !progress(j+1) {
+				return nil
+			}
+		} else {
+			// Above the top of the mesh everything is outside
+			clear(runs)
+		}
+
+		i := j - lag
+		if i < 0 {
+			continue
+		}
+
+		// A cell is solid across the whole window if its run reaches back
+		// lag layers below i; then erode that column mask in XY. The grid
+		// border counts as outside even where the mesh reaches the plate edge.
+		for c, r := range runs {
+			cx, cy := c%gw, c/gw
+			border := cx == 0 || cy == 0 || cx == gw-1 || cy == gh-1
+			if !border && int(r) >= 2*lag+1 {
+				dist[c] = math.Inf(1)
+			} else {
+				dist[c] = 0
+			}
+		}
+		edt.transform(dist, gw, gh)
+
+		prevCavity, cavity = cavity, prevCavity
+		r2 := wallCells * wallCells
+		var spans []cavitySpan
+		for cy := 0; cy < gh; cy++ {
+			start := -1
+			for cx := 0; cx <= gw; cx++ {
+				in := cx < gw && dist[cy*gw+cx] > r2
+				if cx < gw {
+					cavity[cy*gw+cx] = in
+				}
+				if in && start < 0 {
+					start = cx
+				} else if !in && start >= 0 {
+					spans = append(spans, cavitySpan{int32(cy), int32(start), int32(cx)})
+					start = -1
+				}
+			}
+		}
+		plan.cavity[i] = spans
+		if len(spans) == 0 {
+			continue
+		}
+
+		// The floor under a cavity cell is the solid run below it
+		floorBottom := func(c int) int { return j - int(runs[c]) + 1 }
+
+		kept := pending[:0]
+		for _, h := range pending {
+			c := h.cy*gw + h.cx
+			if cavity[c] {
+				plan.holes = append(plan.holes, plannedHole{px: h.px, py: h.py, bottom: floorBottom(c), top: i})
+			} else {
+				kept = append(kept, h)
+			}
+		}
+		pending = kept
+
+		if !autoHoles {
+			continue
+		}
+		// Every cavity region that doesn't continue one from the layer below
+		// gets a hole at its deepest point.
+		clear(seen)
+		for _, s := range spans {
+			for cx := s.x0; cx < s.x1; cx++ {
+				start := int(s.row)*gw + int(cx)
+				if seen[start] {
+					continue
+				}
+				component = floodCavity(cavity, gw, gh, start, seen, component[:0])
+				isNew, deepest := true, start
+				for _, c := range component {
+					if prevCavity[c] {
+						isNew = false
+						break
+					}
+					if dist[c] > dist[deepest] {
+						deepest = c
+					}
+				}
+				if !isNew {
+					continue
+				}
+				cx, cy := deepest%gw, deepest/gw
+				plan.holes = append(plan.holes, plannedHole{
+					px:     (float64(gx0+cx) + 0.5) * float64(cell),
+					py:     (float64(gy0+cy) + 0.5) * float64(cell),
+					bottom: floorBottom(deepest),
+					top:    i,
+				})
+			}
+		}
+	}
+	plan.skippedHoles += len(pending)
+
+	if plan.infillSpacing > 0 {
+		plan.latticeColumns = make([]bool, plan.width)
+		for x := range plan.latticeColumns {
+			plan.latticeColumns[x] = plan.onLattice(float64(x) * pixelMM)
+		}
+		plan.latticeRows = make([]bool, plan.height)
+		for y := range plan.latticeRows {
+			plan.latticeRows[y] = plan.onLattice(float64(y) * pixelMM)
+		}
+	}
+	return plan
+}
+
+// floodCavity collects the 4-connected cavity cells reachable from start.
+func floodCavity(cavity []bool, gw, gh, start int, seen []bool, out []int) []int {
+	stack := []int{start}
+	seen[start] = true
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		out = append(out, c)
+		cx, cy := c%gw, c/gw
+		for _, n := range [4][2]int{{cx - 1, cy}, {cx + 1, cy}, {cx, cy - 1}, {cx, cy + 1}} {
+			if n[0] < 0 || n[1] < 0 || n[0] >= gw || n[1] >= gh {
+				continue
+			}
+			k := n[1]*gw + n[0]
+			if cavity[k] && !seen[k] {
+				seen[k] = true
+				stack = append(stack, k)
+			}
+		}
+	}
+	return out
+}
+
+// onLattice reports whether a coordinate falls on a lattice bar.
+func (p *hollowPlan) onLattice(mm float64) bool {
+	return math.Mod(mm, p.infillSpacing) < p.infillWidth
+}
+
+// Apply carves the cavity and drain holes out of a rasterized layer. Inside
+// the cavity the infill lattice (bars along X, Y and Z) is left solid.
+func (p *hollowPlan) Apply(img *image.Gray, layer int) {
+	if layer < 0 || layer >= len(p.cavity) {
+		return
+	}
+
+	onZ := p.infillSpacing > 0 && p.onLattice(float64(layer)*p.layerHeightMM)
+	for _, s := range p.cavity[layer] {
+		y0 := (p.gy0 + int(s.row)) * p.cell
+		x0 := (p.gx0 + int(s.x0)) * p.cell
+		y1 := min(y0+p.cell, p.height)
+		x1 := min((p.gx0+int(s.x1))*p.cell, p.width)
+		for y := y0; y < y1; y++ {
+			row := img.Pix[y*img.Stride : y*img.Stride+p.width]
+			for x := x0; x < x1; x++ {
+				if row[x] == 0 {
+					continue
+				}
+				if p.infillSpacing > 0 {
+					bars := 0
+					if p.latticeColumns[x] {
+						bars++
+					}
+					if p.latticeRows[y] {
+						bars++
+					}
+					if onZ {
+						bars++
+					}
+					if bars >= 2 {
+						continue
+					}
+				}
+				p.removedPx += float64(row[x]) / 255
+				row[x] = 0
+			}
+		}
+	}
+
+	for _, h := range p.holes {
+		if layer < h.bottom || layer > h.top {
+			continue
+		}
+		r := p.holeRadiusPx
+		for y := max(0, int(h.py-r)); y <= min(p.height-1, int(h.py+r)); y++ {
+			dy := float64(y) + 0.5 - h.py
+			for x := max(0, int(h.px-r)); x <= min(p.width-1, int(h.px+r)); x++ {
+				dx := float64(x) + 0.5 - h.px
+				if dx*dx+dy*dy > r*r {
+					continue
+				}
+				i := y*img.Stride + x
+				p.removedPx += float64(img.Pix[i]) / 255
+				img.Pix[i] = 0
+			}
+		}
+	}
+
+	for y := 0; y < p.height; y++ {
+		for _, v := range img.Pix[y*img.Stride : y*img.Stride+p.width] {
+			p.remainingPx += float64(v) / 255
+		}
+	}
+}
+
+// SavedML returns the resin removed so far, in milliliters, and the share of
+// the solid volume it represents.
+func (p *hollowPlan) SavedML() (ml, pct float64) {
+	voxelMM3 := p.pixelMM * p.pixelMM * p.layerHeightMM
+	ml = p.removedPx * voxelMM3 / 1000
+	if total := p.removedPx + p.remainingPx; total > 0 {
+		pct = p.removedPx / total * 100
+	}
+	return ml, pct
+}
+
+// edt computes squared Euclidean distance transforms with the
+// Felzenszwalb-Huttenlocher algorithm, reusing its buffers between calls.
+type edt struct {
+	f, d, z []float64
+	v       []int
+}
+
+func newEDT(n int) *edt {
+	return &edt{
+		f: make([]float64, n),
+		d: make([]float64, n),
+		z: make([]float64, n+1),
+		v: make([]int, n),
+	}
+}
+
+// transform replaces every value of grid (0 for background, +Inf for
+// foreground) with the squared distance to the nearest background cell.
+func (e *edt) transform(grid []float64, w, h int) {
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			e.f[y] = grid[y*w+x]
+		}
+		e.pass(h)
+		for y := 0; y < h; y++ {
+			grid[y*w+x] = e.d[y]
+		}
+	}
+	for y := 0; y < h; y++ {
+		copy(e.f[:w], grid[y*w:(y+1)*w])
+		e.pass(w)
+		copy(grid[y*w:(y+1)*w], e.d[:w])
+	}
+}
+
+func (e *edt) pass(n int) {
+	f, d, z, v := e.f, e.d, e.z, e.v
+	k := -1
+	for q := 0; q < n; q++ {
+		if math.IsInf(f[q], 1) {
+			continue
+		}
+		fq := f[q] + float64(q*q)
+		for k >= 0 {
+			s := (fq - (f[v[k]] + float64(v[k]*v[k]))) / float64(2*(q-v[k]))
+			if s > z[k] {
+				k++
+				v[k] = q
+				z[k] = s
+				z[k+1] = math.Inf(1)
+				break
+			}
+			k--
+		}
+		if k < 0 {
+			k = 0
+			v[0] = q
+			z[0] = math.Inf(-1)
+			z[1] = math.Inf(1)
+		}
+	}
+	if k < 0 {
+		// No background on this line
+		for q := 0; q < n; q++ {
+			d[q] = math.Inf(1)
+		}
+		return
+	}
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		dq := float64(q - v[k])
+		d[q] = dq*dq + f[v[k]]
+	}
+}
@@ -0,0 +1,92 @@
+package slicer
+
+import (
+	"image"
+)
+
+// layerRun is a horizontal run of lit pixels [x0, x1) with its island label.
+type layerRun struct {
+	x0, x1 int
+	label  int
+}
+
+// layerIslands counts the separate lit areas of a layer, with pixels that
+// touch diagonally joined as resin cures, and returns the bounding box of
+// all lit pixels (empty for an empty layer).
+func layerIslands(img *image.Gray) (int, image.Rectangle) {
+	b := img.Bounds()
+	var parent []int
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	var bbox image.Rectangle
+	var prev, cur []layerRun
+	for y := 0; y < b.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+b.Dx()]
+		cur = cur[:0]
+		for x := 0; x < len(row); {
+			if row[x] < 128 {
+				x++
+				continue
+			}
+			x0 := x
+			for x < len(row) && row[x] >= 128 {
+				x++
+			}
+			run := layerRun{x0: x0, x1: x, label: -1}
+			// Runs of the previous row that overlap or touch at a corner
+			for _, p := range prev {
+				if p.x0 > x || p.x1 < x0 {
+					continue
+				}
+				if run.label < 0 {
+					run.label = find(p.label)
+				} else if r := find(p.label); r != run.label {
+					parent[r] = run.label
+				}
+			}
+			if run.label < 0 {
+				run.label = len(parent)
+				parent = append(parent, run.label)
+			}
+			cur = append(cur, run)
+			bbox = bbox.Union(image.Rect(x0, y, x, y+1))
+		}
+		prev, cur = cur, prev
+	}
+
+	islands := 0
+	for i := range parent {
+		if find(i) == i {
+			islands++
+		}
+	}
+	return islands, bbox.Add(b.Min)
+}
+
+// ShrinkLayer scales a layer down to at most maxWidth pixels wide, keeping
+// the brightest pixel of every block so thin features stay visible.
+func ShrinkLayer(img *image.Gray, maxWidth int) *image.Gray {
+	b := img.Bounds()
+	if maxWidth <= 0 || b.Dx() <= maxWidth {
+		return img
+	}
+	f := (b.Dx() + maxWidth - 1) / maxWidth
+	w, h := (b.Dx()+f-1)/f, (b.Dy()+f-1)/f
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < b.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+b.Dx()]
+		dst := out.Pix[(y/f)*out.Stride:]
+		for x, v := range row {
+			if v > dst[x/f] {
+				dst[x/f] = v
+			}
+		}
+	}
+	return out
+}
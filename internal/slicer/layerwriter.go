@@ -0,0 +1,75 @@
+package slicer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+)
+
+// LayerWriter writes a print file one layer at a time, straight into its
+// output, so only the layer being encoded is held in memory. The header and
+// an empty layer table are written when the writer is created; each layer
+// fills in its table entry, and Close patches the header fields that are
+// only known once every layer has been written.
+type LayerWriter interface {
+	// WriteLayer encodes and appends the next layer.
+	WriteLayer(img *image.Gray) error
+	// Close completes the file. volumeML is the resin used by the print.
+	Close(volumeML float64) error
+}
+
+// LayerOutput is where a LayerWriter puts a file: layers are appended with
+// Write, and the space reserved for tables is filled in with WriteAt. An
+// *os.File not opened for appending satisfies it.
+type LayerOutput interface {
+	io.Writer
+	io.WriterAt
+}
+
+// layerCounter keeps track of the layers a writer has been given.
+type layerCounter struct {
+	next  int
+	total int
+}
+
+func (c *layerCounter) take() (int, error) {
+	if c.next >= c.total {
+		return 0, fmt.Errorf("more than %d layers written", c.total)
+	}
+	c.next++
+	return c.next - 1, nil
+}
+
+func (c *layerCounter) check() error {
+	if c.next != c.total {
+		return fmt.Errorf("%d of %d layers written", c.next, c.total)
+	}
+	return nil
+}
+
+// zeroBlock is the source of the zeros that reserve a table.
+var zeroBlock [4096]byte
+
+// writeZeros writes n zero bytes, reserving space patched later.
+func writeZeros(w io.Writer, n int64) error {
+	for n > 0 {
+		chunk := min(int(n), len(zeroBlock))
+		if _, err := w.Write(zeroBlock[:chunk]); err != nil {
+			return err
+		}
+		n -= int64(chunk)
+	}
+	return nil
+}
+
+// writeStructAt encodes v with binary.Write and writes it at off.
+func writeStructAt(w io.WriterAt, order binary.ByteOrder, v any, off int64) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, order, v); err != nil {
+		return err
+	}
+	_, err := w.WriteAt(buf.Bytes(), off)
+	return err
+}
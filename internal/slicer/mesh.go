@@ -0,0 +1,148 @@
+package slicer
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+)
+
+// meshParsers maps a lowercase file extension to the parser that reads it.
+var meshParsers = map[string]func(string) (*Mesh, error){
+	".stl": ParseSTL,
+	".obj": ParseOBJ,
+	".3mf": Parse3MF,
+}
+
+// IsSliceableExt reports whether files with the given extension can be
+// parsed into a Mesh and sliced.
+func IsSliceableExt(ext string) bool {
+	_, ok := meshParsers[strings.ToLower(ext)]
+	return ok
+}
+
+// ParseMesh reads a mesh file, picking the parser from its extension.
+func ParseMesh(filePath string) (*Mesh, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	parse, ok := meshParsers[ext]
+	if !ok {
+		return nil, fmt.Errorf("unsupported mesh format %q", ext)
+	}
+	return parse(filePath)
+}
+
+func newEmptyMesh() *Mesh {
+	return &Mesh{
+		MinBound: [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32},
+		MaxBound: [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32},
+	}
+}
+
+// addTriangle appends a triangle built from three vertices, computing its
+// normal from the winding and updating the bounds. Triangles with invalid
+// coordinates are rejected.
+func (m *Mesh) addTriangle(a, b, c [3]float32) bool {
+	for _, v := range [][3]float32{a, b, c} {
+		if !isValidFloat(v[0]) || !isValidFloat(v[1]) || !isValidFloat(v[2]) ||
+			math.Abs(float64(v[0])) > 100000 || math.Abs(float64(v[1])) > 100000 || math.Abs(float64(v[2])) > 100000 {
+			return false
+		}
+	}
+	tri := Triangle{Normal: faceNormal(a, b, c), V1: a, V2: b, V3: c}
+	updateBounds(m, a[0], a[1], a[2])
+	updateBounds(m, b[0], b[1], b[2])
+	updateBounds(m, c[0], c[1], c[2])
+	m.Triangles = append(m.Triangles, tri)
+	return true
+}
+
+// faceNormal returns the unit normal of a counter-clockwise triangle, or the
+// zero vector for degenerate triangles.
+func faceNormal(a, b, c [3]float32) [3]float32 {
+	ux, uy, uz := float64(b[0]-a[0]), float64(b[1]-a[1]), float64(b[2]-a[2])
+	vx, vy, vz := float64(c[0]-a[0]), float64(c[1]-a[1]), float64(c[2]-a[2])
+	nx := uy*vz - uz*vy
+	ny := uz*vx - ux*vz
+	nz := ux*vy - uy*vx
+	l := math.Sqrt(nx*nx + ny*ny + nz*nz)
+	if l == 0 {
+		return [3]float32{}
+	}
+	return [3]float32{float32(nx / l), float32(ny / l), float32(nz / l)}
+}
+
+// Clone returns a deep copy of the mesh.
+func (m *Mesh) Clone() *Mesh {
+	c := &Mesh{MinBound: m.MinBound, MaxBound: m.MaxBound}
+	c.Triangles = append([]Triangle(nil), m.Triangles...)
+	return c
+}
+
+// Translate shifts all vertices and bounds by the given offset.
+func (m *Mesh) Translate(dx, dy, dz float32) {
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		for _, v := range []*[3]float32{&t.V1, &t.V2, &t.V3} {
+			v[0] += dx
+			v[1] += dy
+			v[2] += dz
+		}
+	}
+	m.MinBound[0] += dx
+	m.MaxBound[0] += dx
+	m.MinBound[1] += dy
+	m.MaxBound[1] += dy
+	m.MinBound[2] += dz
+	m.MaxBound[2] += dz
+}
+
+// Rotate rotates the mesh around its bounding box center, applying the X, Y
+// and Z rotations (in degrees) in that order, and recomputes the bounds.
+func (m *Mesh) Rotate(xDeg, yDeg, zDeg float64) {
+	if xDeg == 0 && yDeg == 0 && zDeg == 0 {
+		return
+	}
+	r := rotationMatrix(xDeg, yDeg, zDeg)
+	var c [3]float64
+	for k := 0; k < 3; k++ {
+		c[k] = (float64(m.MinBound[k]) + float64(m.MaxBound[k])) / 2
+	}
+
+	rotate := func(v *[3]float32) {
+		x, y, z := float64(v[0])-c[0], float64(v[1])-c[1], float64(v[2])-c[2]
+		v[0] = float32(r[0][0]*x + r[0][1]*y + r[0][2]*z + c[0])
+		v[1] = float32(r[1][0]*x + r[1][1]*y + r[1][2]*z + c[1])
+		v[2] = float32(r[2][0]*x + r[2][1]*y + r[2][2]*z + c[2])
+	}
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		rotate(&t.V1)
+		rotate(&t.V2)
+		rotate(&t.V3)
+		t.Normal = faceNormal(t.V1, t.V2, t.V3)
+	}
+	m.recomputeBounds()
+}
+
+// rotationMatrix returns Rz * Ry * Rx for angles in degrees.
+func rotationMatrix(xDeg, yDeg, zDeg float64) [3][3]float64 {
+	sx, cx := math.Sincos(xDeg * math.Pi / 180)
+	sy, cy := math.Sincos(yDeg * math.Pi / 180)
+	sz, cz := math.Sincos(zDeg * math.Pi / 180)
+	return [3][3]float64{
+		{cz * cy, cz*sy*sx - sz*cx, cz*sy*cx + sz*sx},
+		{sz * cy, sz*sy*sx + cz*cx, sz*sy*cx - cz*sx},
+		{-sy, cy * sx, cy * cx},
+	}
+}
+
+func (m *Mesh) recomputeBounds() {
+	m.MinBound = [3]float32{math.MaxFloat32, math.MaxFloat32, math.MaxFloat32}
+	m.MaxBound = [3]float32{-math.MaxFloat32, -math.MaxFloat32, -math.MaxFloat32}
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		updateBounds(m, t.V1[0], t.V1[1], t.V1[2])
+		updateBounds(m, t.V2[0], t.V2[1], t.V2[2])
+		updateBounds(m, t.V3[0], t.V3[1], t.V3[2])
+	}
+}
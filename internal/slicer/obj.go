@@ -0,0 +1,115 @@
+package slicer
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ParseOBJ reads a Wavefront .obj file. Only vertex positions and faces are
+// used; polygons with more than three vertices are fan-triangulated.
+func ParseOBJ(filePath string) (*Mesh, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open OBJ: %w", err)
+	}
+	defer f.Close()
+
+	mesh := newEmptyMesh()
+	var vertices [][3]float32
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024)
+
+	lineCount := 0
+	invalidFaces := 0
+
+	for scanner.Scan() {
+		lineCount++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return nil, fmt.Errorf("line %d: vertex needs 3 coordinates", lineCount)
+			}
+			var v [3]float32
+			for i := 0; i < 3; i++ {
+				c, err := strconv.ParseFloat(fields[i+1], 32)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid vertex coordinate %q", lineCount, fields[i+1])
+				}
+				v[i] = float32(c)
+			}
+			vertices = append(vertices, v)
+
+		case "f":
+			if len(fields) < 4 {
+				invalidFaces++
+				continue
+			}
+			idx := make([]int, 0, len(fields)-1)
+			valid := true
+			for _, ref := range fields[1:] {
+				i, err := objVertexIndex(ref, len(vertices))
+				if err != nil {
+					valid = false
+					break
+				}
+				idx = append(idx, i)
+			}
+			if !valid {
+				invalidFaces++
+				continue
+			}
+			// Fan triangulation around the first vertex
+			for k := 1; k+1 < len(idx); k++ {
+				if !mesh.addTriangle(vertices[idx[0]], vertices[idx[k]], vertices[idx[k+1]]) {
+					invalidFaces++
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read OBJ: %w", err)
+	}
+
+	if len(mesh.Triangles) == 0 {
+		return nil, fmt.Errorf("no valid triangles found in OBJ file")
+	}
+
+	if invalidFaces > 0 {
+		log.Printf("Warning: Repaired OBJ by removing %d invalid faces (kept %d triangles)", invalidFaces, len(mesh.Triangles))
+	}
+
+	return mesh, nil
+}
+
+// objVertexIndex resolves a face vertex reference ("7", "7/1", "7//3", "-1")
+// to a zero-based index into the vertices read so far.
+func objVertexIndex(ref string, count int) (int, error) {
+	if slash := strings.IndexByte(ref, '/'); slash >= 0 {
+		ref = ref[:slash]
+	}
+	i, err := strconv.Atoi(ref)
+	if err != nil {
+		return 0, fmt.Errorf("invalid vertex reference %q", ref)
+	}
+	if i < 0 {
+		// Negative indices are relative to the end of the vertex list
+		i = count + i
+	} else {
+		i--
+	}
+	if i < 0 || i >= count {
+		return 0, fmt.Errorf("vertex reference %q out of range", ref)
+	}
+	return i, nil
+}
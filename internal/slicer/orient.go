@@ -0,0 +1,192 @@
+package slicer
+
+import (
+	"math"
+)
+
+// OrientGoal selects what the orientation optimizer minimizes.
+type OrientGoal string
+
+const (
+	// OrientSupports minimizes the overhanging area that needs supports.
+	OrientSupports OrientGoal = "supports"
+	// OrientPeel minimizes the largest cross-section, which drives the
+	// peel force when the layer separates from the vat film.
+	OrientPeel OrientGoal = "peel"
+	// OrientHeight minimizes the print height, and so the print time.
+	OrientHeight OrientGoal = "height"
+)
+
+const (
+	orientCoarseStepDeg = 30
+	orientFineStepDeg   = 10
+	orientSectionBins   = 48 // cross-sections sampled for the peel goal
+)
+
+// ParseOrientGoal validates a goal from a form value.
+func ParseOrientGoal(s string) (OrientGoal, bool) {
+	switch g := OrientGoal(s); g {
+	case OrientSupports, OrientPeel, OrientHeight:
+		return g, true
+	}
+	return "", false
+}
+
+// Orientation is a candidate rotation and how it scores. The rotation is
+// applied about X then Y, as in ObjectTransform.
+type Orientation struct {
+	RotateXDeg      float64
+	RotateYDeg      float64
+	OverhangAreaMM2 float64
+	MaxSectionMM2   float64 // only computed for OrientPeel
+	HeightMM        float64
+}
+
+// OptimizeOrientation searches rotations about X and Y on a coarse grid,
+// refines around the best one and returns it. Rotations about Z don't change
+// any of the goals and are left to the caller. Faces flatter than
+// overhangAngleDeg from horizontal count as overhangs.
+func OptimizeOrientation(m *Mesh, goal OrientGoal, overhangAngleDeg float64) Orientation {
+	if overhangAngleDeg <= 0 || overhangAngleDeg >= 90 {
+		overhangAngleDeg = 45
+	}
+	ev := &orientEvaluator{
+		mesh:    m,
+		goal:    goal,
+		minDown: math.Cos(overhangAngleDeg * math.Pi / 180),
+		buf:     make([]Triangle, len(m.Triangles)),
+		areas:   make([]float64, len(m.Triangles)),
+	}
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		ev.areas[i] = triangleArea(t.V1, t.V2, t.V3)
+	}
+
+	// The current orientation comes first so it wins ties
+	best := ev.evaluate(0, 0)
+	bestScore := ev.score(best)
+	try := func(x, y float64) {
+		o := ev.evaluate(x, y)
+		if s := ev.score(o); s < bestScore-1e-9 {
+			best, bestScore = o, s
+		}
+	}
+
+	for x := 0.0; x < 360; x += orientCoarseStepDeg {
+		for y := -90.0; y <= 90; y += orientCoarseStepDeg {
+			try(x, y)
+		}
+	}
+	cx, cy := best.RotateXDeg, best.RotateYDeg
+	for dx := -2 * orientFineStepDeg; dx <= 2*orientFineStepDeg; dx += orientFineStepDeg {
+		for dy := -2 * orientFineStepDeg; dy <= 2*orientFineStepDeg; dy += orientFineStepDeg {
+			if dx == 0 && dy == 0 {
+				continue
+			}
+			try(cx+float64(dx), math.Max(-90, math.Min(90, cy+float64(dy))))
+		}
+	}
+
+	best.RotateXDeg = normalizeDeg(best.RotateXDeg)
+	return best
+}
+
+type orientEvaluator struct {
+	mesh    *Mesh
+	goal    OrientGoal
+	minDown float64
+	buf     []Triangle
+	areas   []float64
+}
+
+// score ranks an orientation for the goal; the secondary terms only break ties.
+func (ev *orientEvaluator) score(o Orientation) float64 {
+	switch ev.goal {
+	case OrientHeight:
+		return o.HeightMM + 1e-6*o.OverhangAreaMM2
+	case OrientPeel:
+		return o.MaxSectionMM2 + 1e-3*o.HeightMM
+	default:
+		return o.OverhangAreaMM2 + 1e-3*o.HeightMM
+	}
+}
+
+func (ev *orientEvaluator) evaluate(xDeg, yDeg float64) Orientation {
+	r := rotationMatrix(xDeg, yDeg, 0)
+	rot := func(v [3]float32) [3]float32 {
+		x, y, z := float64(v[0]), float64(v[1]), float64(v[2])
+		return [3]float32{
+			float32(r[0][0]*x + r[0][1]*y + r[0][2]*z),
+			float32(r[1][0]*x + r[1][1]*y + r[1][2]*z),
+			float32(r[2][0]*x + r[2][1]*y + r[2][2]*z),
+		}
+	}
+
+	o := Orientation{RotateXDeg: xDeg, RotateYDeg: yDeg}
+	minZ, maxZ := math.Inf(1), math.Inf(-1)
+	for i := range ev.mesh.Triangles {
+		src := &ev.mesh.Triangles[i]
+		t := &ev.buf[i]
+		t.V1, t.V2, t.V3 = rot(src.V1), rot(src.V2), rot(src.V3)
+		for _, v := range [][3]float32{t.V1, t.V2, t.V3} {
+			minZ = math.Min(minZ, float64(v[2]))
+			maxZ = math.Max(maxZ, float64(v[2]))
+		}
+		n := faceNormal(t.V1, t.V2, t.V3)
+		if float64(-n[2]) >= ev.minDown {
+			o.OverhangAreaMM2 += ev.areas[i]
+		}
+	}
+	o.HeightMM = maxZ - minZ
+
+	if ev.goal == OrientPeel && o.HeightMM > 0 {
+		o.MaxSectionMM2 = ev.maxSection(minZ, o.HeightMM)
+	}
+	return o
+}
+
+// maxSection returns the largest cross-section area over evenly spaced
+// heights. Each triangle only visits the planes it spans, and the area comes
+// from the shoelace terms of the oriented slice segments.
+func (ev *orientEvaluator) maxSection(minZ, height float64) float64 {
+	var sections [orientSectionBins]float64
+	step := height / orientSectionBins
+	for i := range ev.buf {
+		t := &ev.buf[i]
+		lo := math.Min(float64(t.V1[2]), math.Min(float64(t.V2[2]), float64(t.V3[2])))
+		hi := math.Max(float64(t.V1[2]), math.Max(float64(t.V2[2]), float64(t.V3[2])))
+		first := int(math.Ceil((lo-minZ)/step - 0.5))
+		last := int(math.Floor((hi-minZ)/step - 0.5))
+		for k := max(first, 0); k <= last && k < orientSectionBins; k++ {
+			z := float32(minZ + (float64(k)+0.5)*step)
+			if p1, p2, ok := intersectTrianglePlane(t, z); ok {
+				sections[k] += (p1.X*p2.Y - p2.X*p1.Y) / 2
+			}
+		}
+	}
+	best := 0.0
+	for _, a := range sections {
+		best = math.Max(best, math.Abs(a))
+	}
+	return best
+}
+
+func triangleArea(a, b, c [3]float32) float64 {
+	ux, uy, uz := float64(b[0]-a[0]), float64(b[1]-a[1]), float64(b[2]-a[2])
+	vx, vy, vz := float64(c[0]-a[0]), float64(c[1]-a[1]), float64(c[2]-a[2])
+	nx := uy*vz - uz*vy
+	ny := uz*vx - ux*vz
+	nz := ux*vy - uy*vx
+	return math.Sqrt(nx*nx+ny*ny+nz*nz) / 2
+}
+
+// normalizeDeg maps an angle to (-180, 180].
+func normalizeDeg(d float64) float64 {
+	d = math.Mod(d, 360)
+	if d > 180 {
+		d -= 360
+	} else if d <= -180 {
+		d += 360
+	}
+	return d
+}
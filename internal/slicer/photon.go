@@ -7,6 +7,8 @@ import (
 	"image/color"
 	"io"
 	"math"
+
+	"3dmodels/internal/models"
 )
 
 const (
@@ -23,6 +25,7 @@ type PhotonHeader struct {
 	ExposureS       float32
 	BottomExposureS float32
 	BottomLayers    uint32
+	TransitionLayers uint32 // not stored; steps the per-layer exposure
 	ResolutionX     uint32
 	ResolutionY     uint32
 	LayerCount      uint32
@@ -30,6 +33,8 @@ type PhotonHeader struct {
 	LiftSpeedMMPS   float32
 	RetractSpeedMMPS float32
 	AntiAliasing    uint32
+	LargePreview    image.Image // optional, stored like CTB previews
+	SmallPreview    image.Image
 }
 
 // RLEEncode encodes a grayscale image using the Photon RLE format.
@@ -88,71 +93,136 @@ func RLEEncode(img *image.Gray) []byte {
 	return encoded
 }
 
-// WritePhotonFile writes a complete .photon file.
-func WritePhotonFile(w io.Writer, header PhotonHeader, layers [][]byte) error {
+// PhotonWriter streams a .photon file: the header, previews and an empty
+// layer table come first, and each layer fills in its table entry.
+type PhotonWriter struct {
+	w           LayerOutput
+	header      PhotonHeader
+	tableOffset uint32
+	offset      uint32 // where the next layer's data goes
+	layers      layerCounter
+}
+
+// photonLayerEntry is an entry of the layer table.
+type photonLayerEntry struct {
+	LayerZ     float32
+	DataOffset uint32
+	DataLength uint32
+	Exposure   float32
+	LiftHeight float32
+	LiftSpeed  float32
+	Padding    [12]byte
+}
+
+const photonLayerEntrySize = 36
+
+// NewPhotonWriter writes everything before the layer data of a .photon file
+// with header.LayerCount layers.
+func NewPhotonWriter(w LayerOutput, header PhotonHeader) (*PhotonWriter, error) {
 	// Calculate offsets
 	headerSize := uint32(76)
-	previewLargeSize := uint32(0) // Skip preview for now
-	previewSmallSize := uint32(0)
+	var previewLarge, previewSmall []byte
+	previewLargeSize, previewSmallSize := uint32(0), uint32(0)
+	if header.LargePreview != nil {
+		previewLarge = encodeCTBPreview(header.LargePreview)
+		previewLargeSize = ctbPreviewHeadSize + uint32(len(previewLarge))
+	}
+	if header.SmallPreview != nil {
+		previewSmall = encodeCTBPreview(header.SmallPreview)
+		previewSmallSize = ctbPreviewHeadSize + uint32(len(previewSmall))
+	}
 
 	layerTableOffset := headerSize + previewLargeSize + previewSmallSize
-	layerEntrySize := uint32(36) // each layer table entry
-	layerTableSize := layerEntrySize * header.LayerCount
+	layerTableSize := photonLayerEntrySize * header.LayerCount
 
-	// Calculate layer data offsets
-	layerDataOffset := layerTableOffset + layerTableSize
-	layerOffsets := make([]uint32, header.LayerCount)
-	currentOffset := layerDataOffset
-	for i := uint32(0); i < header.LayerCount; i++ {
-		layerOffsets[i] = currentOffset
-		currentOffset += uint32(len(layers[i]))
+	// Previews follow the header, each with its own offset (0 = none)
+	previewLargeOff, previewSmallOff := uint32(0), uint32(0)
+	if previewLargeSize > 0 {
+		previewLargeOff = headerSize
+	}
+	if previewSmallSize > 0 {
+		previewSmallOff = headerSize + previewLargeSize
 	}
 
 	// Write header (76 bytes)
-	if err := writeHeader(w, header, layerTableOffset, previewLargeSize, previewSmallSize); err != nil {
-		return fmt.Errorf("write header: %w", err)
+	if err := writeHeader(w, header, layerTableOffset, previewLargeOff, previewSmallOff); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
 	}
 
-	// Write layer table
-	for i := uint32(0); i < header.LayerCount; i++ {
-		layerZ := float32(i+1) * header.LayerHeightMM
-		exposure := header.ExposureS
-		if i < header.BottomLayers {
-			exposure = header.BottomExposureS
+	for _, p := range []struct {
+		img    image.Image
+		data   []byte
+		offset uint32
+	}{{header.LargePreview, previewLarge, previewLargeOff}, {header.SmallPreview, previewSmall, previewSmallOff}} {
+		if p.img == nil {
+			continue
 		}
-
-		entry := struct {
-			LayerZ     float32
-			DataOffset uint32
-			DataLength uint32
-			Exposure   float32
-			LiftHeight float32
-			LiftSpeed  float32
-			Padding    [12]byte
-		}{
-			LayerZ:     layerZ,
-			DataOffset: layerOffsets[i],
-			DataLength: uint32(len(layers[i])),
-			Exposure:   exposure,
-			LiftHeight: header.LiftHeightMM,
-			LiftSpeed:  header.LiftSpeedMMPS,
+		ph := ctbPreviewHeader{
+			ResolutionX: uint32(p.img.Bounds().Dx()),
+			ResolutionY: uint32(p.img.Bounds().Dy()),
+			DataOffset:  p.offset + ctbPreviewHeadSize,
+			DataLength:  uint32(len(p.data)),
 		}
-
-		if err := binary.Write(w, binary.LittleEndian, &entry); err != nil {
-			return fmt.Errorf("write layer table entry %d: %w", i, err)
+		if err := binary.Write(w, binary.LittleEndian, &ph); err != nil {
+			return nil, fmt.Errorf("write preview: %w", err)
+		}
+		if _, err := w.Write(p.data); err != nil {
+			return nil, fmt.Errorf("write preview: %w", err)
 		}
 	}
 
-	// Write layer data
-	for i := uint32(0); i < header.LayerCount; i++ {
-		if _, err := w.Write(layers[i]); err != nil {
-			return fmt.Errorf("write layer data %d: %w", i, err)
-		}
+	// Reserve the layer table
+	if err := writeZeros(w, int64(layerTableSize)); err != nil {
+		return nil, fmt.Errorf("write layer table: %w", err)
 	}
 
+	return &PhotonWriter{
+		w:           w,
+		header:      header,
+		tableOffset: layerTableOffset,
+		offset:      layerTableOffset + layerTableSize,
+		layers:      layerCounter{total: int(header.LayerCount)},
+	}, nil
+}
+
+// WriteLayer encodes a layer with RLEEncode and appends it.
+func (pw *PhotonWriter) WriteLayer(img *image.Gray) error {
+	i, err := pw.layers.take()
+	if err != nil {
+		return err
+	}
+	data := RLEEncode(img)
+
+	exposure := float32(LayerExposure(&models.PrintSettings{
+		ExposureTimeS:    float64(pw.header.ExposureS),
+		BottomExposureS:  float64(pw.header.BottomExposureS),
+		BottomLayers:     int(pw.header.BottomLayers),
+		TransitionLayers: int(pw.header.TransitionLayers),
+	}, i))
+	entry := photonLayerEntry{
+		LayerZ:     float32(i+1) * pw.header.LayerHeightMM,
+		DataOffset: pw.offset,
+		DataLength: uint32(len(data)),
+		Exposure:   exposure,
+		LiftHeight: pw.header.LiftHeightMM,
+		LiftSpeed:  pw.header.LiftSpeedMMPS,
+	}
+	if err := writeStructAt(pw.w, binary.LittleEndian, &entry, int64(pw.tableOffset)+int64(i)*photonLayerEntrySize); err != nil {
+		return fmt.Errorf("write layer table entry %d: %w", i, err)
+	}
+	if _, err := pw.w.Write(data); err != nil {
+		return fmt.Errorf("write layer data %d: %w", i, err)
+	}
+	pw.offset += uint32(len(data))
 	return nil
 }
 
+// Close checks that every layer was written; the .photon header carries
+// no totals.
+func (pw *PhotonWriter) Close(volumeML float64) error {
+	return pw.layers.check()
+}
+
 func writeHeader(w io.Writer, h PhotonHeader, layerTableOffset, previewLargeOff, previewSmallOff uint32) error {
 	// The photon header is 76 bytes
 	buf := make([]byte, 76)
@@ -182,13 +252,13 @@ func writeHeader(w io.Writer, h PhotonHeader, layerTableOffset, previewLargeOff,
 	binary.LittleEndian.PutUint32(buf[52:56], h.ResolutionY)
 
 	// Preview offsets (0 = no preview)
-	binary.LittleEndian.PutUint32(buf[56:60], 0) // preview large offset
+	binary.LittleEndian.PutUint32(buf[56:60], previewLargeOff)
 	binary.LittleEndian.PutUint32(buf[60:64], layerTableOffset)
 
 	binary.LittleEndian.PutUint32(buf[64:68], h.LayerCount)
 
 	// Preview small offset
-	binary.LittleEndian.PutUint32(buf[68:72], 0) // preview small offset
+	binary.LittleEndian.PutUint32(buf[68:72], previewSmallOff)
 
 	binary.LittleEndian.PutUint32(buf[72:76], h.AntiAliasing)
 
@@ -229,3 +299,104 @@ func GeneratePreview(img *image.Gray, targetWidth, targetHeight int) image.Image
 
 	return preview
 }
+
+// DecodePhoton reads a .photon file. Files written by PhotonWriter carry
+// their previews or layer table right after the 76-byte header; anything
+// else is taken to be a Chitubox .photon, which shares the CTB layout.
+func DecodePhoton(r io.ReaderAt, size int64) (*PrintFile, error) {
+	buf := make([]byte, 76)
+	if size < int64(len(buf)) {
+		return nil, fmt.Errorf("file too small for a Photon header")
+	}
+	if _, err := r.ReadAt(buf, 0); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	// Our header is followed by the large preview or, without one, the layer table
+	if binary.LittleEndian.Uint32(buf[56:60]) != uint32(len(buf)) && binary.LittleEndian.Uint32(buf[60:64]) != uint32(len(buf)) {
+		f, err := DecodeCTB(r, size)
+		if err != nil {
+			return nil, err
+		}
+		f.Format = "photon"
+		return f, nil
+	}
+	if binary.LittleEndian.Uint32(buf[0:4]) != photonMagic {
+		return nil, fmt.Errorf("not a Photon file")
+	}
+
+	u32 := func(offset int) uint32 { return binary.LittleEndian.Uint32(buf[offset:]) }
+	f32 := func(offset int) float64 { return float64(math.Float32frombits(u32(offset))) }
+	f := &PrintFile{
+		Format:          "photon",
+		Version:         int(u32(4)),
+		BedXMM:          f32(8),
+		BedYMM:          f32(12),
+		BedZMM:          f32(16),
+		LayerHeightMM:   f32(32),
+		ExposureS:       f32(36),
+		BottomExposureS: f32(40),
+		BottomLayers:    int(u32(44)),
+		ResolutionX:     int(u32(48)),
+		ResolutionY:     int(u32(52)),
+		LayerCount:      int(u32(64)),
+		AntiAliasing:    int(u32(72)),
+		r:               r,
+	}
+	for _, offset := range []uint32{u32(56), u32(68)} {
+		if offset == 0 {
+			continue
+		}
+		img, err := readCTBPreview(r, size, offset)
+		if err != nil {
+			return nil, err
+		}
+		if img != nil {
+			f.Previews = append(f.Previews, img)
+		}
+	}
+
+	if int64(f.LayerCount)*36 > size {
+		return nil, fmt.Errorf("layer table out of bounds")
+	}
+
+	table := make([]byte, f.LayerCount*36)
+	if _, err := r.ReadAt(table, int64(u32(60))); err != nil {
+		return nil, fmt.Errorf("read layer table: %w", err)
+	}
+	for i := 0; i < f.LayerCount; i++ {
+		entry := table[i*36:]
+		f.layers = append(f.layers, printFileLayer{
+			offset: int64(binary.LittleEndian.Uint32(entry[4:])),
+			length: int(binary.LittleEndian.Uint32(entry[8:])),
+		})
+		if i == 0 {
+			// Lift parameters are only recorded per layer
+			f.LiftHeightMM = float64(math.Float32frombits(binary.LittleEndian.Uint32(entry[16:])))
+			f.LiftSpeedMMPS = float64(math.Float32frombits(binary.LittleEndian.Uint32(entry[20:])))
+		}
+	}
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	width, height := f.ResolutionX, f.ResolutionY
+	f.decode = func(data []byte, _ int) (*image.Gray, error) {
+		return decodePhotonLayer(data, width, height)
+	}
+	return f, nil
+}
+
+// decodePhotonLayer is the inverse of RLEEncode.
+func decodePhotonLayer(data []byte, width, height int) (*image.Gray, error) {
+	w := newRunWriter(width, height)
+	for _, b := range data {
+		var v byte
+		if b&0x80 != 0 {
+			v = 0xff
+		}
+		if err := w.put(v, int(b&0x7f)); err != nil {
+			return nil, err
+		}
+	}
+	return w.finish()
+}
@@ -0,0 +1,236 @@
+package slicer
+
+import (
+	"fmt"
+	"sort"
+
+	"3dmodels/internal/models"
+)
+
+const (
+	// plateSpacingMM is the gap kept between arranged objects.
+	plateSpacingMM = 3.0
+	// MaxCopies is the most copies of one file a plate can hold.
+	MaxCopies = 100
+	// maxPlateTriangles bounds the triangles of the plate once copies are
+	// expanded, checked before any mesh is cloned.
+	maxPlateTriangles = 20_000_000
+)
+
+// ObjectTransform positions one input file on the plate. The zero value
+// leaves the file unchanged.
+type ObjectTransform struct {
+	RotateXDeg float64 `json:"rotate_x_deg"`
+	RotateYDeg float64 `json:"rotate_y_deg"`
+	RotateZDeg float64 `json:"rotate_z_deg"`
+	Scale      float64 `json:"scale"`       // uniform factor, 0 means 1
+	OffsetXMM  float64 `json:"offset_x_mm"` // added after placement
+	OffsetYMM  float64 `json:"offset_y_mm"`
+	Copies     int     `json:"copies"` // 0 means 1, at most MaxCopies
+}
+
+func (t ObjectTransform) copies() int {
+	if t.Copies < 1 {
+		return 1
+	}
+	return t.Copies
+}
+
+// PlateObject is the footprint of one placed copy, in plate coordinates (mm).
+type PlateObject struct {
+	Name     string
+	Copy     int // 1-based
+	MinX     float64
+	MinY     float64
+	MaxX     float64
+	MaxY     float64
+	HeightMM float64
+	Outside  bool // the footprint crosses the plate edge
+}
+
+// PlateLayout describes where every object ends up on the build plate.
+type PlateLayout struct {
+	WidthMM float64
+	DepthMM float64
+	Objects []PlateObject
+}
+
+// Fits reports whether every object lies inside the plate.
+func (l *PlateLayout) Fits() bool {
+	for _, o := range l.Objects {
+		if o.Outside {
+			return false
+		}
+	}
+	return true
+}
+
+// BuildPlate applies the per-file transforms, expands copies and places every
+// object on the plate, then merges them into a single mesh. When arrange is
+// true the footprints are packed side by side; otherwise every object is
+// centered on the plate. Offsets are applied on top of either placement.
+// transforms is parallel to meshes; missing entries mean no transform.
+func BuildPlate(meshes []*Mesh, names []string, transforms []ObjectTransform, profile *models.PrinterProfile, arrange bool) (*Mesh, *PlateLayout, error) {
+	type placed struct {
+		mesh      *Mesh
+		name      string
+		copy      int
+		transform ObjectTransform
+	}
+
+	triangles := 0
+	for i, m := range meshes {
+		var t ObjectTransform
+		if i < len(transforms) {
+			t = transforms[i]
+		}
+		if t.Copies > MaxCopies {
+			return nil, nil, fmt.Errorf("%s: at most %d copies", names[i], MaxCopies)
+		}
+		triangles += len(m.Triangles) * t.copies()
+	}
+	if triangles > maxPlateTriangles {
+		return nil, nil, fmt.Errorf("plate has %d triangles with its copies, at most %d", triangles, maxPlateTriangles)
+	}
+
+	var objects []placed
+	for i, m := range meshes {
+		var t ObjectTransform
+		if i < len(transforms) {
+			t = transforms[i]
+		}
+		if t.Scale < 0 {
+			return nil, nil, fmt.Errorf("%s: scale must be positive", names[i])
+		}
+		if t.Scale > 0 && t.Scale != 1 {
+			m.Scale(float32(t.Scale))
+		}
+		m.Rotate(t.RotateXDeg, t.RotateYDeg, t.RotateZDeg)
+
+		for c := 0; c < t.copies(); c++ {
+			cm := m
+			if c > 0 {
+				cm = m.Clone()
+			}
+			objects = append(objects, placed{mesh: cm, name: names[i], copy: c + 1, transform: t})
+		}
+	}
+	if len(objects) == 0 {
+		return nil, nil, fmt.Errorf("no objects to place")
+	}
+
+	centerX := profile.BuildWidthMM / 2
+	centerY := profile.BuildDepthMM / 2
+	for _, o := range objects {
+		o.mesh.CenterOnPlate(centerX, centerY)
+	}
+
+	if arrange && len(objects) > 1 {
+		sizes := make([][2]float64, len(objects))
+		for i, o := range objects {
+			sizes[i] = [2]float64{
+				float64(o.mesh.MaxBound[0] - o.mesh.MinBound[0]),
+				float64(o.mesh.MaxBound[1] - o.mesh.MinBound[1]),
+			}
+		}
+		positions := packFootprints(sizes, profile.BuildWidthMM, profile.BuildDepthMM)
+		for i, o := range objects {
+			dx := positions[i][0] - float64(o.mesh.MinBound[0])
+			dy := positions[i][1] - float64(o.mesh.MinBound[1])
+			o.mesh.Translate(float32(dx), float32(dy), 0)
+		}
+	}
+
+	layout := &PlateLayout{WidthMM: profile.BuildWidthMM, DepthMM: profile.BuildDepthMM}
+	var merged *Mesh
+	for _, o := range objects {
+		if o.transform.OffsetXMM != 0 || o.transform.OffsetYMM != 0 {
+			o.mesh.Translate(float32(o.transform.OffsetXMM), float32(o.transform.OffsetYMM), 0)
+		}
+
+		po := PlateObject{
+			Name:     o.name,
+			Copy:     o.copy,
+			MinX:     float64(o.mesh.MinBound[0]),
+			MinY:     float64(o.mesh.MinBound[1]),
+			MaxX:     float64(o.mesh.MaxBound[0]),
+			MaxY:     float64(o.mesh.MaxBound[1]),
+			HeightMM: float64(o.mesh.MaxBound[2] - o.mesh.MinBound[2]),
+		}
+		po.Outside = po.MinX < 0 || po.MinY < 0 || po.MaxX > layout.WidthMM || po.MaxY > layout.DepthMM
+		layout.Objects = append(layout.Objects, po)
+
+		if merged == nil {
+			merged = o.mesh
+		} else {
+			merged.MergeMesh(o.mesh)
+		}
+	}
+
+	return merged, layout, nil
+}
+
+// packFootprints arranges rectangles (width, depth) in shelves, tallest
+// first, and centers the whole arrangement on the plate. It returns the
+// lower-left corner of every rectangle in input order. Rectangles that don't
+// fit still get a position past the plate edge so the caller can report it.
+func packFootprints(sizes [][2]float64, plateW, plateD float64) [][2]float64 {
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return sizes[order[a]][1] > sizes[order[b]][1]
+	})
+
+	type shelf struct {
+		y, depth, usedX float64
+	}
+	var shelves []shelf
+	positions := make([][2]float64, len(sizes))
+	nextY := 0.0
+	maxX := 0.0
+
+	for _, i := range order {
+		w, d := sizes[i][0], sizes[i][1]
+		placedOnShelf := false
+		for s := range shelves {
+			x := shelves[s].usedX
+			if x > 0 {
+				x += plateSpacingMM
+			}
+			if x+w <= plateW && d <= shelves[s].depth {
+				positions[i] = [2]float64{x, shelves[s].y}
+				shelves[s].usedX = x + w
+				placedOnShelf = true
+				if x+w > maxX {
+					maxX = x + w
+				}
+				break
+			}
+		}
+		if placedOnShelf {
+			continue
+		}
+
+		y := nextY
+		if len(shelves) > 0 {
+			y += plateSpacingMM
+		}
+		shelves = append(shelves, shelf{y: y, depth: d, usedX: w})
+		positions[i] = [2]float64{0, y}
+		nextY = y + d
+		if w > maxX {
+			maxX = w
+		}
+	}
+
+	// Center the packed block on the plate
+	dx := (plateW - maxX) / 2
+	dy := (plateD - nextY) / 2
+	for i := range positions {
+		positions[i][0] += dx
+		positions[i][1] += dy
+	}
+	return positions
+}
@@ -0,0 +1,209 @@
+package slicer
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"math"
+
+	"3dmodels/internal/models"
+)
+
+// previewSupersample is the number of samples per pixel side; the render is
+// box-filtered down to smooth the model's edges.
+const previewSupersample = 2
+
+// maxPreviewSize caps the sides of a preview read from a print file, so a
+// corrupt header can't make a decoder allocate an arbitrary image.
+const maxPreviewSize = 4096
+
+var (
+	previewBackground = color.RGBA{R: 0, G: 0, B: 0, A: 255}
+	previewPlate      = color.RGBA{R: 48, G: 48, B: 56, A: 255}
+	previewModel      = color.RGBA{R: 100, G: 80, B: 200, A: 255}
+)
+
+// The camera looks down at the plate from the front right, along
+// (-1, 1, -1); previewRight and previewUp span the image plane.
+var (
+	previewForward = [3]float64{-1 / math.Sqrt(3), 1 / math.Sqrt(3), -1 / math.Sqrt(3)}
+	previewRight   = [3]float64{1 / math.Sqrt(2), 1 / math.Sqrt(2), 0}
+	previewUp      = [3]float64{-1 / math.Sqrt(6), 1 / math.Sqrt(6), 2 / math.Sqrt(6)}
+	previewLight   = normalize([3]float64{-0.3, -0.5, 1})
+)
+
+// platePreview draws the shaded isometric view of the plate used for the
+// thumbnails embedded in print files.
+type platePreview struct {
+	mesh           *Mesh
+	plateW, plateD float64
+}
+
+func newPlatePreview(mesh *Mesh, profile *models.PrinterProfile) *platePreview {
+	return &platePreview{mesh: mesh, plateW: profile.BuildWidthMM, plateD: profile.BuildDepthMM}
+}
+
+// previewVertex is a vertex projected on the image: x and y in samples,
+// z the distance from the camera.
+type previewVertex struct{ x, y, z float64 }
+
+// Render draws the plate and the model fitted and centered in a width x
+// height image.
+func (p *platePreview) Render(width, height int) *image.RGBA {
+	sw, sh := width*previewSupersample, height*previewSupersample
+	pix := make([]color.RGBA, sw*sh)
+	depth := make([]float64, sw*sh)
+	for i := range pix {
+		pix[i] = previewBackground
+		depth[i] = math.Inf(1)
+	}
+
+	// Fit the plate and the model's bounding box with a small margin
+	var corners [][3]float64
+	for _, x := range []float64{0, p.plateW} {
+		for _, y := range []float64{0, p.plateD} {
+			corners = append(corners, [3]float64{x, y, 0})
+		}
+	}
+	if len(p.mesh.Triangles) > 0 {
+		lo, hi := p.mesh.MinBound, p.mesh.MaxBound
+		for _, x := range []float32{lo[0], hi[0]} {
+			for _, y := range []float32{lo[1], hi[1]} {
+				for _, z := range []float32{lo[2], hi[2]} {
+					corners = append(corners, [3]float64{float64(x), float64(y), float64(z)})
+				}
+			}
+		}
+	}
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, c := range corners {
+		x, y := dot(c, previewRight), -dot(c, previewUp)
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+		minY, maxY = math.Min(minY, y), math.Max(maxY, y)
+	}
+	scale := 0.92 * math.Min(float64(sw)/math.Max(maxX-minX, 1e-6), float64(sh)/math.Max(maxY-minY, 1e-6))
+	x0 := (float64(sw) - (maxX-minX)*scale) / 2
+	y0 := (float64(sh) - (maxY-minY)*scale) / 2
+	project := func(v [3]float64) previewVertex {
+		return previewVertex{
+			x: x0 + (dot(v, previewRight)-minX)*scale,
+			y: y0 + (-dot(v, previewUp)-minY)*scale,
+			z: dot(v, previewForward),
+		}
+	}
+
+	plate := [4]previewVertex{
+		project([3]float64{0, 0, 0}), project([3]float64{p.plateW, 0, 0}),
+		project([3]float64{p.plateW, p.plateD, 0}), project([3]float64{0, p.plateD, 0}),
+	}
+	// The plate is drawn slightly behind so faces resting on it win
+	for i := range plate {
+		plate[i].z += 1e-3
+	}
+	fillPreviewTriangle(pix, depth, sw, sh, plate[0], plate[1], plate[2], previewPlate)
+	fillPreviewTriangle(pix, depth, sw, sh, plate[0], plate[2], plate[3], previewPlate)
+
+	for _, t := range p.mesh.Triangles {
+		a, b, c := toF64(t.V1), toF64(t.V2), toF64(t.V3)
+		n := normalize(cross([3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}, [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}))
+		if dot(n, previewForward) > 0 {
+			n = [3]float64{-n[0], -n[1], -n[2]}
+		}
+		shade := 0.3 + 0.7*math.Max(0, dot(n, previewLight))
+		col := color.RGBA{
+			R: uint8(float64(previewModel.R) * shade),
+			G: uint8(float64(previewModel.G) * shade),
+			B: uint8(float64(previewModel.B) * shade),
+			A: 255,
+		}
+		fillPreviewTriangle(pix, depth, sw, sh, project(a), project(b), project(c), col)
+	}
+
+	// Box-filter the samples down to the output size
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	const n = previewSupersample * previewSupersample
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var r, g, b int
+			for dy := 0; dy < previewSupersample; dy++ {
+				row := (y*previewSupersample + dy) * sw
+				for dx := 0; dx < previewSupersample; dx++ {
+					s := pix[row+x*previewSupersample+dx]
+					r, g, b = r+int(s.R), g+int(s.G), b+int(s.B)
+				}
+			}
+			i := img.PixOffset(x, y)
+			img.Pix[i], img.Pix[i+1], img.Pix[i+2], img.Pix[i+3] = uint8(r/n), uint8(g/n), uint8(b/n), 255
+		}
+	}
+	return img
+}
+
+// fillPreviewTriangle rasterizes a projected triangle into the sample and
+// depth buffers, keeping the nearest surface at every sample.
+func fillPreviewTriangle(pix []color.RGBA, depth []float64, w, h int, a, b, c previewVertex, col color.RGBA) {
+	area := (b.x-a.x)*(c.y-a.y) - (b.y-a.y)*(c.x-a.x)
+	if math.Abs(area) < 1e-12 {
+		return
+	}
+	minX := max(0, int(math.Floor(math.Min(a.x, math.Min(b.x, c.x)))))
+	maxX := int(math.Ceil(math.Max(a.x, math.Max(b.x, c.x))))
+	minY := max(0, int(math.Floor(math.Min(a.y, math.Min(b.y, c.y)))))
+	maxY := int(math.Ceil(math.Max(a.y, math.Max(b.y, c.y))))
+	if maxX > w-1 {
+		maxX = w - 1
+	}
+	if maxY > h-1 {
+		maxY = h - 1
+	}
+	for y := minY; y <= maxY; y++ {
+		py := float64(y) + 0.5
+		for x := minX; x <= maxX; x++ {
+			px := float64(x) + 0.5
+			// Barycentric weights, all of the same sign inside the triangle
+			wa := ((b.x-px)*(c.y-py) - (b.y-py)*(c.x-px)) / area
+			wb := ((c.x-px)*(a.y-py) - (c.y-py)*(a.x-px)) / area
+			wc := 1 - wa - wb
+			if wa < 0 || wb < 0 || wc < 0 {
+				continue
+			}
+			z := wa*a.z + wb*b.z + wc*c.z
+			if i := y*w + x; z < depth[i] {
+				depth[i] = z
+				pix[i] = col
+			}
+		}
+	}
+}
+
+func dot(a, b [3]float64) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+// encodeRGB565 returns the RGB565 pixels of an image in the given byte order.
+func encodeRGB565(img image.Image, order binary.AppendByteOrder) []byte {
+	b := img.Bounds()
+	out := make([]byte, 0, b.Dx()*b.Dy()*2)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r, g, bl, _ := img.At(x, y).RGBA()
+			out = order.AppendUint16(out, uint16(r>>11)<<11|uint16(g>>10)<<5|uint16(bl>>11))
+		}
+	}
+	return out
+}
+
+// decodeRGB565 is the inverse of encodeRGB565.
+func decodeRGB565(data []byte, width, height int, order binary.ByteOrder) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := 0; i < width*height && 2*i+1 < len(data); i++ {
+		c := order.Uint16(data[2*i:])
+		r, g, b := byte(c>>11), byte(c>>5&0x3f), byte(c&0x1f)
+		img.Pix[4*i] = r<<3 | r>>2
+		img.Pix[4*i+1] = g<<2 | g>>4
+		img.Pix[4*i+2] = b<<3 | b>>2
+		img.Pix[4*i+3] = 0xff
+	}
+	return img
+}
@@ -0,0 +1,168 @@
+package slicer
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// printFileDecoders maps print file extensions to their readers.
+var printFileDecoders = map[string]func(r io.ReaderAt, size int64) (*PrintFile, error){
+	".photon": DecodePhoton,
+	".dlp":    DecodeDLP,
+	".ctb":    DecodeCTB,
+	".cbddlp": DecodeCTB,
+	".goo":    DecodeGOO,
+	".sl1":    DecodeSL1,
+	".sl1s":   DecodeSL1,
+}
+
+func init() {
+	for id := range pwsVariants {
+		format := id
+		printFileDecoders["."+id] = func(r io.ReaderAt, size int64) (*PrintFile, error) {
+			return DecodePWS(r, size, format)
+		}
+	}
+}
+
+// IsPrintFileExt reports whether a file extension (with the dot) is a sliced
+// print file that can be decoded.
+func IsPrintFileExt(ext string) bool {
+	_, ok := printFileDecoders[strings.ToLower(ext)]
+	return ok
+}
+
+// DecodePrintFile reads a print file, picking the decoder from its extension.
+func DecodePrintFile(r io.ReaderAt, size int64, ext string) (*PrintFile, error) {
+	decode, ok := printFileDecoders[strings.ToLower(ext)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported print file format %q", ext)
+	}
+	return decode(r, size)
+}
+
+// OpenPrintFile opens and decodes a print file. The file stays open for
+// reading layers until Close is called.
+func OpenPrintFile(filePath string) (*PrintFile, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f, err := DecodePrintFile(file, info.Size(), filepath.Ext(filePath))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.closer = file
+	return f, nil
+}
+
+// PrintFile is a sliced print file read back: its print parameters, previews
+// and, on demand, the layer bitmaps.
+type PrintFile struct {
+	Format           string // OutputFormat ID of the family, e.g. "goo"
+	Version          int
+	MachineName      string
+	ResolutionX      int
+	ResolutionY      int
+	BedXMM           float64
+	BedYMM           float64
+	BedZMM           float64
+	LayerHeightMM    float64
+	ExposureS        float64
+	BottomExposureS  float64
+	BottomLayers     int
+	LiftHeightMM     float64
+	LiftSpeedMMPS    float64
+	RetractSpeedMMPS float64
+	AntiAliasing     int
+	PrintTimeS       float64
+	VolumeML         float64
+	LayerCount       int
+	Previews         []image.Image
+
+	r      io.ReaderAt
+	closer io.Closer
+	layers []printFileLayer
+	decode func(data []byte, layer int) (*image.Gray, error)
+}
+
+// printFileLayer locates one layer's encoded data in the file.
+type printFileLayer struct {
+	offset int64
+	length int
+}
+
+// Layer decodes layer i (0-based) into a grayscale bitmap.
+func (f *PrintFile) Layer(i int) (*image.Gray, error) {
+	if i < 0 || i >= len(f.layers) {
+		return nil, fmt.Errorf("layer %d out of range (%d layers)", i, len(f.layers))
+	}
+	l := f.layers[i]
+	data := make([]byte, l.length)
+	if _, err := f.r.ReadAt(data, l.offset); err != nil {
+		return nil, fmt.Errorf("read layer %d: %w", i, err)
+	}
+	img, err := f.decode(data, i)
+	if err != nil {
+		return nil, fmt.Errorf("decode layer %d: %w", i, err)
+	}
+	return img, nil
+}
+
+// Close releases the file opened by OpenPrintFile.
+func (f *PrintFile) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+// checkLayerBounds verifies that every layer lies inside a file of the given size.
+func (f *PrintFile) checkLayerBounds(size int64) error {
+	for i, l := range f.layers {
+		if l.offset < 0 || l.length < 0 || l.offset+int64(l.length) > size {
+			return fmt.Errorf("layer %d data out of bounds", i)
+		}
+	}
+	return nil
+}
+
+// runWriter fills a bitmap with runs of pixels in row-major order.
+type runWriter struct {
+	img *image.Gray
+	pos int
+}
+
+func newRunWriter(width, height int) *runWriter {
+	return &runWriter{img: image.NewGray(image.Rect(0, 0, width, height))}
+}
+
+func (w *runWriter) put(v byte, run int) error {
+	if run > len(w.img.Pix)-w.pos {
+		return fmt.Errorf("run of %d pixels overflows the layer", run)
+	}
+	if v != 0 {
+		for i := w.pos; i < w.pos+run; i++ {
+			w.img.Pix[i] = v
+		}
+	}
+	w.pos += run
+	return nil
+}
+
+func (w *runWriter) finish() (*image.Gray, error) {
+	if w.pos != len(w.img.Pix) {
+		return nil, fmt.Errorf("layer has %d of %d pixels", w.pos, len(w.img.Pix))
+	}
+	return w.img, nil
+}
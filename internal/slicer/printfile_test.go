@@ -0,0 +1,294 @@
+package slicer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"3dmodels/internal/models"
+)
+
+// testCTBPreview returns an image whose colors survive the RGB15 round trip
+// of the CTB and Photon previews.
+func testCTBPreview(width, height int) *image.RGBA {
+	data := make([]byte, width*height*2)
+	for i := 0; i < width*height; i++ {
+		binary.LittleEndian.PutUint16(data[2*i:], testPreviewColor(i%width, i/width)&^ctbPreviewRepeat)
+	}
+	return decodeCTBPreview(data, width, height)
+}
+
+// printFileCase writes a print file of one format with given previews, and
+// says how its layers quantize pixel values.
+type printFileCase struct {
+	ext      string
+	version  int
+	previews []*image.RGBA
+	write    func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error)
+	quantize func(v byte) byte
+}
+
+func printFileCases() []printFileCase {
+	bilevel := func(v byte) byte {
+		if v >= 128 {
+			return 0xff
+		}
+		return 0
+	}
+	ctb := func(version int) printFileCase {
+		return printFileCase{
+			ext:      "ctb",
+			version:  version,
+			previews: []*image.RGBA{testCTBPreview(ctbLargePreviewSize, ctbLargePreviewSize*3/4), testCTBPreview(ctbSmallPreviewSize, ctbSmallPreviewSize*5/8)},
+			write: func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error) {
+				info := CTBInfo{Version: version, MachineName: "Test", AntiAliasing: 4, LargePreview: previews[0], SmallPreview: previews[1]}
+				return NewCTBWriter(w, profile, settings, info, n)
+			},
+			quantize: func(v byte) byte { return v>>1<<1 | v>>7 },
+		}
+	}
+	return []printFileCase{
+		{
+			ext:      "photon",
+			version:  2,
+			previews: []*image.RGBA{testCTBPreview(ctbLargePreviewSize, ctbLargePreviewSize*3/4), testCTBPreview(ctbSmallPreviewSize, ctbSmallPreviewSize*5/8)},
+			write: func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error) {
+				return NewPhotonWriter(w, PhotonHeader{
+					BedXMM:          float32(profile.BuildWidthMM),
+					BedYMM:          float32(profile.BuildDepthMM),
+					BedZMM:          float32(profile.BuildHeightMM),
+					LayerHeightMM:   float32(settings.LayerHeightMM),
+					ExposureS:       float32(settings.ExposureTimeS),
+					BottomExposureS: float32(settings.BottomExposureS),
+					BottomLayers:    uint32(settings.BottomLayers),
+					ResolutionX:     uint32(profile.ResolutionX),
+					ResolutionY:     uint32(profile.ResolutionY),
+					LayerCount:      uint32(n),
+					AntiAliasing:    1,
+					LargePreview:    previews[0],
+					SmallPreview:    previews[1],
+				})
+			},
+			quantize: bilevel,
+		},
+		{
+			ext:      "dlp",
+			version:  1,
+			previews: []*image.RGBA{testPreview(pwsPreviewWidth, pwsPreviewHeight)},
+			write: func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error) {
+				return NewDLPWriter(w, profile, settings, previews[0], n)
+			},
+			quantize: bilevel,
+		},
+		ctb(3),
+		ctb(4),
+		{
+			ext:      "pwmx",
+			version:  515,
+			previews: []*image.RGBA{testPreview(pwsPreviewWidth, pwsPreviewHeight)},
+			write: func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error) {
+				return NewPWSWriter(w, profile, settings, PWSInfo{Format: "pwmx", Preview: previews[0]}, n)
+			},
+			quantize: func(v byte) byte { return v>>4<<4 | v>>4 },
+		},
+		{
+			ext:      "goo",
+			version:  3,
+			previews: []*image.RGBA{testPreview(gooSmallPreviewSize, gooSmallPreviewSize), testPreview(gooBigPreviewSize, gooBigPreviewSize)},
+			write: func(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, previews []*image.RGBA, n int) (LayerWriter, error) {
+				info := GOOInfo{MachineName: "Test", SmallPreview: previews[0], BigPreview: previews[1]}
+				return NewGOOWriter(w, profile, settings, info, n)
+			},
+			quantize: func(v byte) byte { return v },
+		},
+	}
+}
+
+// writeTestPrintFile writes the test layers in the format of c to a file in
+// dir and returns its path.
+func writeTestPrintFile(t *testing.T, dir string, c printFileCase, profile *models.PrinterProfile, settings *models.PrintSettings, layers []testLayer) string {
+	t.Helper()
+	path := filepath.Join(dir, fmt.Sprintf("test-v%d.%s", c.version, c.ext))
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	w, err := c.write(out, profile, settings, c.previews, len(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range layers {
+		if err := w.WriteLayer(l.img); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(3.5); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPrintFileRoundTrip(t *testing.T) {
+	const width, height = 1100, 1000
+	profile := testProfile(width, height)
+	settings := DefaultPrintSettings(0)
+	settings.BottomLayers = 2
+	layers := testLayers(width, height)
+
+	for _, c := range printFileCases() {
+		t.Run(fmt.Sprintf("%s v%d", c.ext, c.version), func(t *testing.T) {
+			f, err := OpenPrintFile(writeTestPrintFile(t, t.TempDir(), c, profile, settings, layers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			near := func(a, b float64) bool { return math.Abs(a-b) < 1e-4 }
+			if f.Version != c.version || f.ResolutionX != width || f.ResolutionY != height || f.LayerCount != len(layers) ||
+				f.BottomLayers != settings.BottomLayers || !near(f.LayerHeightMM, settings.LayerHeightMM) ||
+				!near(f.ExposureS, settings.ExposureTimeS) || !near(f.BottomExposureS, settings.BottomExposureS) ||
+				!near(f.BedXMM, profile.BuildWidthMM) || !near(f.BedYMM, profile.BuildDepthMM) {
+				t.Errorf("header read back as %+v", *f)
+			}
+
+			if len(f.Previews) != len(c.previews) {
+				t.Fatalf("got %d previews, want %d", len(f.Previews), len(c.previews))
+			}
+			for i, want := range c.previews {
+				got, ok := f.Previews[i].(*image.RGBA)
+				if !ok || got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.Pix) {
+					t.Errorf("preview %d differs from the one written", i)
+				}
+			}
+
+			for i, l := range layers {
+				want := image.NewGray(l.img.Bounds())
+				for p, v := range l.img.Pix {
+					want.Pix[p] = c.quantize(v)
+				}
+				got, err := f.Layer(i)
+				if err != nil {
+					t.Fatalf("layer %d: %v", i, err)
+				}
+				assertSameGray(t, l.name, got, want)
+			}
+		})
+	}
+}
+
+// decodeAll decodes a print file and all its layers, turning a panic into a
+// test failure.
+func decodeAll(t *testing.T, data []byte, ext string) (err error) {
+	t.Helper()
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("decoding panicked: %v", r)
+		}
+	}()
+	f, err := DecodePrintFile(bytes.NewReader(data), int64(len(data)), "."+ext)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < f.LayerCount; i++ {
+		if _, err := f.Layer(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPrintFileCorrupt(t *testing.T) {
+	const width, height = 64, 48
+	profile := testProfile(width, height)
+	settings := DefaultPrintSettings(0)
+	layers := testLayers(width, height)
+	dir := t.TempDir()
+
+	for _, c := range printFileCases() {
+		t.Run(fmt.Sprintf("%s v%d", c.ext, c.version), func(t *testing.T) {
+			data, err := os.ReadFile(writeTestPrintFile(t, dir, c, profile, settings, layers))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := decodeAll(t, data, c.ext); err != nil {
+				t.Fatalf("intact file: %v", err)
+			}
+
+			for _, n := range []int{0, 1, 16, len(data) / 4, len(data) / 2, len(data) * 3 / 4} {
+				if err := decodeAll(t, data[:n], c.ext); err == nil {
+					t.Errorf("file truncated to %d of %d bytes decoded without error", n, len(data))
+				}
+			}
+
+			rng := rand.New(rand.NewSource(1))
+			for i := 0; i < 20; i++ {
+				corrupt := bytes.Clone(data)
+				rng.Read(corrupt[:128])
+				if err := decodeAll(t, corrupt, c.ext); err == nil {
+					t.Errorf("file with a random header decoded without error")
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDLPHugePreview(t *testing.T) {
+	c := printFileCases()[1]
+	profile := testProfile(64, 48)
+	data, err := os.ReadFile(writeTestPrintFile(t, t.TempDir(), c, profile, DefaultPrintSettings(0), testLayers(64, 48)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sizes whose byte count overflows an int must not be allocated
+	previewOffset := binary.LittleEndian.Uint32(data[20:24])
+	for _, dims := range [][2]uint32{{0x80000000, 0x80000000}, {0xffffffff, 0xffffffff}, {4097, 1}, {4096, 4096}} {
+		binary.LittleEndian.PutUint32(data[previewOffset+12:], dims[0])
+		binary.LittleEndian.PutUint32(data[previewOffset+16:], dims[1])
+		f, err := DecodeDLP(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%dx%d preview: %v", dims[0], dims[1], err)
+		}
+		if len(f.Previews) != 0 {
+			t.Errorf("%dx%d preview was read", dims[0], dims[1])
+		}
+	}
+}
+
+func TestDecodeCTBHugePreview(t *testing.T) {
+	profile := testProfile(64, 48)
+	for _, c := range []struct {
+		printFileCase
+		headerOffset int // of the large preview offset in the header
+	}{{printFileCases()[0], 56}, {printFileCases()[3], 60}} {
+		data, err := os.ReadFile(writeTestPrintFile(t, t.TempDir(), c.printFileCase, profile, DefaultPrintSettings(0), testLayers(64, 48)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		previewOffset := binary.LittleEndian.Uint32(data[c.headerOffset:])
+		var ph ctbPreviewHeader
+		if err := binary.Read(bytes.NewReader(data[previewOffset:]), binary.LittleEndian, &ph); err != nil {
+			t.Fatal(err)
+		}
+		// Too large, or more pixels than the data can hold
+		for _, bad := range []ctbPreviewHeader{
+			{ResolutionX: 0xffffffff, ResolutionY: 0xffffffff, DataLength: ph.DataLength},
+			{ResolutionX: maxPreviewSize + 1, ResolutionY: 1, DataLength: ph.DataLength},
+			{ResolutionX: ph.ResolutionX, ResolutionY: ph.ResolutionY, DataLength: 4},
+		} {
+			bad.DataOffset = ph.DataOffset
+			var buf bytes.Buffer
+			binary.Write(&buf, binary.LittleEndian, &bad)
+			copy(data[previewOffset:], buf.Bytes())
+			if _, err := DecodePrintFile(bytes.NewReader(data), int64(len(data)), "."+c.ext); err == nil {
+				t.Errorf("%s: %dx%d preview of %d bytes decoded without error", c.ext, bad.ResolutionX, bad.ResolutionY, bad.DataLength)
+			}
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package slicer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"3dmodels/internal/models"
+)
+
+// ProfileBundleVersion is the version of the JSON profile bundle written by
+// export; bundles from a newer version are refused on import.
+const ProfileBundleVersion = 1
+
+// ProfileBundle is the JSON file in which printer profiles and their print
+// settings are exported and imported.
+type ProfileBundle struct {
+	Version  int             `json:"version"`
+	Profiles []BundleProfile `json:"profiles"`
+	// Settings not tied to a printer, like a PrusaSlicer material preset
+	// imported on its own. They are added to a profile chosen on import.
+	Settings []models.PrintSettings `json:"settings,omitempty"`
+}
+
+// BundleProfile is a printer profile with its print settings.
+type BundleProfile struct {
+	Profile  models.PrinterProfile  `json:"profile"`
+	Settings []models.PrintSettings `json:"settings"`
+}
+
+// NewProfileBundle builds the export bundle of profiles, with the settings
+// of each profile keyed by its ID. Database IDs, timestamps and built-in
+// flags are cleared: they belong to the exporting installation.
+func NewProfileBundle(profiles []models.PrinterProfile, settings map[int64][]models.PrintSettings) *ProfileBundle {
+	b := &ProfileBundle{Version: ProfileBundleVersion, Profiles: []BundleProfile{}}
+	for _, p := range profiles {
+		bp := BundleProfile{Profile: p, Settings: []models.PrintSettings{}}
+		for _, s := range settings[p.ID] {
+			s.ID, s.ProfileID, s.CreatedAt = 0, 0, time.Time{}
+			bp.Settings = append(bp.Settings, s)
+		}
+		bp.Profile.ID, bp.Profile.IsBuiltIn, bp.Profile.CreatedAt = 0, false, time.Time{}
+		b.Profiles = append(b.Profiles, bp)
+	}
+	return b
+}
+
+// ParseProfileFile reads printer profiles and print settings from an
+// imported file, picking the parser from its name:
+//
+//   - .json: a ProfileBundle written by export, or a single printer profile
+//     or print settings object with the fields of the API;
+//   - .ini: PrusaSlicer SLA presets, either a single exported config or a
+//     config bundle with [printer:…] and [sla_material:…] sections;
+//   - .cfg, .txt, .gcode: a Chitubox/UVtools machine definition made of
+//     ";key:value" or "key = value" lines.
+//
+// Everything read is validated, so the result can be stored as it is.
+func ParseProfileFile(fileName string, data []byte) (*ProfileBundle, error) {
+	var b *ProfileBundle
+	var err error
+	base := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		b, err = parseProfileBundle(data, base)
+	case ".ini":
+		b, err = parsePrusaSLA(parseKeyValues(data), base)
+	case ".cfg", ".txt", ".gcode":
+		b, err = parseChitubox(parseKeyValues(data), base)
+	default:
+		return nil, fmt.Errorf("unsupported profile file %q: expected .json, .ini, .cfg, .txt or .gcode", filepath.Base(fileName))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b.Profiles) == 0 && len(b.Settings) == 0 {
+		return nil, fmt.Errorf("%s: no printer profiles or print settings found", filepath.Base(fileName))
+	}
+	return b, b.validate()
+}
+
+// parseProfileBundle reads an exported bundle. An object without the bundle
+// fields is a single printer profile when it has a resolution, otherwise
+// print settings on top of the defaults; name is used when it has none.
+func parseProfileBundle(data []byte, name string) (*ProfileBundle, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("invalid profile bundle: %w", err)
+	}
+	_, hasVersion := fields["version"]
+	_, hasProfiles := fields["profiles"]
+	if !hasVersion && !hasProfiles {
+		if _, ok := fields["resolution_x"]; ok {
+			p := models.PrinterProfile{FileFormat: OutputFormats[0].ID}
+			if err := json.Unmarshal(data, &p); err != nil {
+				return nil, fmt.Errorf("invalid printer profile: %w", err)
+			}
+			if strings.TrimSpace(p.Name) == "" {
+				p.Name = name
+			}
+			return &ProfileBundle{Version: ProfileBundleVersion, Profiles: []BundleProfile{{Profile: p}}}, nil
+		}
+		s := DefaultPrintSettings(0)
+		if err := json.Unmarshal(data, s); err != nil {
+			return nil, fmt.Errorf("invalid print settings: %w", err)
+		}
+		if strings.TrimSpace(s.Name) == "" {
+			s.Name = name
+		}
+		return &ProfileBundle{Version: ProfileBundleVersion, Settings: []models.PrintSettings{*s}}, nil
+	}
+
+	var b ProfileBundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("invalid profile bundle: %w", err)
+	}
+	if b.Version < 1 || b.Version > ProfileBundleVersion {
+		return nil, fmt.Errorf("unsupported profile bundle version %d", b.Version)
+	}
+	return &b, nil
+}
+
+func (b *ProfileBundle) validate() error {
+	for i := range b.Profiles {
+		p := &b.Profiles[i].Profile
+		if err := validateImportedProfile(p); err != nil {
+			return err
+		}
+		for j := range b.Profiles[i].Settings {
+			if err := validateImportedSettings(&b.Profiles[i].Settings[j]); err != nil {
+				return fmt.Errorf("printer %q: %w", p.Name, err)
+			}
+		}
+	}
+	for i := range b.Settings {
+		if err := validateImportedSettings(&b.Settings[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateImportedProfile(p *models.PrinterProfile) error {
+	p.Name = strings.TrimSpace(p.Name)
+	p.ID, p.IsBuiltIn = 0, false
+	switch {
+	case p.Name == "":
+		return fmt.Errorf("printer profile without a name")
+	case p.ResolutionX <= 0 || p.ResolutionY <= 0:
+		return fmt.Errorf("printer %q: resolution must be positive", p.Name)
+	case p.BuildWidthMM <= 0 || p.BuildDepthMM <= 0 || p.BuildHeightMM <= 0:
+		return fmt.Errorf("printer %q: build volume must be positive", p.Name)
+	}
+	if _, ok := LookupOutputFormat(p.FileFormat); !ok {
+		return fmt.Errorf("printer %q: unsupported file format %q", p.Name, p.FileFormat)
+	}
+	if p.PixelSizeUM <= 0 {
+		p.PixelSizeUM = p.BuildWidthMM / float64(p.ResolutionX) * 1000
+	}
+	return nil
+}
+
+func validateImportedSettings(s *models.PrintSettings) error {
+	s.Name = strings.TrimSpace(s.Name)
+	s.ID, s.ProfileID = 0, 0
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("print settings without a name")
+	case s.LayerHeightMM <= 0 || s.LayerHeightMM > 1:
+		return fmt.Errorf("settings %q: layer height must be between 0 and 1 mm", s.Name)
+	case s.ExposureTimeS <= 0 || s.BottomExposureS < 0:
+		return fmt.Errorf("settings %q: exposure times must be positive", s.Name)
+	case s.BottomLayers < 0 || s.LiftHeightMM < 0 || s.LiftSpeedMMPS < 0 || s.RetractSpeedMMPS < 0:
+		return fmt.Errorf("settings %q: bottom layers and lift values cannot be negative", s.Name)
+	case s.AntiAliasing < 1 || s.AntiAliasing > 8:
+		return fmt.Errorf("settings %q: anti-aliasing must be between 1 and 8", s.Name)
+	case s.TransitionLayers < 0 || s.LightOffDelayS < 0 || s.BottomLightOffDelayS < 0 ||
+		s.WaitBeforeCureS < 0 || s.WaitAfterCureS < 0 || s.WaitAfterLiftS < 0 ||
+		s.LiftHeight2MM < 0 || s.LiftSpeed2MMPS < 0 || s.RetractHeight2MM < 0 || s.RetractSpeed2MMPS < 0:
+		return fmt.Errorf("settings %q: advanced exposure and motion values cannot be negative", s.Name)
+	case s.LightPWM < 0 || s.LightPWM > 255 || s.BottomLightPWM < 0 || s.BottomLightPWM > 255:
+		return fmt.Errorf("settings %q: light PWM must be between 0 and 255", s.Name)
+	case s.ElephantFootUM < 0:
+		return fmt.Errorf("settings %q: elephant-foot compensation cannot be negative", s.Name)
+	}
+	if s.SupportType != SupportPillar && s.SupportType != SupportTree {
+		s.SupportType = SupportPillar
+	}
+	s.ResinBrand = strings.TrimSpace(s.ResinBrand)
+	s.ResinColor = NormalizeResinColor(s.ResinColor)
+	return nil
+}
+
+// kvSection holds the key/value lines under one [section] header of a
+// preset file; lines before the first header go in a section without a
+// name. Keys are lower-cased.
+type kvSection struct {
+	name   string
+	values map[string]string
+}
+
+// parseKeyValues reads "key = value" lines, as written by PrusaSlicer, and
+// ";key:value" lines, as in the header of Chitubox G-code.
+func parseKeyValues(data []byte) []kvSection {
+	sections := []kvSection{{values: map[string]string{}}}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			sections = append(sections, kvSection{name: line[1 : len(line)-1], values: map[string]string{}})
+			continue
+		}
+		var k, v string
+		var ok bool
+		if line[0] == ';' {
+			k, v, ok = strings.Cut(line[1:], ":")
+		} else {
+			k, v, ok = strings.Cut(line, "=")
+		}
+		if ok {
+			sections[len(sections)-1].values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+	return sections
+}
+
+func (s kvSection) has(key string) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+// float returns the first of keys that is set and numeric.
+func (s kvSection) float(keys ...string) (float64, bool) {
+	for _, k := range keys {
+		if v, err := strconv.ParseFloat(s.values[k], 64); err == nil {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+func (s kvSection) setFloat(dst *float64, keys ...string) {
+	if v, ok := s.float(keys...); ok {
+		*dst = v
+	}
+}
+
+func (s kvSection) setInt(dst *int, keys ...string) {
+	if v, ok := s.float(keys...); ok {
+		*dst = int(v)
+	}
+}
+
+// parsePrusaSLA reads PrusaSlicer SLA printer and material presets. Printer
+// and material presets made by UVtools for other printers carry extra
+// values in their notes: FILEFORMAT_PWMX in printer_notes selects the
+// output format, and BottomLayerCount_, LiftHeight_, LiftSpeed_ and
+// RetractSpeed_ (speeds in mm/min) in material_notes fill in the settings
+// PrusaSlicer has no keys for.
+func parsePrusaSLA(sections []kvSection, fileName string) (*ProfileBundle, error) {
+	b := &ProfileBundle{Version: ProfileBundleVersion}
+	var materials []models.PrintSettings
+	var compatible [][]string
+	for _, sec := range sections {
+		kind, name, _ := strings.Cut(sec.name, ":")
+		isPrinter := kind == "printer" || (sec.name == "" && sec.has("display_width"))
+		isMaterial := kind == "sla_material" || (sec.name == "" && sec.has("exposure_time"))
+		if isPrinter && sec.values["printer_technology"] != "" && sec.values["printer_technology"] != "SLA" {
+			continue
+		}
+		if isPrinter {
+			if name == "" {
+				name = firstNonEmpty(unquote(sec.values["printer_settings_id"]), fileName)
+			}
+			p, err := prusaPrinter(sec, name)
+			if err != nil {
+				return nil, err
+			}
+			b.Profiles = append(b.Profiles, BundleProfile{Profile: *p})
+		}
+		if isMaterial {
+			if name == "" || isPrinter {
+				name = firstNonEmpty(unquote(sec.values["sla_material_settings_id"]), fileName)
+			}
+			materials = append(materials, *prusaMaterial(sec, name))
+			compatible = append(compatible, splitPresetList(sec.values["compatible_printers"]))
+		}
+	}
+
+	// A material goes to the printer it is compatible with, or to the only
+	// printer of the file; otherwise it is left to the importer.
+	for i, m := range materials {
+		target := -1
+		if len(b.Profiles) == 1 {
+			target = 0
+		}
+		for j := range b.Profiles {
+			for _, c := range compatible[i] {
+				if c == b.Profiles[j].Profile.Name {
+					target = j
+				}
+			}
+		}
+		if target >= 0 {
+			b.Profiles[target].Settings = append(b.Profiles[target].Settings, m)
+		} else {
+			b.Settings = append(b.Settings, m)
+		}
+	}
+	return b, nil
+}
+
+func prusaPrinter(sec kvSection, name string) (*models.PrinterProfile, error) {
+	p := &models.PrinterProfile{Name: name, FileFormat: "sl1"}
+	sec.setFloat(&p.BuildWidthMM, "display_width")
+	sec.setFloat(&p.BuildDepthMM, "display_height")
+	sec.setFloat(&p.BuildHeightMM, "max_print_height")
+	sec.setInt(&p.ResolutionX, "display_pixels_x")
+	sec.setInt(&p.ResolutionY, "display_pixels_y")
+	if sec.values["printer_model"] == "SL1S" {
+		p.FileFormat = "sl1s"
+	}
+	if strings.HasPrefix(sec.values["printer_model"], "SL1") {
+		p.Manufacturer = "Prusa"
+	}
+	if v, ok := uvtoolsNotes(sec.values["printer_notes"])["fileformat"]; ok {
+		p.FileFormat = strings.ToLower(v)
+		if _, ok := LookupOutputFormat(p.FileFormat); !ok {
+			return nil, fmt.Errorf("printer %q: unsupported file format %q", name, v)
+		}
+	}
+	return p, nil
+}
+
+func prusaMaterial(sec kvSection, name string) *models.PrintSettings {
+	s := DefaultPrintSettings(0)
+	s.Name = name
+	sec.setFloat(&s.LayerHeightMM, "layer_height", "initial_layer_height")
+	sec.setFloat(&s.ExposureTimeS, "exposure_time")
+	sec.setFloat(&s.BottomExposureS, "initial_exposure_time")
+	sec.setInt(&s.BottomLayers, "faded_layers")
+	s.ResinBrand = unquote(sec.values["material_vendor"])
+	s.ResinColor = sec.values["material_colour"]
+	// Printer keys, present when printer and material are exported together
+	if v, ok := sec.float("absolute_correction"); ok {
+		s.XYCompensationUM = v * 1000
+	}
+	if v, ok := sec.float("elefant_foot_compensation"); ok {
+		s.ElephantFootUM = v * 1000
+	}
+
+	notes := kvSection{values: uvtoolsNotes(sec.values["material_notes"])}
+	notes.setInt(&s.BottomLayers, "bottomlayercount")
+	notes.setFloat(&s.LiftHeightMM, "liftheight")
+	if v, ok := notes.float("liftspeed"); ok {
+		s.LiftSpeedMMPS = v / 60
+	}
+	if v, ok := notes.float("retractspeed"); ok {
+		s.RetractSpeedMMPS = v / 60
+	}
+	notes.setInt(&s.TransitionLayers, "transitionlayercount")
+	notes.setFloat(&s.LightOffDelayS, "lightoffdelay")
+	notes.setFloat(&s.BottomLightOffDelayS, "bottomlightoffdelay")
+	notes.setFloat(&s.WaitBeforeCureS, "waittimebeforecure")
+	notes.setFloat(&s.WaitAfterCureS, "waittimeaftercure")
+	notes.setFloat(&s.WaitAfterLiftS, "waittimeafterlift")
+	notes.setFloat(&s.LiftHeight2MM, "liftheight2")
+	if v, ok := notes.float("liftspeed2"); ok {
+		s.LiftSpeed2MMPS = v / 60
+	}
+	notes.setFloat(&s.RetractHeight2MM, "retractheight2")
+	if v, ok := notes.float("retractspeed2"); ok {
+		s.RetractSpeed2MMPS = v / 60
+	}
+	notes.setInt(&s.LightPWM, "lightpwm")
+	notes.setInt(&s.BottomLightPWM, "bottomlightpwm")
+	return s
+}
+
+// uvtoolsNotes reads the KEY_value tokens UVtools puts in PrusaSlicer notes,
+// which are stored with their line breaks escaped as \n.
+func uvtoolsNotes(notes string) map[string]string {
+	values := map[string]string{}
+	for _, tok := range strings.Fields(strings.ReplaceAll(unquote(notes), `\n`, " ")) {
+		if i := strings.LastIndexByte(tok, '_'); i > 0 && i < len(tok)-1 {
+			values[strings.ToLower(tok[:i])] = tok[i+1:]
+		}
+	}
+	return values
+}
+
+// splitPresetList splits a PrusaSlicer list of preset names, like
+// compatible_printers = "Printer A";"Printer B".
+func splitPresetList(v string) []string {
+	var names []string
+	for _, n := range strings.Split(v, ";") {
+		if n = unquote(strings.TrimSpace(n)); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+func unquote(v string) string {
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		if s, err := strconv.Unquote(v); err == nil {
+			return s
+		}
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+func firstNonEmpty(vals ...string) string {
+	for _, v := range vals {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseChitubox reads a Chitubox/UVtools machine definition: the printer
+// from machineX/Y/Z and resolutionX/Y, and its exposure settings from
+// layerHeight, normalExposureTime, bottomLayExposureTime, bottomLayCount,
+// normalLayerLiftHeight, normalLayerLiftSpeed and normalDropSpeed (speeds
+// in mm/min) and antiAliasing. The printer is named by machineName and
+// written as CTB unless fileFormat names another output format.
+func parseChitubox(sections []kvSection, fileName string) (*ProfileBundle, error) {
+	sec := kvSection{values: map[string]string{}}
+	for _, s := range sections {
+		for k, v := range s.values {
+			sec.values[k] = v
+		}
+	}
+	if !sec.has("resolutionx") && !sec.has("normalexposuretime") {
+		return nil, fmt.Errorf("not a Chitubox machine definition: no resolutionX or normalExposureTime")
+	}
+
+	name := firstNonEmpty(sec.values["machinename"], fileName)
+	p := models.PrinterProfile{Name: name, FileFormat: "ctb"}
+	if v := sec.values["fileformat"]; v != "" {
+		p.FileFormat = strings.ToLower(strings.TrimPrefix(v, "."))
+	}
+	sec.setFloat(&p.BuildWidthMM, "machinex")
+	sec.setFloat(&p.BuildDepthMM, "machiney")
+	sec.setFloat(&p.BuildHeightMM, "machinez")
+	sec.setInt(&p.ResolutionX, "resolutionx")
+	sec.setInt(&p.ResolutionY, "resolutiony")
+
+	s := DefaultPrintSettings(0)
+	s.Name = name
+	sec.setFloat(&s.LayerHeightMM, "layerheight")
+	sec.setFloat(&s.ExposureTimeS, "normalexposuretime")
+	sec.setFloat(&s.BottomExposureS, "bottomlayexposuretime", "bottomexposuretime")
+	sec.setInt(&s.BottomLayers, "bottomlaycount", "bottomlayercount")
+	sec.setFloat(&s.LiftHeightMM, "normallayerliftheight")
+	if v, ok := sec.float("normallayerliftspeed"); ok {
+		s.LiftSpeedMMPS = v / 60
+	}
+	if v, ok := sec.float("normaldropspeed"); ok {
+		s.RetractSpeedMMPS = v / 60
+	}
+	sec.setInt(&s.AntiAliasing, "antialiasing")
+	sec.setFloat(&s.LightOffDelayS, "lightofftime")
+	sec.setFloat(&s.BottomLightOffDelayS, "bottomlightofftime")
+	sec.setInt(&s.LightPWM, "lightpwm")
+	sec.setInt(&s.BottomLightPWM, "bottomlightpwm")
+
+	b := &ProfileBundle{Version: ProfileBundleVersion}
+	if sec.has("resolutionx") {
+		b.Profiles = []BundleProfile{{Profile: p, Settings: []models.PrintSettings{*s}}}
+	} else {
+		b.Settings = []models.PrintSettings{*s}
+	}
+	return b, nil
+}
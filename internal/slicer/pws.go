@@ -0,0 +1,591 @@
+package slicer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+
+	"3dmodels/internal/models"
+)
+
+// Anycubic Photon Workshop container (.pws, .pw0, .pwmx, .pwma, .pwmo, .pwmb,
+// .px6s, .pm3, .pm3m). A file mark with the section table comes first,
+// followed by the HEADER, PREVIEW and LAYERDEF sections, the EXTRA and
+// MACHINE sections from version 516, and then the layer images. Every
+// section starts with a 12-byte name and its length.
+const (
+	pwsMark            = "ANYCUBIC"
+	pwsFileMarkSize    = 52
+	pwsSectionHeadSize = 16
+	pwsHeaderSize      = 80
+	pwsLayerDefSize    = 32
+	pwsExtraSize       = 60
+	pwsMachineSize     = 148
+	pwsPreviewWidth    = 224
+	pwsPreviewHeight   = 168
+	pwsResinDensityGML = 1.1
+)
+
+// pwsEncoding is the layer image encoding a machine's firmware reads.
+type pwsEncoding int
+
+const (
+	// pwsImgPW0 is a 4-bit grayscale RLE: full black and white runs take
+	// two bytes and up to 4095 pixels, gray runs one byte and up to 15.
+	pwsImgPW0 pwsEncoding = iota
+	// pwsImgPWS is a 1-bit RLE repeated once per anti-aliasing level; the
+	// printer sums the passes back into gray levels.
+	pwsImgPWS
+)
+
+// pwsVariant is what differs between the members of the family.
+type pwsVariant struct {
+	version  uint32
+	encoding pwsEncoding
+	machine  string
+}
+
+var pwsVariants = map[string]pwsVariant{
+	"pws":  {version: 1, encoding: pwsImgPWS, machine: "Photon S"},
+	"pw0":  {version: 1, encoding: pwsImgPW0, machine: "Photon Zero"},
+	"pwmo": {version: 515, encoding: pwsImgPW0, machine: "Photon Mono"},
+	"pwma": {version: 515, encoding: pwsImgPW0, machine: "Photon Mono 4K"},
+	"pwmx": {version: 515, encoding: pwsImgPW0, machine: "Photon Mono X"},
+	"pwmb": {version: 516, encoding: pwsImgPW0, machine: "Photon M3 Plus"},
+	"px6s": {version: 516, encoding: pwsImgPW0, machine: "Photon Mono X 6Ks"},
+	"pm3":  {version: 516, encoding: pwsImgPW0, machine: "Photon M3"},
+	"pm3m": {version: 516, encoding: pwsImgPW0, machine: "Photon M3 Max"},
+}
+
+// IsPWSFormat reports whether a format ID belongs to the Photon Workshop family.
+func IsPWSFormat(id string) bool {
+	_, ok := pwsVariants[id]
+	return ok
+}
+
+// PWSInfo describes the print recorded in a Photon Workshop file.
+type PWSInfo struct {
+	Format       string // an ID of the family, e.g. "pwmx"
+	MachineName  string // defaults to the variant's machine
+	AntiAliasing int
+	PrintTimeS   float64
+	Preview      image.Image
+}
+
+type pwsFileMark struct {
+	Mark           [12]byte
+	Version        uint32
+	TableCount     uint32
+	HeaderAddr     uint32
+	Padding1       uint32
+	PreviewAddr    uint32
+	PreviewEndAddr uint32
+	LayerDefAddr   uint32
+	ExtraAddr      uint32
+	MachineAddr    uint32
+	LayerImageAddr uint32
+}
+
+type pwsSection struct {
+	Name   [12]byte
+	Length uint32
+}
+
+type pwsHeader struct {
+	PixelSizeUM         float32
+	LayerHeightMM       float32
+	ExposureS           float32
+	LightOffDelayS      float32
+	BottomExposureS     float32
+	BottomLayers        float32
+	LiftHeightMM        float32
+	LiftSpeedMMPS       float32
+	RetractSpeedMMPS    float32
+	VolumeML            float32
+	AntiAliasing        uint32
+	ResolutionX         uint32
+	ResolutionY         uint32
+	WeightG             float32
+	Price               float32
+	PriceCurrency       uint32
+	PerLayerOverride    uint32
+	PrintTimeS          uint32
+	TransitionLayers    uint32
+	TransitionLayerType uint32
+}
+
+type pwsLayerDef struct {
+	DataAddr      uint32
+	DataLength    uint32
+	LiftHeightMM  float32
+	LiftSpeedMMPS float32
+	ExposureS     float32
+	LayerHeightMM float32
+	NonZeroPixels uint32
+	Padding       uint32
+}
+
+// pwsExtra holds the two-stage lift and retract for bottom and normal layers.
+type pwsExtra struct {
+	Size        uint32
+	BottomCount uint32
+	Bottom      [6]float32 // lift, lift speed, retract speed, then the second stage
+	NormalCount uint32
+	Normal      [6]float32
+}
+
+type pwsMachine struct {
+	Name            [96]byte
+	ImageFormat     [24]byte
+	MaxAntiAliasing uint32
+	PropertyFields  uint32
+	DisplayWidthMM  float32
+	DisplayHeightMM float32
+	MachineZMM      float32
+	MaxFileVersion  uint32
+	Background      uint32
+}
+
+// EncodePWSLayer encodes a layer for a format of the family.
+func EncodePWSLayer(img *image.Gray, format string, antiAliasing int) ([]byte, error) {
+	v, ok := pwsVariants[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown Photon Workshop format %q", format)
+	}
+	if v.encoding == pwsImgPWS {
+		return encodePWSImg(img, max(antiAliasing, 1)), nil
+	}
+	return encodePW0Img(img), nil
+}
+
+func encodePW0Img(img *image.Gray) []byte {
+	var out []byte
+	var color byte
+	run := 0
+
+	flush := func() {
+		if run == 0 {
+			return
+		}
+		if color == 0 || color == 0xf {
+			out = append(out, color<<4|byte(run>>8), byte(run))
+		} else {
+			out = append(out, color<<4|byte(run))
+		}
+	}
+
+	b := img.Bounds()
+	for y := 0; y < b.Dy(); y++ {
+		for _, v := range img.Pix[y*img.Stride : y*img.Stride+b.Dx()] {
+			c := v >> 4
+			limit := 0xf
+			if c == 0 || c == 0xf {
+				limit = 0xfff
+			}
+			if run > 0 && c == color && run < limit {
+				run++
+				continue
+			}
+			flush()
+			color, run = c, 1
+		}
+	}
+	flush()
+	return out
+}
+
+func encodePWSImg(img *image.Gray, aa int) []byte {
+	var out []byte
+	b := img.Bounds()
+	for pass := 0; pass < aa; pass++ {
+		var color byte
+		run := 0
+		flush := func() {
+			if run > 0 {
+				out = append(out, color<<7|byte(run-1))
+			}
+		}
+		for y := 0; y < b.Dy(); y++ {
+			for _, v := range img.Pix[y*img.Stride : y*img.Stride+b.Dx()] {
+				// Pass k is lit when the pixel is brighter than k of aa steps
+				var c byte
+				if int(v)*aa > pass*255+127 {
+					c = 1
+				}
+				if run > 0 && c == color && run < 128 {
+					run++
+					continue
+				}
+				flush()
+				color, run = c, 1
+			}
+		}
+		flush()
+	}
+	return out
+}
+
+// PWSWriter streams a Photon Workshop file: the sections up to the layer
+// images come first with an empty LAYERDEF table, and each layer fills in
+// its entry.
+type PWSWriter struct {
+	w            LayerOutput
+	settings     *models.PrintSettings
+	format       string
+	antiAliasing int
+	header       pwsHeader
+	headerOffset uint32
+	tableOffset  uint32
+	offset       uint32 // where the next layer's image goes
+	layers       layerCounter
+}
+
+// NewPWSWriter writes everything before the layer images of a Photon
+// Workshop file with layerCount layers. The resin volume is filled in by
+// Close.
+func NewPWSWriter(w LayerOutput, profile *models.PrinterProfile, settings *models.PrintSettings, info PWSInfo, layerCount int) (*PWSWriter, error) {
+	v, ok := pwsVariants[info.Format]
+	if !ok {
+		return nil, fmt.Errorf("unknown Photon Workshop format %q", info.Format)
+	}
+	machine := info.MachineName
+	if machine == "" {
+		machine = v.machine
+	}
+
+	var preview []byte
+	if info.Preview != nil {
+		preview = encodeRGB565(info.Preview, binary.LittleEndian)
+	} else {
+		preview = make([]byte, pwsPreviewWidth*pwsPreviewHeight*2)
+	}
+	previewLength := uint32(12 + len(preview))
+
+	// Section table
+	mark := pwsFileMark{Version: v.version, TableCount: 4}
+	copy(mark.Mark[:], pwsMark)
+	mark.HeaderAddr = pwsFileMarkSize
+	mark.PreviewAddr = mark.HeaderAddr + pwsSectionHeadSize + pwsHeaderSize
+	mark.PreviewEndAddr = mark.PreviewAddr + pwsSectionHeadSize + previewLength
+	mark.LayerDefAddr = mark.PreviewEndAddr
+	next := mark.LayerDefAddr + pwsSectionHeadSize + 4 + uint32(layerCount)*pwsLayerDefSize
+	if v.version >= 516 {
+		mark.TableCount = 6
+		mark.ExtraAddr = next
+		mark.MachineAddr = mark.ExtraAddr + pwsSectionHeadSize + pwsExtraSize
+		next = mark.MachineAddr + pwsSectionHeadSize + pwsMachineSize
+	}
+	mark.LayerImageAddr = next
+
+	liftSpeed := float32(settings.LiftSpeedMMPS)
+	header := pwsHeader{
+		PixelSizeUM:      float32(profile.PixelSizeUM),
+		LayerHeightMM:    float32(settings.LayerHeightMM),
+		ExposureS:        float32(settings.ExposureTimeS),
+		LightOffDelayS:   float32(settings.LightOffDelayS),
+		BottomExposureS:  float32(settings.BottomExposureS),
+		BottomLayers:     float32(settings.BottomLayers),
+		LiftHeightMM:     float32(settings.LiftHeightMM),
+		LiftSpeedMMPS:    liftSpeed,
+		RetractSpeedMMPS: float32(settings.RetractSpeedMMPS),
+		AntiAliasing:     uint32(max(info.AntiAliasing, 1)),
+		ResolutionX:      uint32(profile.ResolutionX),
+		ResolutionY:      uint32(profile.ResolutionY),
+		PriceCurrency:    '$',
+		PerLayerOverride: 1,
+		PrintTimeS:       uint32(info.PrintTimeS),
+		TransitionLayers: uint32(max(settings.TransitionLayers, 0)),
+	}
+
+	var buf bytes.Buffer
+	put := func(v any) {
+		binary.Write(&buf, binary.LittleEndian, v)
+	}
+	section := func(name string, length uint32) {
+		s := pwsSection{Length: length}
+		copy(s.Name[:], name)
+		put(&s)
+	}
+
+	put(&mark)
+	section("HEADER", pwsHeaderSize)
+	put(&header)
+
+	section("PREVIEW", previewLength)
+	put([]uint32{pwsPreviewWidth, 'x', pwsPreviewHeight})
+	buf.Write(preview)
+
+	// The layer definitions are filled in by WriteLayer
+	section("LAYERDEF", 4+uint32(layerCount)*pwsLayerDefSize)
+	put(uint32(layerCount))
+	tableOffset := uint32(buf.Len())
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+	if err := writeZeros(w, int64(layerCount)*pwsLayerDefSize); err != nil {
+		return nil, fmt.Errorf("write layer definitions: %w", err)
+	}
+	buf.Reset()
+
+	if v.version >= 516 {
+		// The printer splits the retract at the same height as the lift
+		stage := [6]float32{
+			float32(settings.LiftHeightMM), liftSpeed, float32(settings.RetractSpeedMMPS),
+			float32(settings.LiftHeight2MM), float32(settings.LiftSpeed2MMPS), float32(settings.RetractSpeed2MMPS),
+		}
+		section("EXTRA", pwsExtraSize)
+		put(&pwsExtra{Size: 24, BottomCount: 2, Bottom: stage, NormalCount: 2, Normal: stage})
+
+		m := pwsMachine{
+			MaxAntiAliasing: 8,
+			DisplayWidthMM:  float32(profile.BuildWidthMM),
+			DisplayHeightMM: float32(profile.BuildDepthMM),
+			MachineZMM:      float32(profile.BuildHeightMM),
+			MaxFileVersion:  v.version,
+		}
+		copy(m.Name[:], machine)
+		copy(m.ImageFormat[:], "pw0Img")
+		section("MACHINE", pwsMachineSize)
+		put(&m)
+	}
+
+	if end := tableOffset + uint32(layerCount)*pwsLayerDefSize + uint32(buf.Len()); end != mark.LayerImageAddr {
+		return nil, fmt.Errorf("Photon Workshop layout mismatch: wrote %d bytes before the layers", end)
+	}
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("write header: %w", err)
+	}
+
+	return &PWSWriter{
+		w:            w,
+		settings:     settings,
+		format:       info.Format,
+		antiAliasing: info.AntiAliasing,
+		header:       header,
+		headerOffset: mark.HeaderAddr + pwsSectionHeadSize,
+		tableOffset:  tableOffset,
+		offset:       mark.LayerImageAddr,
+		layers:       layerCounter{total: layerCount},
+	}, nil
+}
+
+// WriteLayer encodes a layer with EncodePWSLayer and appends it.
+func (pw *PWSWriter) WriteLayer(img *image.Gray) error {
+	i, err := pw.layers.take()
+	if err != nil {
+		return err
+	}
+	data, err := EncodePWSLayer(img, pw.format, pw.antiAliasing)
+	if err != nil {
+		return err
+	}
+
+	def := pwsLayerDef{
+		DataAddr:      pw.offset,
+		DataLength:    uint32(len(data)),
+		LiftHeightMM:  pw.header.LiftHeightMM,
+		LiftSpeedMMPS: pw.header.LiftSpeedMMPS,
+		ExposureS:     float32(LayerExposure(pw.settings, i)),
+		LayerHeightMM: pw.header.LayerHeightMM,
+		NonZeroPixels: uint32(exposedPixels(img)),
+	}
+	if err := writeStructAt(pw.w, binary.LittleEndian, &def, int64(pw.tableOffset)+int64(i)*pwsLayerDefSize); err != nil {
+		return fmt.Errorf("write layer definition %d: %w", i, err)
+	}
+	if _, err := pw.w.Write(data); err != nil {
+		return fmt.Errorf("write layer data %d: %w", i, err)
+	}
+	pw.offset += uint32(len(data))
+	return nil
+}
+
+// Close patches the resin volume and weight into the header.
+func (pw *PWSWriter) Close(volumeML float64) error {
+	if err := pw.layers.check(); err != nil {
+		return err
+	}
+	pw.header.VolumeML = float32(volumeML)
+	pw.header.WeightG = pw.header.VolumeML * pwsResinDensityGML
+	if err := writeStructAt(pw.w, binary.LittleEndian, &pw.header, int64(pw.headerOffset)); err != nil {
+		return fmt.Errorf("write header: %w", err)
+	}
+	return nil
+}
+
+// DecodePWS reads a file of the Photon Workshop family. The layer encoding
+// follows the variant named by format, or the file version for extensions
+// outside the family.
+func DecodePWS(r io.ReaderAt, size int64, format string) (*PrintFile, error) {
+	var mark pwsFileMark
+	if size < pwsFileMarkSize {
+		return nil, fmt.Errorf("file too small for a Photon Workshop header")
+	}
+	if err := binary.Read(io.NewSectionReader(r, 0, pwsFileMarkSize), binary.LittleEndian, &mark); err != nil {
+		return nil, fmt.Errorf("read file mark: %w", err)
+	}
+	if cString(mark.Mark[:]) != pwsMark {
+		return nil, fmt.Errorf("not a Photon Workshop file")
+	}
+	encoding := pwsImgPW0
+	if v, ok := pwsVariants[format]; ok {
+		encoding = v.encoding
+	} else if mark.Version < 515 {
+		encoding = pwsImgPWS
+	}
+
+	// section opens the named section and returns a reader over its body.
+	section := func(name string, addr uint32) (*io.SectionReader, error) {
+		var s pwsSection
+		if err := binary.Read(io.NewSectionReader(r, int64(addr), pwsSectionHeadSize), binary.LittleEndian, &s); err != nil {
+			return nil, fmt.Errorf("read %s section: %w", name, err)
+		}
+		if cString(s.Name[:]) != name {
+			return nil, fmt.Errorf("missing %s section", name)
+		}
+		if int64(addr)+pwsSectionHeadSize+int64(s.Length) > size {
+			return nil, fmt.Errorf("%s section out of bounds", name)
+		}
+		return io.NewSectionReader(r, int64(addr)+pwsSectionHeadSize, int64(s.Length)), nil
+	}
+
+	sr, err := section("HEADER", mark.HeaderAddr)
+	if err != nil {
+		return nil, err
+	}
+	var h pwsHeader
+	if err := binary.Read(sr, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	f := &PrintFile{
+		Format:           format,
+		Version:          int(mark.Version),
+		ResolutionX:      int(h.ResolutionX),
+		ResolutionY:      int(h.ResolutionY),
+		BedXMM:           float64(h.ResolutionX) * float64(h.PixelSizeUM) / 1000,
+		BedYMM:           float64(h.ResolutionY) * float64(h.PixelSizeUM) / 1000,
+		LayerHeightMM:    float64(h.LayerHeightMM),
+		ExposureS:        float64(h.ExposureS),
+		BottomExposureS:  float64(h.BottomExposureS),
+		BottomLayers:     int(h.BottomLayers),
+		LiftHeightMM:     float64(h.LiftHeightMM),
+		LiftSpeedMMPS:    float64(h.LiftSpeedMMPS),
+		RetractSpeedMMPS: float64(h.RetractSpeedMMPS),
+		AntiAliasing:     int(max(h.AntiAliasing, 1)),
+		PrintTimeS:       float64(h.PrintTimeS),
+		VolumeML:         float64(h.VolumeML),
+		r:                r,
+	}
+
+	if sr, err = section("PREVIEW", mark.PreviewAddr); err != nil {
+		return nil, err
+	}
+	var dims [3]uint32
+	if err := binary.Read(sr, binary.LittleEndian, &dims); err != nil {
+		return nil, fmt.Errorf("read preview: %w", err)
+	}
+	if n := int64(dims[0]) * int64(dims[2]) * 2; n > 0 && n <= sr.Size()-12 {
+		data := make([]byte, n)
+		if _, err := io.ReadFull(sr, data); err != nil {
+			return nil, fmt.Errorf("read preview: %w", err)
+		}
+		f.Previews = append(f.Previews, decodeRGB565(data, int(dims[0]), int(dims[2]), binary.LittleEndian))
+	}
+
+	if sr, err = section("LAYERDEF", mark.LayerDefAddr); err != nil {
+		return nil, err
+	}
+	var count uint32
+	if err := binary.Read(sr, binary.LittleEndian, &count); err != nil {
+		return nil, fmt.Errorf("read layer table: %w", err)
+	}
+	if int64(count)*pwsLayerDefSize > sr.Size()-4 {
+		return nil, fmt.Errorf("layer table out of bounds")
+	}
+	f.LayerCount = int(count)
+	for i := 0; i < f.LayerCount; i++ {
+		var def pwsLayerDef
+		if err := binary.Read(sr, binary.LittleEndian, &def); err != nil {
+			return nil, fmt.Errorf("read layer definition %d: %w", i, err)
+		}
+		f.layers = append(f.layers, printFileLayer{offset: int64(def.DataAddr), length: int(def.DataLength)})
+	}
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	if mark.TableCount >= 6 && mark.MachineAddr != 0 {
+		if sr, err = section("MACHINE", mark.MachineAddr); err != nil {
+			return nil, err
+		}
+		var m pwsMachine
+		if err := binary.Read(sr, binary.LittleEndian, &m); err != nil {
+			return nil, fmt.Errorf("read machine: %w", err)
+		}
+		f.MachineName = cString(m.Name[:])
+		f.BedXMM = float64(m.DisplayWidthMM)
+		f.BedYMM = float64(m.DisplayHeightMM)
+		f.BedZMM = float64(m.MachineZMM)
+	}
+
+	width, height, aa := f.ResolutionX, f.ResolutionY, f.AntiAliasing
+	f.decode = func(data []byte, _ int) (*image.Gray, error) {
+		if encoding == pwsImgPWS {
+			return decodePWSImg(data, width, height, aa)
+		}
+		return decodePW0Img(data, width, height)
+	}
+	return f, nil
+}
+
+// decodePW0Img is the inverse of encodePW0Img.
+func decodePW0Img(data []byte, width, height int) (*image.Gray, error) {
+	w := newRunWriter(width, height)
+	for i := 0; i < len(data); i++ {
+		c := data[i] >> 4
+		run := int(data[i] & 0xf)
+		if c == 0 || c == 0xf {
+			if i+1 >= len(data) {
+				return nil, fmt.Errorf("truncated run at byte %d", i)
+			}
+			i++
+			run = run<<8 | int(data[i])
+		}
+		if err := w.put(c<<4|c, run); err != nil {
+			return nil, err
+		}
+	}
+	return w.finish()
+}
+
+// decodePWSImg is the inverse of encodePWSImg: every pass the pixel is lit
+// in adds an equal share of full brightness.
+func decodePWSImg(data []byte, width, height, aa int) (*image.Gray, error) {
+	passes := make([]int, width*height)
+	i := 0
+	for pass := 0; pass < aa; pass++ {
+		pos := 0
+		for pos < len(passes) {
+			if i >= len(data) {
+				return nil, fmt.Errorf("pass %d has %d of %d pixels", pass, pos, len(passes))
+			}
+			run := int(data[i]&0x7f) + 1
+			if pos+run > len(passes) {
+				return nil, fmt.Errorf("run of %d pixels overflows the layer", run)
+			}
+			if data[i]&0x80 != 0 {
+				for p := pos; p < pos+run; p++ {
+					passes[p]++
+				}
+			}
+			pos += run
+			i++
+		}
+	}
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for p, n := range passes {
+		img.Pix[p] = byte(n * 255 / aa)
+	}
+	return img, nil
+}
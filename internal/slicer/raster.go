@@ -9,9 +9,31 @@ import (
 	"3dmodels/internal/models"
 )
 
+// FillRule selects which regions enclosed by contours are filled.
+type FillRule string
+
+const (
+	// FillEvenOdd fills regions crossed an odd number of times. It doesn't
+	// depend on contour orientation, but overlapping parts cancel out.
+	FillEvenOdd FillRule = "evenodd"
+	// FillNonZero fills regions with a nonzero winding number, which unions
+	// overlapping parts. It needs consistently oriented contours.
+	FillNonZero FillRule = "nonzero"
+	// FillPositive fills regions with a positive winding number. Contours
+	// offset by OffsetContours need it, so collapsed walls stay empty.
+	FillPositive FillRule = "positive"
+)
+
+// scanCrossing is an edge crossing on a scanline; dir is +1 for upward edges
+// and -1 for downward ones.
+type scanCrossing struct {
+	x   float64
+	dir int
+}
+
 // RasterizeLayer converts contours to a grayscale bitmap for a printer profile.
 // offsetX, offsetY are the center coordinates of the model on the build plate (in mm).
-func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX, offsetY float64) *image.Gray {
+func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX, offsetY float64, rule FillRule) *image.Gray {
 	width := profile.ResolutionX
 	height := profile.ResolutionY
 
@@ -36,14 +58,16 @@ func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX,
 		return img
 	}
 
-	// For each scanline (row), find intersections with contour edges and fill using even-odd rule
+	// For each scanline (row), find intersections with contour edges and fill
+	// the spans selected by the fill rule
+	var intersections []scanCrossing
 	for y := 0; y < height; y++ {
 		// Convert pixel Y to mm coordinate
 		// Pixel (0,0) is top-left; mm origin is bottom-left of build plate
 		mmY := offsetY + (float64(height)/2.0-float64(y))*pixelSize
 
 		// Collect all X intersections for this scanline
-		var intersections []float64
+		intersections = intersections[:0]
 
 		for _, contour := range contours {
 			n := len(contour)
@@ -57,7 +81,11 @@ func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX,
 					// Calculate X intersection
 					t := (mmY - p1.Y) / (p2.Y - p1.Y)
 					xIntersect := p1.X + t*(p2.X-p1.X)
-					intersections = append(intersections, xIntersect)
+					dir := 1
+					if p2.Y < p1.Y {
+						dir = -1
+					}
+					intersections = append(intersections, scanCrossing{x: xIntersect, dir: dir})
 				}
 			}
 		}
@@ -67,13 +95,11 @@ func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX,
 		}
 
 		// Sort intersections
-		sort.Float64s(intersections)
-
-		// Fill between pairs (even-odd rule)
-		for k := 0; k+1 < len(intersections); k += 2 {
-			xStart := intersections[k]
-			xEnd := intersections[k+1]
+		sort.Slice(intersections, func(i, j int) bool {
+			return intersections[i].x < intersections[j].x
+		})
 
+		fillSpan := func(xStart, xEnd float64) {
 			// Convert mm to pixel
 			pxStart := int(math.Round((xStart - offsetX + float64(width)/2.0*pixelSize) / pixelSize))
 			pxEnd := int(math.Round((xEnd - offsetX + float64(width)/2.0*pixelSize) / pixelSize))
@@ -89,6 +115,29 @@ func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX,
 				img.SetGray(px, y, color.Gray{Y: 255})
 			}
 		}
+
+		if rule == FillNonZero || rule == FillPositive {
+			// Fill while the winding number is nonzero (or positive).
+			// Counted from the left, counter-clockwise contours give -1.
+			filled := func(w int) bool { return w < 0 || (w > 0 && rule == FillNonZero) }
+			winding := 0
+			spanStart := 0.0
+			for _, c := range intersections {
+				prev := winding
+				winding += c.dir
+				if !filled(prev) && filled(winding) {
+					spanStart = c.x
+				} else if filled(prev) && !filled(winding) {
+					fillSpan(spanStart, c.x)
+				}
+			}
+			continue
+		}
+
+		// Fill between pairs (even-odd rule)
+		for k := 0; k+1 < len(intersections); k += 2 {
+			fillSpan(intersections[k].x, intersections[k+1].x)
+		}
 	}
 
 	return img
@@ -96,9 +145,9 @@ func RasterizeLayer(contours []Contour, profile *models.PrinterProfile, offsetX,
 
 // RasterizeLayerAA renders at higher resolution and downsamples for anti-aliasing.
 // aaLevel must be 2, 4, or 8.
-func RasterizeLayerAA(contours []Contour, profile *models.PrinterProfile, offsetX, offsetY float64, aaLevel int) *image.Gray {
+func RasterizeLayerAA(contours []Contour, profile *models.PrinterProfile, offsetX, offsetY float64, aaLevel int, rule FillRule) *image.Gray {
 	if aaLevel <= 1 {
-		return RasterizeLayer(contours, profile, offsetX, offsetY)
+		return RasterizeLayer(contours, profile, offsetX, offsetY, rule)
 	}
 
 	// Create a higher-resolution profile
@@ -111,7 +160,7 @@ func RasterizeLayerAA(contours []Contour, profile *models.PrinterProfile, offset
 		PixelSizeUM:   profile.PixelSizeUM / float64(aaLevel),
 	}
 
-	hiImg := RasterizeLayer(contours, hiRes, offsetX, offsetY)
+	hiImg := RasterizeLayer(contours, hiRes, offsetX, offsetY, rule)
 
 	// Downsample
 	width := profile.ResolutionX
@@ -133,3 +182,13 @@ func RasterizeLayerAA(contours []Contour, profile *models.PrinterProfile, offset
 
 	return result
 }
+
+// exposedPixels returns how many pixels a layer cures, counting partially
+// lit anti-aliased pixels by their gray level.
+func exposedPixels(img *image.Gray) float64 {
+	sum := 0
+	for _, v := range img.Pix {
+		sum += int(v)
+	}
+	return float64(sum) / 255
+}
@@ -0,0 +1,448 @@
+package slicer
+
+import (
+	"math"
+
+	"3dmodels/internal/models"
+)
+
+const (
+	weldEpsilon       = 0.0001 // mm, vertices closer than this are merged
+	degenerateAreaEps = 1e-10  // mm², faces with a smaller area are dropped
+	maxHoleEdges      = 64     // holes with more boundary edges are left open
+
+	// The nesting of closed shells is only worked out up to these limits;
+	// beyond them shells are turned outwards by the sign of their volume.
+	maxNestingShells    = 2000
+	maxNestingFaceTests = 20_000_000 // ray-triangle tests for the whole mesh
+)
+
+// indexedMesh is the shared-vertex representation used while repairing.
+type indexedMesh struct {
+	verts [][3]float64
+	faces [][3]int
+}
+
+type edgeKey struct {
+	a, b int
+}
+
+// RepairMesh welds vertices, drops degenerate and duplicate faces, makes the
+// winding of every shell consistent and outward facing, and closes small
+// holes. The mesh is rewritten in place; the report describes what was found.
+func RepairMesh(m *Mesh) *models.MeshRepairReport {
+	report := &models.MeshRepairReport{InputTriangles: len(m.Triangles)}
+
+	im := weldVertices(m, report)
+	im.removeDegenerate(report)
+	im.fixWinding(report)
+	im.closeHoles(report)
+
+	// Count what is left after repair
+	for _, faces := range im.edgeFaces() {
+		switch {
+		case len(faces) == 1:
+			report.BoundaryEdges++
+		case len(faces) > 2:
+			report.NonManifoldEdges++
+		}
+	}
+
+	im.toMesh(m)
+	report.OutputTriangles = len(m.Triangles)
+	return report
+}
+
+// weldVertices merges vertices closer than weldEpsilon. Cells are
+// weldEpsilon wide, so a close vertex is always in the same cell or one of
+// its 26 neighbours, even across a cell boundary.
+func weldVertices(m *Mesh, report *models.MeshRepairReport) *indexedMesh {
+	type cell [3]int64
+	lookup := make(map[cell][]int, len(m.Triangles))
+	im := &indexedMesh{faces: make([][3]int, 0, len(m.Triangles))}
+
+	index := func(v [3]float32) int {
+		p := [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}
+		k := cell{
+			int64(math.Floor(p[0] / weldEpsilon)),
+			int64(math.Floor(p[1] / weldEpsilon)),
+			int64(math.Floor(p[2] / weldEpsilon)),
+		}
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, i := range lookup[cell{k[0] + dx, k[1] + dy, k[2] + dz}] {
+						q := im.verts[i]
+						if math.Hypot(math.Hypot(p[0]-q[0], p[1]-q[1]), p[2]-q[2]) < weldEpsilon {
+							return i
+						}
+					}
+				}
+			}
+		}
+		i := len(im.verts)
+		im.verts = append(im.verts, p)
+		lookup[k] = append(lookup[k], i)
+		return i
+	}
+
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		im.faces = append(im.faces, [3]int{index(t.V1), index(t.V2), index(t.V3)})
+	}
+
+	report.WeldedVertices = len(m.Triangles)*3 - len(im.verts)
+	return im
+}
+
+func (im *indexedMesh) faceArea(f [3]int) float64 {
+	a, b, c := im.verts[f[0]], im.verts[f[1]], im.verts[f[2]]
+	ux, uy, uz := b[0]-a[0], b[1]-a[1], b[2]-a[2]
+	vx, vy, vz := c[0]-a[0], c[1]-a[1], c[2]-a[2]
+	nx := uy*vz - uz*vy
+	ny := uz*vx - ux*vz
+	nz := ux*vy - uy*vx
+	return math.Sqrt(nx*nx+ny*ny+nz*nz) / 2
+}
+
+func (im *indexedMesh) removeDegenerate(report *models.MeshRepairReport) {
+	seen := make(map[[3]int]bool, len(im.faces))
+	kept := im.faces[:0]
+	for _, f := range im.faces {
+		if f[0] == f[1] || f[1] == f[2] || f[2] == f[0] || im.faceArea(f) < degenerateAreaEps {
+			report.DegenerateFaces++
+			continue
+		}
+		// Duplicates are detected regardless of winding
+		key := sortedFace(f)
+		if seen[key] {
+			report.DuplicateFaces++
+			continue
+		}
+		seen[key] = true
+		kept = append(kept, f)
+	}
+	im.faces = kept
+}
+
+func sortedFace(f [3]int) [3]int {
+	if f[0] > f[1] {
+		f[0], f[1] = f[1], f[0]
+	}
+	if f[1] > f[2] {
+		f[1], f[2] = f[2], f[1]
+	}
+	if f[0] > f[1] {
+		f[0], f[1] = f[1], f[0]
+	}
+	return f
+}
+
+// edgeFaces maps every undirected edge to the faces that use it.
+func (im *indexedMesh) edgeFaces() map[edgeKey][]int {
+	edges := make(map[edgeKey][]int, len(im.faces)*3/2)
+	for fi, f := range im.faces {
+		for k := 0; k < 3; k++ {
+			a, b := f[k], f[(k+1)%3]
+			if a > b {
+				a, b = b, a
+			}
+			key := edgeKey{a, b}
+			edges[key] = append(edges[key], fi)
+		}
+	}
+	return edges
+}
+
+// hasDirectedEdge reports whether face f traverses the edge a->b.
+func hasDirectedEdge(f [3]int, a, b int) bool {
+	for k := 0; k < 3; k++ {
+		if f[k] == a && f[(k+1)%3] == b {
+			return true
+		}
+	}
+	return false
+}
+
+// fixWinding walks each shell across its manifold edges, flipping faces whose
+// orientation disagrees with their neighbour. Closed shells are then turned
+// to face away from the solid: outwards when enclosed by an even number of
+// other closed shells, inwards (a cavity) when by an odd number. Open shells
+// keep their winding, as their signed volume depends on the origin. Past
+// maxNestingShells closed shells, or maxNestingFaceTests, the nesting is not
+// checked and report.UnnestedShells counts the shells taken to be outermost.
+func (im *indexedMesh) fixWinding(report *models.MeshRepairReport) {
+	edges := im.edgeFaces()
+	shell := make([]int, len(im.faces))
+	for i := range shell {
+		shell[i] = -1
+	}
+	flipped := make([]bool, len(im.faces))
+
+	var shellFaces [][]int
+	for start := range im.faces {
+		if shell[start] >= 0 {
+			continue
+		}
+		id := len(shellFaces)
+		shell[start] = id
+		members := []int{start}
+		queue := []int{start}
+		for len(queue) > 0 {
+			fi := queue[0]
+			queue = queue[1:]
+			f := im.faces[fi]
+			for k := 0; k < 3; k++ {
+				a, b := f[k], f[(k+1)%3]
+				lo, hi := a, b
+				if lo > hi {
+					lo, hi = hi, lo
+				}
+				neighbours := edges[edgeKey{lo, hi}]
+				if len(neighbours) != 2 {
+					continue
+				}
+				ni := neighbours[0]
+				if ni == fi {
+					ni = neighbours[1]
+				}
+				if shell[ni] >= 0 {
+					continue
+				}
+				// A consistently wound neighbour traverses the shared edge as b->a
+				if hasDirectedEdge(im.faces[ni], a, b) {
+					n := im.faces[ni]
+					im.faces[ni] = [3]int{n[0], n[2], n[1]}
+					flipped[ni] = !flipped[ni]
+				}
+				shell[ni] = id
+				members = append(members, ni)
+				queue = append(queue, ni)
+			}
+		}
+		shellFaces = append(shellFaces, members)
+	}
+	report.Shells = len(shellFaces)
+
+	closed := make([]bool, len(shellFaces))
+	for i := range closed {
+		closed[i] = true
+	}
+	for _, faces := range edges {
+		if len(faces) == 1 {
+			closed[shell[faces[0]]] = false
+		}
+	}
+	bounds := make([][2][3]float64, len(shellFaces))
+	closedCount := 0
+	for i, members := range shellFaces {
+		if closed[i] {
+			bounds[i] = im.faceBounds(members)
+			closedCount++
+		}
+	}
+	tests := 0
+	for i, members := range shellFaces {
+		if !closed[i] {
+			continue
+		}
+		volume := 0.0
+		for _, fi := range members {
+			f := im.faces[fi]
+			a, b, c := im.verts[f[0]], im.verts[f[1]], im.verts[f[2]]
+			volume += a[0]*(b[1]*c[2]-b[2]*c[1]) - a[1]*(b[0]*c[2]-b[2]*c[0]) + a[2]*(b[0]*c[1]-b[1]*c[0])
+		}
+		depth := 0
+		p := im.verts[im.faces[members[0]][0]]
+		if closedCount > maxNestingShells {
+			report.UnnestedShells++
+		} else {
+			for j, other := range shellFaces {
+				if j == i || !closed[j] || !insideBounds(p, bounds[j]) {
+					continue
+				}
+				if tests += len(other); tests > maxNestingFaceTests {
+					report.UnnestedShells++
+					depth = 0
+					break
+				}
+				if im.encloses(other, p) {
+					depth++
+				}
+			}
+		}
+		if (volume >= 0) == (depth%2 == 0) {
+			continue
+		}
+		report.InvertedShells++
+		for _, fi := range members {
+			f := im.faces[fi]
+			im.faces[fi] = [3]int{f[0], f[2], f[1]}
+			flipped[fi] = !flipped[fi]
+		}
+	}
+
+	for _, f := range flipped {
+		if f {
+			report.FlippedFaces++
+		}
+	}
+}
+
+// faceBounds returns the bounding box of the given faces.
+func (im *indexedMesh) faceBounds(faces []int) [2][3]float64 {
+	b := [2][3]float64{
+		{math.Inf(1), math.Inf(1), math.Inf(1)},
+		{math.Inf(-1), math.Inf(-1), math.Inf(-1)},
+	}
+	for _, fi := range faces {
+		for _, vi := range im.faces[fi] {
+			for k, c := range im.verts[vi] {
+				b[0][k] = math.Min(b[0][k], c)
+				b[1][k] = math.Max(b[1][k], c)
+			}
+		}
+	}
+	return b
+}
+
+func insideBounds(p [3]float64, b [2][3]float64) bool {
+	for k := 0; k < 3; k++ {
+		if p[k] < b[0][k] || p[k] > b[1][k] {
+			return false
+		}
+	}
+	return true
+}
+
+// shellRayDir is the direction of the rays cast by encloses, tilted off the
+// axes so they don't run along the edges of axis-aligned faces.
+var shellRayDir = normalize([3]float64{1, 0.0137, 0.0071})
+
+// encloses reports whether the closed shell made of faces contains p: a ray
+// from p crosses it an odd number of times.
+func (im *indexedMesh) encloses(faces []int, p [3]float64) bool {
+	crossings := 0
+	for _, fi := range faces {
+		f := im.faces[fi]
+		if rayHitsTriangle(p, shellRayDir, im.verts[f[0]], im.verts[f[1]], im.verts[f[2]]) {
+			crossings++
+		}
+	}
+	return crossings%2 == 1
+}
+
+// rayHitsTriangle intersects the ray o + t*d, t > 0, with triangle abc
+// (Möller-Trumbore).
+func rayHitsTriangle(o, d, a, b, c [3]float64) bool {
+	const eps = 1e-12
+	e1 := [3]float64{b[0] - a[0], b[1] - a[1], b[2] - a[2]}
+	e2 := [3]float64{c[0] - a[0], c[1] - a[1], c[2] - a[2]}
+	h := cross(d, e2)
+	det := e1[0]*h[0] + e1[1]*h[1] + e1[2]*h[2]
+	if math.Abs(det) < eps {
+		return false
+	}
+	s := [3]float64{o[0] - a[0], o[1] - a[1], o[2] - a[2]}
+	u := (s[0]*h[0] + s[1]*h[1] + s[2]*h[2]) / det
+	if u < 0 || u > 1 {
+		return false
+	}
+	q := cross(s, e1)
+	v := (d[0]*q[0] + d[1]*q[1] + d[2]*q[2]) / det
+	if v < 0 || u+v > 1 {
+		return false
+	}
+	return (e2[0]*q[0]+e2[1]*q[1]+e2[2]*q[2])/det > eps
+}
+
+// closeHoles finds boundary loops and fills those with at most maxHoleEdges
+// edges with a fan around the loop centroid.
+func (im *indexedMesh) closeHoles(report *models.MeshRepairReport) {
+	edges := im.edgeFaces()
+
+	// For every boundary edge a->b of a face, the hole runs b->a.
+	next := make(map[int]int)
+	ambiguous := make(map[int]bool)
+	for key, faces := range edges {
+		if len(faces) != 1 {
+			continue
+		}
+		f := im.faces[faces[0]]
+		a, b := key.a, key.b
+		if !hasDirectedEdge(f, a, b) {
+			a, b = b, a
+		}
+		if _, ok := next[b]; ok {
+			ambiguous[b] = true
+		}
+		next[b] = a
+	}
+
+	visited := make(map[int]bool)
+	for start := range next {
+		if visited[start] || ambiguous[start] {
+			continue
+		}
+
+		loop := []int{start}
+		visited[start] = true
+		cur := next[start]
+		closed := false
+		for len(loop) <= maxHoleEdges {
+			if cur == start {
+				closed = true
+				break
+			}
+			if visited[cur] || ambiguous[cur] {
+				break
+			}
+			visited[cur] = true
+			loop = append(loop, cur)
+			n, ok := next[cur]
+			if !ok {
+				break
+			}
+			cur = n
+		}
+
+		if !closed || len(loop) < 3 {
+			report.OpenHoles++
+			continue
+		}
+
+		if len(loop) == 3 {
+			im.faces = append(im.faces, [3]int{loop[0], loop[1], loop[2]})
+		} else {
+			var c [3]float64
+			for _, v := range loop {
+				for k := 0; k < 3; k++ {
+					c[k] += im.verts[v][k]
+				}
+			}
+			for k := 0; k < 3; k++ {
+				c[k] /= float64(len(loop))
+			}
+			ci := len(im.verts)
+			im.verts = append(im.verts, c)
+			for i := range loop {
+				im.faces = append(im.faces, [3]int{loop[i], loop[(i+1)%len(loop)], ci})
+			}
+		}
+		report.HolesClosed++
+	}
+}
+
+func (im *indexedMesh) toMesh(m *Mesh) {
+	out := newEmptyMesh()
+	out.Triangles = make([]Triangle, 0, len(im.faces))
+	for _, f := range im.faces {
+		var v [3][3]float32
+		for k := 0; k < 3; k++ {
+			p := im.verts[f[k]]
+			v[k] = [3]float32{float32(p[0]), float32(p[1]), float32(p[2])}
+		}
+		out.addTriangle(v[0], v[1], v[2])
+	}
+	*m = *out
+}
@@ -0,0 +1,88 @@
+package slicer
+
+import (
+	"strconv"
+	"strings"
+
+	"3dmodels/internal/models"
+)
+
+// DefaultPrintSettings returns the settings used for new profiles.
+func DefaultPrintSettings(profileID int64) *models.PrintSettings {
+	return &models.PrintSettings{
+		ProfileID:            profileID,
+		LayerHeightMM:        0.05,
+		ExposureTimeS:        2.0,
+		BottomExposureS:      30.0,
+		BottomLayers:         5,
+		LiftHeightMM:         6.0,
+		LiftSpeedMMPS:        2.0,
+		RetractSpeedMMPS:     4.0,
+		AntiAliasing:         1,
+		LightPWM:             255,
+		BottomLightPWM:       255,
+		HollowWallMM:         2.0,
+		InfillThicknessMM:    1.0,
+		DrainHoleDiameterMM:  3.0,
+		SupportType:          SupportPillar,
+		SupportTipDiameterMM: 0.4,
+		SupportDensityPct:    50,
+		SupportAngleDeg:      45,
+	}
+}
+
+// LayerExposure returns the exposure of layer i (from 0): the bottom exposure
+// for the bottom layers, then TransitionLayers equal steps down to the normal
+// exposure.
+func LayerExposure(settings *models.PrintSettings, i int) float64 {
+	if i < settings.BottomLayers {
+		return settings.BottomExposureS
+	}
+	t := i - settings.BottomLayers
+	if t < settings.TransitionLayers {
+		step := (settings.BottomExposureS - settings.ExposureTimeS) / float64(settings.TransitionLayers+1)
+		return settings.BottomExposureS - step*float64(t+1)
+	}
+	return settings.ExposureTimeS
+}
+
+// LayerLightOffDelay returns the light-off delay of layer i.
+func LayerLightOffDelay(settings *models.PrintSettings, i int) float64 {
+	if i < settings.BottomLayers {
+		return settings.BottomLightOffDelayS
+	}
+	return settings.LightOffDelayS
+}
+
+// lightPWM returns a light PWM value in 1-255; 0 or out-of-range values mean
+// full power.
+func lightPWM(v int) uint16 {
+	if v <= 0 || v > 255 {
+		return 255
+	}
+	return uint16(v)
+}
+
+// retractHeights splits the retract into its fast first stage and slow
+// second stage. The retract covers the whole lift distance.
+func retractHeights(settings *models.PrintSettings) (first, second float64) {
+	total := settings.LiftHeightMM + settings.LiftHeight2MM
+	second = settings.RetractHeight2MM
+	if second > total {
+		second = total
+	}
+	return total - second, second
+}
+
+// NormalizeResinColor returns a resin color as lower-case #rrggbb, or ""
+// if it is not one.
+func NormalizeResinColor(c string) string {
+	c = strings.ToLower(strings.TrimSpace(c))
+	if len(c) != 7 || c[0] != '#' {
+		return ""
+	}
+	if _, err := strconv.ParseUint(c[1:], 16, 32); err != nil {
+		return ""
+	}
+	return c
+}
@@ -0,0 +1,396 @@
+package slicer
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"3dmodels/internal/models"
+)
+
+// Prusa SL1/SL1S archive (.sl1, .sl1s): a ZIP holding config.ini for the
+// printer, prusaslicer.ini with the full configuration, one grayscale PNG per
+// layer and the thumbnails shown on the printer's screen.
+const (
+	sl1FastTiltS = 5.0 // tilt time the printer uses between layers
+	sl1SlowTiltS = 8.0
+)
+
+// sl1Thumbnails are the thumbnail sizes the SL1 firmware and PrusaSlicer expect.
+var sl1Thumbnails = [][2]int{{400, 400}, {800, 480}}
+
+// SL1Info describes the print recorded in an SL1 archive.
+type SL1Info struct {
+	JobName      string // prefix of the layer file names
+	PrinterModel string // "SL1" or "SL1S"
+	PrintTimeS   float64
+	Supports     bool
+	Hollow       bool
+	Thumbnails   []image.Image
+}
+
+// EncodeSL1Layer encodes a layer as the PNG the printer displays. The SL1
+// panels are mounted in portrait, so the landscape layer is transposed.
+func EncodeSL1Layer(img *image.Gray) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, transposeGray(img)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// SL1Writer streams an SL1 archive, storing each layer PNG as it comes.
+type SL1Writer struct {
+	zw       *zip.Writer
+	profile  *models.PrinterProfile
+	settings *models.PrintSettings
+	info     SL1Info
+	jobName  string
+	layers   layerCounter
+}
+
+// NewSL1Writer starts an SL1 archive with layerCount layers, writing the
+// slicer configuration and the thumbnails. config.ini, which holds the
+// resin used, is written by Close; the printer finds it through the ZIP
+// directory, wherever it is stored.
+func NewSL1Writer(w io.Writer, profile *models.PrinterProfile, settings *models.PrintSettings, info SL1Info, layerCount int) (*SL1Writer, error) {
+	zw := zip.NewWriter(w)
+
+	if err := writeZipText(zw, "prusaslicer.ini", sl1SlicerConfig(profile, settings, info)); err != nil {
+		return nil, fmt.Errorf("write prusaslicer.ini: %w", err)
+	}
+
+	for _, thumb := range info.Thumbnails {
+		b := thumb.Bounds()
+		f, err := zw.Create(fmt.Sprintf("thumbnail/thumbnail%dx%d.png", b.Dx(), b.Dy()))
+		if err != nil {
+			return nil, fmt.Errorf("write thumbnail: %w", err)
+		}
+		if err := png.Encode(f, thumb); err != nil {
+			return nil, fmt.Errorf("encode thumbnail: %w", err)
+		}
+	}
+
+	return &SL1Writer{
+		zw:       zw,
+		profile:  profile,
+		settings: settings,
+		info:     info,
+		jobName:  sl1JobName(info.JobName),
+		layers:   layerCounter{total: layerCount},
+	}, nil
+}
+
+// WriteLayer encodes a layer with EncodeSL1Layer and stores it.
+func (sw *SL1Writer) WriteLayer(img *image.Gray) error {
+	i, err := sw.layers.take()
+	if err != nil {
+		return err
+	}
+	data, err := EncodeSL1Layer(img)
+	if err != nil {
+		return fmt.Errorf("encode layer %d: %w", i, err)
+	}
+
+	// The PNGs are already deflated, storing them again saves time
+	f, err := sw.zw.CreateHeader(&zip.FileHeader{
+		Name:     fmt.Sprintf("%s%05d.png", sw.jobName, i),
+		Method:   zip.Store,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("write layer %d: %w", i, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("write layer %d: %w", i, err)
+	}
+	return nil
+}
+
+// Close writes config.ini and the ZIP directory.
+func (sw *SL1Writer) Close(volumeML float64) error {
+	if err := sw.layers.check(); err != nil {
+		return err
+	}
+	if err := writeZipText(sw.zw, "config.ini", sl1Config(sw.profile, sw.settings, sw.info, sw.jobName, sw.layers.total, volumeML)); err != nil {
+		return fmt.Errorf("write config.ini: %w", err)
+	}
+	return sw.zw.Close()
+}
+
+func sl1Config(profile *models.PrinterProfile, settings *models.PrintSettings, info SL1Info, jobName string, layerCount int, usedMaterialML float64) []iniEntry {
+	return []iniEntry{
+		{"action", "print"},
+		{"expTime", formatINIFloat(settings.ExposureTimeS)},
+		{"expTimeFirst", formatINIFloat(settings.BottomExposureS)},
+		{"fileCreationTimestamp", time.Now().UTC().Format("2006-01-02 at 15:04:05 UTC")},
+		{"hollow", formatINIBool(info.Hollow)},
+		{"jobDir", jobName},
+		{"layerHeight", formatINIFloat(settings.LayerHeightMM)},
+		{"materialName", settings.Name},
+		{"numFade", fmt.Sprintf("%d", settings.BottomLayers)},
+		{"numFast", fmt.Sprintf("%d", layerCount)},
+		{"numSlow", "0"},
+		{"printProfile", settings.Name},
+		{"printTime", formatINIFloat(info.PrintTimeS)},
+		{"printerModel", info.PrinterModel},
+		{"printerProfile", profile.Name},
+		{"printerVariant", "default"},
+		{"prusaSlicerVersion", "3dmodels"},
+		{"usedMaterial", formatINIFloat(usedMaterialML)},
+	}
+}
+
+func sl1SlicerConfig(profile *models.PrinterProfile, settings *models.PrintSettings, info SL1Info) []iniEntry {
+	thumbs := make([]string, len(sl1Thumbnails))
+	for i, t := range sl1Thumbnails {
+		thumbs[i] = fmt.Sprintf("%dx%d", t[0], t[1])
+	}
+	return []iniEntry{
+		{"display_height", formatINIFloat(profile.BuildDepthMM)},
+		{"display_mirror_x", "0"},
+		{"display_mirror_y", "0"},
+		{"display_orientation", "portrait"},
+		{"display_pixels_x", fmt.Sprintf("%d", profile.ResolutionX)},
+		{"display_pixels_y", fmt.Sprintf("%d", profile.ResolutionY)},
+		{"display_width", formatINIFloat(profile.BuildWidthMM)},
+		{"exposure_time", formatINIFloat(settings.ExposureTimeS)},
+		{"faded_layers", fmt.Sprintf("%d", settings.BottomLayers)},
+		{"fast_tilt_time", formatINIFloat(sl1FastTiltS)},
+		{"hollowing_enable", formatINIBool(info.Hollow)},
+		{"initial_exposure_time", formatINIFloat(settings.BottomExposureS)},
+		{"initial_layer_height", formatINIFloat(settings.LayerHeightMM)},
+		{"layer_height", formatINIFloat(settings.LayerHeightMM)},
+		{"max_print_height", formatINIFloat(profile.BuildHeightMM)},
+		{"printer_model", info.PrinterModel},
+		{"printer_settings_id", profile.Name},
+		{"printer_technology", "SLA"},
+		{"printer_variant", "default"},
+		{"sla_archive_format", "SL1"},
+		{"sla_material_settings_id", settings.Name},
+		{"slow_tilt_time", formatINIFloat(sl1SlowTiltS)},
+		{"supports_enable", formatINIBool(info.Supports)},
+		{"thumbnails", strings.Join(thumbs, ",")},
+	}
+}
+
+// SL1PrintTime estimates the print time the SL1 firmware reports: every
+// layer is exposed and then tilted, with the first layers fading from the
+// bottom exposure to the normal one.
+func SL1PrintTime(settings *models.PrintSettings, layerCount int) float64 {
+	total := 0.0
+	fade := settings.BottomLayers
+	for i := 0; i < layerCount; i++ {
+		exp := settings.ExposureTimeS
+		if i < fade {
+			exp = settings.BottomExposureS + (settings.ExposureTimeS-settings.BottomExposureS)*float64(i)/float64(fade)
+		}
+		total += exp + sl1FastTiltS
+	}
+	return total
+}
+
+// sl1JobName keeps the characters that are safe in the layer file names.
+func sl1JobName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ' || r == '.':
+			b.WriteByte('_')
+		}
+	}
+	if b.Len() == 0 {
+		return "model"
+	}
+	return b.String()
+}
+
+type iniEntry struct {
+	key, value string
+}
+
+func writeZipText(zw *zip.Writer, name string, entries []iniEntry) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(f, "%s = %s\n", e.key, e.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatINIFloat(v float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", v), "0"), ".")
+}
+
+func formatINIBool(v bool) string {
+	if v {
+		return "1"
+	}
+	return "0"
+}
+
+// DecodeSL1 reads an SL1 archive: the print parameters from config.ini and
+// prusaslicer.ini, the thumbnails and the layer PNGs. Portrait layers are
+// transposed back to the landscape layout the slicer rasterizes in.
+func DecodeSL1(r io.ReaderAt, size int64) (*PrintFile, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not an SL1 archive: %w", err)
+	}
+
+	ini := map[string]string{}
+	files := map[string]*zip.File{}
+	for _, zf := range zr.File {
+		files[zf.Name] = zf
+	}
+	for _, name := range []string{"prusaslicer.ini", "config.ini"} {
+		zf, ok := files[name]
+		if !ok {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", name, err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if k, v, ok := strings.Cut(line, "="); ok {
+				ini[strings.TrimSpace(k)] = strings.TrimSpace(v)
+			}
+		}
+	}
+	if _, ok := files["config.ini"]; !ok {
+		return nil, fmt.Errorf("not an SL1 archive: missing config.ini")
+	}
+
+	num := func(key string) float64 {
+		v, _ := strconv.ParseFloat(ini[key], 64)
+		return v
+	}
+	f := &PrintFile{
+		Format:          "sl1",
+		Version:         1,
+		MachineName:     ini["printerModel"],
+		ResolutionX:     int(num("display_pixels_x")),
+		ResolutionY:     int(num("display_pixels_y")),
+		BedXMM:          num("display_width"),
+		BedYMM:          num("display_height"),
+		BedZMM:          num("max_print_height"),
+		LayerHeightMM:   num("layerHeight"),
+		ExposureS:       num("expTime"),
+		BottomExposureS: num("expTimeFirst"),
+		BottomLayers:    int(num("numFade")),
+		AntiAliasing:    1,
+		PrintTimeS:      num("printTime"),
+		VolumeML:        num("usedMaterial"),
+		r:               r,
+	}
+	if f.MachineName == "SL1S" {
+		f.Format = "sl1s"
+	}
+
+	var thumbs, layers []*zip.File
+	jobDir := ini["jobDir"]
+	for _, zf := range zr.File {
+		switch {
+		case strings.HasPrefix(zf.Name, "thumbnail/") && strings.HasSuffix(zf.Name, ".png"):
+			thumbs = append(thumbs, zf)
+		case !strings.Contains(zf.Name, "/") && strings.HasPrefix(zf.Name, jobDir) && strings.HasSuffix(zf.Name, ".png"):
+			layers = append(layers, zf)
+		}
+	}
+	for _, zf := range thumbs {
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", zf.Name, err)
+		}
+		img, err := png.Decode(rc)
+		rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", zf.Name, err)
+		}
+		f.Previews = append(f.Previews, img)
+	}
+
+	// Layer names end in a zero-padded index, so they sort in print order
+	sort.Slice(layers, func(i, j int) bool { return layers[i].Name < layers[j].Name })
+	methods := make([]uint16, len(layers))
+	for i, zf := range layers {
+		offset, err := zf.DataOffset()
+		if err != nil {
+			return nil, fmt.Errorf("locate %s: %w", zf.Name, err)
+		}
+		f.layers = append(f.layers, printFileLayer{offset: offset, length: int(zf.CompressedSize64)})
+		methods[i] = zf.Method
+	}
+	f.LayerCount = len(f.layers)
+	if err := f.checkLayerBounds(size); err != nil {
+		return nil, err
+	}
+
+	portrait := ini["display_orientation"] != "landscape"
+	f.decode = func(data []byte, layer int) (*image.Gray, error) {
+		var rd io.Reader = bytes.NewReader(data)
+		if methods[layer] == zip.Deflate {
+			fr := flate.NewReader(rd)
+			defer fr.Close()
+			rd = fr
+		}
+		img, err := png.Decode(rd)
+		if err != nil {
+			return nil, err
+		}
+		gray := toGray(img)
+		if portrait {
+			gray = transposeGray(gray)
+		}
+		return gray, nil
+	}
+	return f, nil
+}
+
+// toGray returns img as a grayscale bitmap, converting it if needed.
+func toGray(img image.Image) *image.Gray {
+	if g, ok := img.(*image.Gray); ok {
+		return g
+	}
+	b := img.Bounds()
+	g := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			g.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return g
+}
+
+// transposeGray swaps the rows and columns of a bitmap.
+func transposeGray(img *image.Gray) *image.Gray {
+	b := img.Bounds()
+	out := image.NewGray(image.Rect(0, 0, b.Dy(), b.Dx()))
+	for y := 0; y < b.Dy(); y++ {
+		row := img.Pix[y*img.Stride : y*img.Stride+b.Dx()]
+		for x, v := range row {
+			out.Pix[x*out.Stride+y] = v
+		}
+	}
+	return out
+}
@@ -12,8 +12,11 @@ type Point2D struct {
 type Contour []Point2D
 
 // SliceAtZ intersects the mesh with a horizontal plane at the given Z height
-// and returns closed contours.
-func SliceAtZ(mesh *Mesh, z float32) []Contour {
+// and returns the contours of the layer. Contours that could not be closed are
+// still returned when they have at least 3 points (the rasterizer closes them
+// implicitly); openContours reports how many chains failed to close so the
+// caller can surface it as a diagnostic.
+func SliceAtZ(mesh *Mesh, z float32) (contours []Contour, openContours int) {
 	var segments [][2]Point2D
 
 	for i := range mesh.Triangles {
@@ -25,10 +28,16 @@ func SliceAtZ(mesh *Mesh, z float32) []Contour {
 	}
 
 	if len(segments) == 0 {
-		return nil
+		return nil, 0
 	}
 
-	return linkSegments(segments)
+	closed, open := linkSegments(segments)
+	for _, c := range open {
+		if len(c) >= 3 {
+			closed = append(closed, c)
+		}
+	}
+	return closed, len(open)
 }
 
 // intersectTrianglePlane finds the intersection of a triangle with a Z plane.
@@ -95,80 +104,151 @@ func intersectTrianglePlane(tri *Triangle, z float32) (p1, p2 Point2D, ok bool)
 		return Point2D{}, Point2D{}, false
 	}
 
+	// Orient the segment so the solid is on its left: with outward-facing
+	// triangles, outer contours then run counter-clockwise and holes
+	// clockwise, which the nonzero fill rule relies on.
+	ux, uy, uz := verts[1][0]-verts[0][0], verts[1][1]-verts[0][1], verts[1][2]-verts[0][2]
+	vx, vy, vz := verts[2][0]-verts[0][0], verts[2][1]-verts[0][1], verts[2][2]-verts[0][2]
+	nx := float64(uy*vz - uz*vy)
+	ny := float64(uz*vx - ux*vz)
+	if (points[1].X-points[0].X)*-ny+(points[1].Y-points[0].Y)*nx < 0 {
+		points[0], points[1] = points[1], points[0]
+	}
+
 	return points[0], points[1], true
 }
 
 const linkEpsilon = 0.001 // mm tolerance for linking segments
 
-// linkSegments connects line segments into closed contours.
-func linkSegments(segments [][2]Point2D) []Contour {
-	if len(segments) == 0 {
-		return nil
-	}
+// cellKey identifies a cell of the quantized endpoint grid. Cells are
+// linkEpsilon wide, so any two points within linkEpsilon of each other lie in
+// the same or in adjacent cells.
+type cellKey struct {
+	x, y int64
+}
 
-	used := make([]bool, len(segments))
-	var contours []Contour
+type endpointRef struct {
+	seg int
+	end int // 0 = start, 1 = end
+}
 
-	// Build a spatial index for segment endpoints
-	type endpointInfo struct {
-		segIdx int
-		end    int // 0 = start, 1 = end
+// segmentIndex is a spatial hash of segment endpoints used to find the next
+// segment of a chain in constant time instead of scanning the whole list.
+type segmentIndex struct {
+	segments [][2]Point2D
+	used     []bool
+	cells    map[cellKey][]endpointRef
+}
+
+func quantizePoint(p Point2D) cellKey {
+	return cellKey{
+		x: int64(math.Floor(p.X / linkEpsilon)),
+		y: int64(math.Floor(p.Y / linkEpsilon)),
 	}
+}
 
-	for {
-		// Find first unused segment
-		startIdx := -1
-		for i, u := range used {
-			if !u {
-				startIdx = i
-				break
+func newSegmentIndex(segments [][2]Point2D) *segmentIndex {
+	idx := &segmentIndex{
+		segments: segments,
+		used:     make([]bool, len(segments)),
+		cells:    make(map[cellKey][]endpointRef, len(segments)*2),
+	}
+	for i, seg := range segments {
+		for end := 0; end < 2; end++ {
+			k := quantizePoint(seg[end])
+			idx.cells[k] = append(idx.cells[k], endpointRef{seg: i, end: end})
+		}
+	}
+	return idx
+}
+
+// take finds an unused segment with an endpoint close to p, marks it used and
+// returns its opposite endpoint. Segments whose given end (0 = start, 1 = end)
+// touches p are preferred so that oriented chains keep their direction; the
+// other end is only used as a fallback for inconsistently wound meshes.
+func (idx *segmentIndex) take(p Point2D, end int) (Point2D, bool) {
+	k := quantizePoint(p)
+	for pass := 0; pass < 2; pass++ {
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for _, ref := range idx.cells[cellKey{x: k.x + dx, y: k.y + dy}] {
+					if (pass == 0) != (ref.end == end) {
+						continue
+					}
+					if idx.used[ref.seg] || !pointsClose(idx.segments[ref.seg][ref.end], p) {
+						continue
+					}
+					idx.used[ref.seg] = true
+					return idx.segments[ref.seg][1-ref.end], true
+				}
 			}
 		}
-		if startIdx < 0 {
-			break
+	}
+	return Point2D{}, false
+}
+
+// linkSegments connects line segments into contours. Chains whose ends meet
+// are returned as closed; the rest are returned as open.
+func linkSegments(segments [][2]Point2D) (closed, open []Contour) {
+	if len(segments) == 0 {
+		return nil, nil
+	}
+
+	idx := newSegmentIndex(segments)
+
+	for startIdx := range segments {
+		if idx.used[startIdx] {
+			continue
 		}
 
-		used[startIdx] = true
+		idx.used[startIdx] = true
 		contour := Contour{segments[startIdx][0], segments[startIdx][1]}
 		current := segments[startIdx][1]
+		isClosed := false
 
 		for {
-			found := false
-			for i, seg := range segments {
-				if used[i] {
-					continue
-				}
-
-				if pointsClose(seg[0], current) {
-					used[i] = true
-					contour = append(contour, seg[1])
-					current = seg[1]
-					found = true
-					break
-				}
-				if pointsClose(seg[1], current) {
-					used[i] = true
-					contour = append(contour, seg[0])
-					current = seg[0]
-					found = true
-					break
-				}
-			}
+			next, found := idx.take(current, 0)
 			if !found {
 				break
 			}
+			contour = append(contour, next)
+			current = next
 			// Check if contour is closed
 			if pointsClose(contour[0], current) {
+				isClosed = true
 				break
 			}
 		}
 
-		if len(contour) >= 3 {
-			contours = append(contours, contour)
+		if isClosed {
+			if len(contour) >= 3 {
+				closed = append(closed, contour)
+			}
+			continue
+		}
+
+		// The chain ran into a gap: extend it backwards from its start so the
+		// open contour is reported as one piece rather than several fragments.
+		var prefix Contour
+		current = contour[0]
+		for {
+			prev, found := idx.take(current, 1)
+			if !found {
+				break
+			}
+			prefix = append(prefix, prev)
+			current = prev
+		}
+		if len(prefix) > 0 {
+			for i, j := 0, len(prefix)-1; i < j; i, j = i+1, j-1 {
+				prefix[i], prefix[j] = prefix[j], prefix[i]
+			}
+			contour = append(prefix, contour...)
 		}
+		open = append(open, contour)
 	}
 
-	return contours
+	return closed, open
 }
 
 func pointsClose(a, b Point2D) bool {
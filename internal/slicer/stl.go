@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
@@ -112,7 +113,7 @@ func parseSTLBinary(f *os.File) (*Mesh, error) {
 	invalidFaces := 0
 
 	for i := uint32(0); i < faceCount; i++ {
-		if _, err := buf.Read(faceBuf); err != nil {
+		if _, err := io.ReadFull(buf, faceBuf); err != nil {
 			return nil, fmt.Errorf("read face %d: %w", i, err)
 		}
 
@@ -287,6 +288,35 @@ func parseSTLASCII(f *os.File) (*Mesh, error) {
 	return mesh, nil
 }
 
+// WriteSTLBinary writes the mesh as a binary STL. It is used to hand meshes
+// parsed from other formats to the browser viewer, which only reads STL.
+func WriteSTLBinary(w io.Writer, m *Mesh) error {
+	bw := bufio.NewWriter(w)
+
+	header := make([]byte, 84)
+	copy(header, "binary STL")
+	binary.LittleEndian.PutUint32(header[80:84], uint32(len(m.Triangles)))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	face := make([]byte, 50)
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		for j, v := range [4][3]float32{t.Normal, t.V1, t.V2, t.V3} {
+			off := j * 12
+			binary.LittleEndian.PutUint32(face[off:off+4], math.Float32bits(v[0]))
+			binary.LittleEndian.PutUint32(face[off+4:off+8], math.Float32bits(v[1]))
+			binary.LittleEndian.PutUint32(face[off+8:off+12], math.Float32bits(v[2]))
+		}
+		if _, err := bw.Write(face); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
+
 func updateBounds(mesh *Mesh, x, y, z float32) {
 	if x < mesh.MinBound[0] {
 		mesh.MinBound[0] = x
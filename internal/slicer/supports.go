@@ -0,0 +1,479 @@
+package slicer
+
+import (
+	"math"
+	"sort"
+
+	"3dmodels/internal/models"
+)
+
+// Support types
+const (
+	SupportPillar = "pillar"
+	SupportTree   = "tree"
+)
+
+const (
+	supportLiftMM       = 5.0  // gap between the plate and the lowest point of the model
+	raftThicknessMM     = 1.0  // raft slab under the supports
+	raftJoinMM          = 10.0 // support bases closer than this share a raft
+	supportTipLengthMM  = 2.0  // length of the cone that touches the model
+	supportPenetration  = 0.2  // how far the tip sinks into the model
+	supportSides        = 8    // facets of support cylinders
+	supportRayMarginMM  = 0.05 // ignore hits this close above a support point
+	minSupportSpacingMM = 2.0
+	maxSupportSpacingMM = 10.0
+)
+
+// supportPoint is a spot on the underside of the model that needs support.
+// landZ is the model surface below it, or NaN when the support reaches the plate.
+type supportPoint struct {
+	x, y, z float64
+	landZ   float64
+}
+
+// supportBuilder accumulates the support geometry as closed solids.
+type supportBuilder struct {
+	mesh    *Mesh
+	tipR    float64
+	pillarR float64
+	raftTop float64
+	bases   [][2]float64 // plate contact points, for the raft
+}
+
+// GenerateSupports lifts the model by supportLiftMM and builds supports for
+// its overhangs (faces flatter than SupportAngleDeg from horizontal) and its
+// hanging local minima. Supports are tapered pillars or trees, standing on a
+// raft; points above another part of the model land on it instead. The model
+// is moved in place; the returned mesh holds the supports and the raft, and
+// count is the number of support tips.
+func GenerateSupports(m *Mesh, settings *models.PrintSettings) (supports *Mesh, count int) {
+	m.Translate(0, 0, float32(supportLiftMM-float64(m.MinBound[2])))
+
+	tipR := settings.SupportTipDiameterMM / 2
+	if tipR <= 0 {
+		tipR = 0.2
+	}
+	b := &supportBuilder{
+		mesh:    newEmptyMesh(),
+		tipR:    tipR,
+		pillarR: math.Max(tipR*3, 0.6),
+		raftTop: raftThicknessMM,
+	}
+
+	density := math.Max(1, math.Min(settings.SupportDensityPct, 100))
+	spacing := maxSupportSpacingMM - (maxSupportSpacingMM-minSupportSpacingMM)*density/100
+	angle := settings.SupportAngleDeg
+	if angle <= 0 || angle >= 90 {
+		angle = 45
+	}
+
+	grid := newTriangleGrid(m, 2.0)
+	points := findSupportPoints(m, spacing, angle)
+	for i := range points {
+		points[i].landZ = grid.highestBelow(points[i].x, points[i].y, points[i].z-supportRayMarginMM)
+	}
+
+	var ground []supportPoint
+	for _, p := range points {
+		if math.IsNaN(p.landZ) {
+			ground = append(ground, p)
+			continue
+		}
+		// Too short a gap to need a support: the model nearly touches itself
+		if p.z-p.landZ < supportTipLengthMM*2 {
+			continue
+		}
+		b.pillar(p)
+		count++
+	}
+
+	if settings.SupportType == SupportTree {
+		count += b.trees(ground, spacing*3, grid)
+	} else {
+		for _, p := range ground {
+			b.pillar(p)
+			count++
+		}
+	}
+
+	b.raft()
+	return b.mesh, count
+}
+
+// findSupportPoints samples the overhanging faces on a grid with the given
+// spacing and adds every hanging local minimum of the mesh.
+func findSupportPoints(m *Mesh, spacing, angleDeg float64) []supportPoint {
+	// A face needs support when its normal is within angle degrees of straight
+	// down, i.e. the face is flatter than angle from horizontal
+	minDown := math.Cos(angleDeg * math.Pi / 180)
+
+	type cell struct{ x, y int }
+	sampled := make(map[cell][]float64)
+	var points []supportPoint
+	add := func(x, y, z float64) {
+		k := cell{int(math.Floor(x / spacing)), int(math.Floor(y / spacing))}
+		for _, oz := range sampled[k] {
+			if math.Abs(oz-z) < spacing {
+				return
+			}
+		}
+		sampled[k] = append(sampled[k], z)
+		points = append(points, supportPoint{x: x, y: y, z: z})
+	}
+
+	im := weldVertices(m, &models.MeshRepairReport{})
+
+	for _, f := range im.faces {
+		a, b, c := im.verts[f[0]], im.verts[f[1]], im.verts[f[2]]
+		n := faceNormal(toF32(a), toF32(b), toF32(c))
+		if float64(-n[2]) < minDown {
+			continue
+		}
+		minX := math.Min(a[0], math.Min(b[0], c[0]))
+		maxX := math.Max(a[0], math.Max(b[0], c[0]))
+		minY := math.Min(a[1], math.Min(b[1], c[1]))
+		maxY := math.Max(a[1], math.Max(b[1], c[1]))
+		for gx := math.Ceil(minX / spacing); gx*spacing <= maxX; gx++ {
+			for gy := math.Ceil(minY / spacing); gy*spacing <= maxY; gy++ {
+				x, y := gx*spacing, gy*spacing
+				if z, ok := triangleZAt(a, b, c, x, y); ok {
+					add(x, y, z)
+				}
+			}
+		}
+	}
+
+	// Hanging local minima: lower than all their neighbours, on a surface
+	// that faces down. Small islands between grid points are caught here.
+	lowest := make([]float64, len(im.verts))
+	for i := range lowest {
+		lowest[i] = math.Inf(1)
+	}
+	normalZ := make([]float64, len(im.verts))
+	for _, f := range im.faces {
+		n := faceNormal(toF32(im.verts[f[0]]), toF32(im.verts[f[1]]), toF32(im.verts[f[2]]))
+		for k := 0; k < 3; k++ {
+			v := f[k]
+			normalZ[v] += float64(n[2])
+			for _, o := range []int{f[(k+1)%3], f[(k+2)%3]} {
+				lowest[v] = math.Min(lowest[v], im.verts[o][2])
+			}
+		}
+	}
+	for i, v := range im.verts {
+		if v[2] < lowest[i] && normalZ[i] < 0 {
+			add(v[0], v[1], v[2])
+		}
+	}
+	return points
+}
+
+func toF32(v [3]float64) [3]float32 {
+	return [3]float32{float32(v[0]), float32(v[1]), float32(v[2])}
+}
+
+// triangleZAt returns the height of the triangle at (x, y) if that point lies
+// inside its XY projection.
+func triangleZAt(a, b, c [3]float64, x, y float64) (float64, bool) {
+	d := (b[1]-c[1])*(a[0]-c[0]) + (c[0]-b[0])*(a[1]-c[1])
+	if math.Abs(d) < 1e-12 {
+		return 0, false
+	}
+	l1 := ((b[1]-c[1])*(x-c[0]) + (c[0]-b[0])*(y-c[1])) / d
+	l2 := ((c[1]-a[1])*(x-c[0]) + (a[0]-c[0])*(y-c[1])) / d
+	l3 := 1 - l1 - l2
+	const eps = -1e-9
+	if l1 < eps || l2 < eps || l3 < eps {
+		return 0, false
+	}
+	return l1*a[2] + l2*b[2] + l3*c[2], true
+}
+
+// triangleGrid buckets triangles by their XY bounding box for vertical ray casts.
+type triangleGrid struct {
+	mesh  *Mesh
+	size  float64
+	cells map[[2]int][]int
+}
+
+func newTriangleGrid(m *Mesh, size float64) *triangleGrid {
+	g := &triangleGrid{mesh: m, size: size, cells: make(map[[2]int][]int)}
+	for i := range m.Triangles {
+		t := &m.Triangles[i]
+		minX := math.Min(float64(t.V1[0]), math.Min(float64(t.V2[0]), float64(t.V3[0])))
+		maxX := math.Max(float64(t.V1[0]), math.Max(float64(t.V2[0]), float64(t.V3[0])))
+		minY := math.Min(float64(t.V1[1]), math.Min(float64(t.V2[1]), float64(t.V3[1])))
+		maxY := math.Max(float64(t.V1[1]), math.Max(float64(t.V2[1]), float64(t.V3[1])))
+		for cx := int(math.Floor(minX / size)); cx <= int(math.Floor(maxX/size)); cx++ {
+			for cy := int(math.Floor(minY / size)); cy <= int(math.Floor(maxY/size)); cy++ {
+				g.cells[[2]int{cx, cy}] = append(g.cells[[2]int{cx, cy}], i)
+			}
+		}
+	}
+	return g
+}
+
+// highestBelow returns the highest mesh surface at (x, y) below z, or NaN.
+func (g *triangleGrid) highestBelow(x, y, z float64) float64 {
+	best := math.NaN()
+	k := [2]int{int(math.Floor(x / g.size)), int(math.Floor(y / g.size))}
+	for _, i := range g.cells[k] {
+		t := &g.mesh.Triangles[i]
+		hz, ok := triangleZAt(toF64(t.V1), toF64(t.V2), toF64(t.V3), x, y)
+		if ok && hz < z && (math.IsNaN(best) || hz > best) {
+			best = hz
+		}
+	}
+	return best
+}
+
+func toF64(v [3]float32) [3]float64 {
+	return [3]float64{float64(v[0]), float64(v[1]), float64(v[2])}
+}
+
+// pillar builds a straight support under p: a contact cone, a column and a
+// flared foot on the raft, or a second cone where it lands on the model.
+func (b *supportBuilder) pillar(p supportPoint) {
+	top := [3]float64{p.x, p.y, p.z + supportPenetration}
+	neck := [3]float64{p.x, p.y, p.z - supportTipLengthMM}
+
+	var bottom [3]float64
+	if math.IsNaN(p.landZ) {
+		bottom = [3]float64{p.x, p.y, b.raftTop}
+		b.frustum([3]float64{p.x, p.y, b.raftTop - supportPenetration}, [3]float64{p.x, p.y, b.raftTop + 1}, b.pillarR*2, b.pillarR)
+		b.bases = append(b.bases, [2]float64{p.x, p.y})
+	} else {
+		bottom = [3]float64{p.x, p.y, p.landZ + supportTipLengthMM}
+		if bottom[2] > neck[2] {
+			bottom[2] = (p.landZ + p.z) / 2
+			neck[2] = bottom[2]
+		}
+		b.frustum([3]float64{p.x, p.y, p.landZ - supportPenetration}, bottom, b.tipR, b.pillarR)
+	}
+
+	if neck[2] > bottom[2] {
+		b.frustum(bottom, neck, b.pillarR, b.pillarR)
+	}
+	b.frustum(neck, top, b.pillarR, b.tipR)
+}
+
+// trees groups the plate-bound points by grid cell and joins each group with
+// 45 degree branches to a shared trunk. Points whose branch would end too low,
+// and groups whose trunk would cross the model, get plain pillars.
+func (b *supportBuilder) trees(points []supportPoint, cellMM float64, grid *triangleGrid) int {
+	groups := make(map[[2]int][]supportPoint)
+	var keys [][2]int
+	for _, p := range points {
+		k := [2]int{int(math.Floor(p.x / cellMM)), int(math.Floor(p.y / cellMM))}
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], p)
+	}
+	// Deterministic output regardless of map order
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	count := 0
+	trunkR := b.pillarR * 1.5
+	for _, k := range keys {
+		group := groups[k]
+		var cx, cy float64
+		for _, p := range group {
+			cx += p.x
+			cy += p.y
+		}
+		cx /= float64(len(group))
+		cy /= float64(len(group))
+
+		type branch struct {
+			p     supportPoint
+			joinZ float64
+		}
+		var branches []branch
+		trunkTop := 0.0
+		for _, p := range group {
+			joinZ := p.z - supportTipLengthMM - math.Hypot(p.x-cx, p.y-cy)
+			if len(group) < 2 || joinZ < b.raftTop+supportTipLengthMM {
+				b.pillar(p)
+				count++
+				continue
+			}
+			branches = append(branches, branch{p, joinZ})
+			trunkTop = math.Max(trunkTop, joinZ)
+		}
+		if len(branches) == 0 {
+			continue
+		}
+		if len(branches) == 1 || !math.IsNaN(grid.highestBelow(cx, cy, trunkTop+trunkR)) {
+			for _, br := range branches {
+				b.pillar(br.p)
+				count++
+			}
+			continue
+		}
+
+		b.frustum([3]float64{cx, cy, b.raftTop - supportPenetration}, [3]float64{cx, cy, b.raftTop + 1}, trunkR*2, trunkR)
+		b.frustum([3]float64{cx, cy, b.raftTop}, [3]float64{cx, cy, trunkTop + trunkR}, trunkR, trunkR)
+		b.bases = append(b.bases, [2]float64{cx, cy})
+		for _, br := range branches {
+			p := br.p
+			neck := [3]float64{p.x, p.y, p.z - supportTipLengthMM}
+			b.frustum([3]float64{cx, cy, br.joinZ}, neck, b.pillarR, b.pillarR)
+			b.frustum(neck, [3]float64{p.x, p.y, p.z + supportPenetration}, b.pillarR, b.tipR)
+			count++
+		}
+	}
+	return count
+}
+
+// frustum adds a closed truncated cone from center c0 (radius r0) to c1 (radius r1).
+func (b *supportBuilder) frustum(c0, c1 [3]float64, r0, r1 float64) {
+	axis := [3]float64{c1[0] - c0[0], c1[1] - c0[1], c1[2] - c0[2]}
+	l := math.Sqrt(axis[0]*axis[0] + axis[1]*axis[1] + axis[2]*axis[2])
+	if l < 1e-6 {
+		return
+	}
+	for k := range axis {
+		axis[k] /= l
+	}
+	// u, v span the plane perpendicular to the axis with u x v = axis
+	ref := [3]float64{1, 0, 0}
+	if math.Abs(axis[0]) > 0.9 {
+		ref = [3]float64{0, 1, 0}
+	}
+	u := normalize(cross(ref, axis))
+	v := cross(axis, u)
+
+	ring := func(c [3]float64, r float64) [supportSides][3]float32 {
+		var pts [supportSides][3]float32
+		for i := 0; i < supportSides; i++ {
+			s, co := math.Sincos(2 * math.Pi * float64(i) / supportSides)
+			for k := 0; k < 3; k++ {
+				pts[i][k] = float32(c[k] + r*(co*u[k]+s*v[k]))
+			}
+		}
+		return pts
+	}
+	bottom, top := ring(c0, r0), ring(c1, r1)
+	bc, tc := toF32(c0), toF32(c1)
+	for i := 0; i < supportSides; i++ {
+		j := (i + 1) % supportSides
+		b.mesh.addTriangle(bottom[i], bottom[j], top[j])
+		b.mesh.addTriangle(bottom[i], top[j], top[i])
+		b.mesh.addTriangle(bc, bottom[j], bottom[i])
+		b.mesh.addTriangle(tc, top[i], top[j])
+	}
+}
+
+// raft joins nearby support bases into slabs shaped like their convex hull.
+func (b *supportBuilder) raft() {
+	n := len(b.bases)
+	if n == 0 {
+		return
+	}
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if math.Hypot(b.bases[i][0]-b.bases[j][0], b.bases[i][1]-b.bases[j][1]) < raftJoinMM {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	clusters := make(map[int][][2]float64)
+	var roots []int
+	margin := b.pillarR*2 + 1
+	for i, base := range b.bases {
+		r := find(i)
+		if _, ok := clusters[r]; !ok {
+			roots = append(roots, r)
+		}
+		for k := 0; k < supportSides; k++ {
+			s, c := math.Sincos(2 * math.Pi * float64(k) / supportSides)
+			clusters[r] = append(clusters[r], [2]float64{base[0] + margin*c, base[1] + margin*s})
+		}
+	}
+	for _, r := range roots {
+		b.prism(convexHull(clusters[r]), 0, raftThicknessMM)
+	}
+}
+
+// prism extrudes a counter-clockwise convex polygon between z0 and z1.
+func (b *supportBuilder) prism(poly [][2]float64, z0, z1 float64) {
+	if len(poly) < 3 {
+		return
+	}
+	at := func(p [2]float64, z float64) [3]float32 {
+		return [3]float32{float32(p[0]), float32(p[1]), float32(z)}
+	}
+	for i := range poly {
+		j := (i + 1) % len(poly)
+		b.mesh.addTriangle(at(poly[i], z0), at(poly[j], z0), at(poly[j], z1))
+		b.mesh.addTriangle(at(poly[i], z0), at(poly[j], z1), at(poly[i], z1))
+	}
+	for i := 1; i+1 < len(poly); i++ {
+		b.mesh.addTriangle(at(poly[0], z1), at(poly[i], z1), at(poly[i+1], z1))
+		b.mesh.addTriangle(at(poly[0], z0), at(poly[i+1], z0), at(poly[i], z0))
+	}
+}
+
+// convexHull returns the counter-clockwise convex hull of pts (monotone chain).
+func convexHull(pts [][2]float64) [][2]float64 {
+	sort.Slice(pts, func(i, j int) bool {
+		if pts[i][0] != pts[j][0] {
+			return pts[i][0] < pts[j][0]
+		}
+		return pts[i][1] < pts[j][1]
+	})
+	turn := func(o, a, b [2]float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	hull := make([][2]float64, 0, 2*len(pts))
+	for _, p := range pts {
+		for len(hull) >= 2 && turn(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	lower := len(hull) + 1
+	for i := len(pts) - 2; i >= 0; i-- {
+		p := pts[i]
+		for len(hull) >= lower && turn(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+func cross(a, b [3]float64) [3]float64 {
+	return [3]float64{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func normalize(v [3]float64) [3]float64 {
+	l := math.Sqrt(v[0]*v[0] + v[1]*v[1] + v[2]*v[2])
+	if l == 0 {
+		return v
+	}
+	return [3]float64{v[0] / l, v[1] / l, v[2] / l}
+}
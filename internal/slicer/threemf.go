@@ -0,0 +1,294 @@
+package slicer
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const threeMFModelRelType = "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+
+// 3MF unit attribute -> millimeters
+var threeMFUnits = map[string]float64{
+	"micron":     0.001,
+	"millimeter": 1,
+	"centimeter": 10,
+	"inch":       25.4,
+	"foot":       304.8,
+	"meter":      1000,
+}
+
+type threeMFRels struct {
+	Relationships []struct {
+		Target string `xml:"Target,attr"`
+		Type   string `xml:"Type,attr"`
+	} `xml:"Relationship"`
+}
+
+type threeMFModel struct {
+	Unit    string          `xml:"unit,attr"`
+	Objects []threeMFObject `xml:"resources>object"`
+	Items   []threeMFItem   `xml:"build>item"`
+}
+
+type threeMFObject struct {
+	ID       int    `xml:"id,attr"`
+	Type     string `xml:"type,attr"`
+	Vertices []struct {
+		X float64 `xml:"x,attr"`
+		Y float64 `xml:"y,attr"`
+		Z float64 `xml:"z,attr"`
+	} `xml:"mesh>vertices>vertex"`
+	Triangles []struct {
+		V1 int `xml:"v1,attr"`
+		V2 int `xml:"v2,attr"`
+		V3 int `xml:"v3,attr"`
+	} `xml:"mesh>triangles>triangle"`
+	Components []threeMFItem `xml:"components>component"`
+}
+
+// threeMFItem is used both for build items and for object components.
+// Path is the production extension attribute that points to another model part.
+type threeMFItem struct {
+	ObjectID  int    `xml:"objectid,attr"`
+	Transform string `xml:"transform,attr"`
+	Path      string `xml:"path,attr"`
+}
+
+// affine3MF is a 3MF transform: a 4x3 matrix applied to row vectors,
+// stored as m00 m01 m02 m10 m11 m12 m20 m21 m22 m30 m31 m32.
+type affine3MF [12]float64
+
+var identity3MF = affine3MF{1, 0, 0, 0, 1, 0, 0, 0, 1, 0, 0, 0}
+
+func parseAffine3MF(s string) (affine3MF, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return identity3MF, nil
+	}
+	if len(fields) != 12 {
+		return affine3MF{}, fmt.Errorf("transform needs 12 values, got %d", len(fields))
+	}
+	var m affine3MF
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return affine3MF{}, fmt.Errorf("invalid transform value %q", f)
+		}
+		m[i] = v
+	}
+	return m, nil
+}
+
+func (m affine3MF) apply(x, y, z float64) (float64, float64, float64) {
+	return x*m[0] + y*m[3] + z*m[6] + m[9],
+		x*m[1] + y*m[4] + z*m[7] + m[10],
+		x*m[2] + y*m[5] + z*m[8] + m[11]
+}
+
+// then returns the transform that applies m first and n second.
+func (m affine3MF) then(n affine3MF) affine3MF {
+	var r affine3MF
+	for row := 0; row < 3; row++ {
+		for col := 0; col < 3; col++ {
+			r[row*3+col] = m[row*3]*n[col] + m[row*3+1]*n[3+col] + m[row*3+2]*n[6+col]
+		}
+	}
+	r[9], r[10], r[11] = n.apply(m[9], m[10], m[11])
+	return r
+}
+
+func (m affine3MF) determinant() float64 {
+	return m[0]*(m[4]*m[8]-m[5]*m[7]) -
+		m[1]*(m[3]*m[8]-m[5]*m[6]) +
+		m[2]*(m[3]*m[7]-m[4]*m[6])
+}
+
+// threeMFReader resolves objects across the model parts of a 3MF package.
+type threeMFReader struct {
+	files  map[string]*zip.File
+	parts  map[string]*threeMFModel
+	mesh   *Mesh
+	scale  float64
+	depth  int
+	badTri int
+}
+
+// Parse3MF reads a 3MF package and returns the mesh of every build item, with
+// the item and component transforms applied and coordinates converted to mm.
+func Parse3MF(filePath string) (*Mesh, error) {
+	zr, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("open 3MF: %w", err)
+	}
+	defer zr.Close()
+
+	r := &threeMFReader{
+		files: make(map[string]*zip.File, len(zr.File)),
+		parts: make(map[string]*threeMFModel),
+		mesh:  newEmptyMesh(),
+	}
+	for _, f := range zr.File {
+		r.files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	rootPath, err := r.rootModelPath()
+	if err != nil {
+		return nil, err
+	}
+	root, err := r.part(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := root.Unit
+	if unit == "" {
+		unit = "millimeter"
+	}
+	scale, ok := threeMFUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("unsupported 3MF unit %q", unit)
+	}
+	r.scale = scale
+
+	if len(root.Items) == 0 {
+		return nil, fmt.Errorf("3MF has no build items")
+	}
+	for _, item := range root.Items {
+		m, err := parseAffine3MF(item.Transform)
+		if err != nil {
+			return nil, fmt.Errorf("build item %d: %w", item.ObjectID, err)
+		}
+		partPath := rootPath
+		if item.Path != "" {
+			partPath = strings.TrimPrefix(item.Path, "/")
+		}
+		if err := r.addObject(partPath, item.ObjectID, m); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(r.mesh.Triangles) == 0 {
+		return nil, fmt.Errorf("no valid triangles found in 3MF file")
+	}
+	if r.badTri > 0 {
+		log.Printf("Warning: Repaired 3MF by removing %d invalid faces (kept %d triangles)", r.badTri, len(r.mesh.Triangles))
+	}
+
+	return r.mesh, nil
+}
+
+func (r *threeMFReader) rootModelPath() (string, error) {
+	if f, ok := r.files["_rels/.rels"]; ok {
+		var rels threeMFRels
+		if err := decodeZipXML(f, &rels); err != nil {
+			return "", fmt.Errorf("read 3MF relationships: %w", err)
+		}
+		for _, rel := range rels.Relationships {
+			if rel.Type == threeMFModelRelType {
+				return strings.TrimPrefix(rel.Target, "/"), nil
+			}
+		}
+	}
+	// Fall back to the conventional location
+	if _, ok := r.files["3D/3dmodel.model"]; ok {
+		return "3D/3dmodel.model", nil
+	}
+	return "", fmt.Errorf("3MF has no 3D model part")
+}
+
+func (r *threeMFReader) part(name string) (*threeMFModel, error) {
+	if m, ok := r.parts[name]; ok {
+		return m, nil
+	}
+	f, ok := r.files[name]
+	if !ok {
+		return nil, fmt.Errorf("3MF part %s not found", name)
+	}
+	var m threeMFModel
+	if err := decodeZipXML(f, &m); err != nil {
+		return nil, fmt.Errorf("read 3MF part %s: %w", path.Base(name), err)
+	}
+	r.parts[name] = &m
+	return &m, nil
+}
+
+func (r *threeMFReader) addObject(partPath string, objectID int, m affine3MF) error {
+	// Guard against component cycles
+	if r.depth > 32 {
+		return fmt.Errorf("3MF component nesting too deep")
+	}
+
+	part, err := r.part(partPath)
+	if err != nil {
+		return err
+	}
+
+	var obj *threeMFObject
+	for i := range part.Objects {
+		if part.Objects[i].ID == objectID {
+			obj = &part.Objects[i]
+			break
+		}
+	}
+	if obj == nil {
+		return fmt.Errorf("3MF object %d not found in %s", objectID, path.Base(partPath))
+	}
+	if obj.Type != "" && obj.Type != "model" {
+		// Support and other non-model objects are not printed
+		return nil
+	}
+
+	verts := make([][3]float32, len(obj.Vertices))
+	for i, v := range obj.Vertices {
+		x, y, z := m.apply(v.X, v.Y, v.Z)
+		verts[i] = [3]float32{float32(x * r.scale), float32(y * r.scale), float32(z * r.scale)}
+	}
+	// A mirroring transform flips the winding; swap two vertices to keep it CCW.
+	flip := m.determinant() < 0
+	for _, t := range obj.Triangles {
+		if t.V1 < 0 || t.V2 < 0 || t.V3 < 0 || t.V1 >= len(verts) || t.V2 >= len(verts) || t.V3 >= len(verts) {
+			r.badTri++
+			continue
+		}
+		a, b, c := verts[t.V1], verts[t.V2], verts[t.V3]
+		if flip {
+			b, c = c, b
+		}
+		if !r.mesh.addTriangle(a, b, c) {
+			r.badTri++
+		}
+	}
+
+	for _, comp := range obj.Components {
+		cm, err := parseAffine3MF(comp.Transform)
+		if err != nil {
+			return fmt.Errorf("component of object %d: %w", objectID, err)
+		}
+		compPath := partPath
+		if comp.Path != "" {
+			compPath = strings.TrimPrefix(comp.Path, "/")
+		}
+		r.depth++
+		err = r.addObject(compPath, comp.ObjectID, cm.then(m))
+		r.depth--
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeZipXML(f *zip.File, v any) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(io.LimitReader(rc, 2<<30)).Decode(v)
+}
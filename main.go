@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"3dmodels/internal/config"
@@ -65,7 +66,20 @@ func main() {
 	categoryHandler := handlers.NewCategoryHandler(categoryRepo)
 	authHandler := handlers.NewAuthHandler(userRepo, cfg.JWTSecret)
 	feedbackHandler := handlers.NewFeedbackHandler(feedbackRepo)
-	slicerEngine := slicer.NewEngine()
+	if n, err := slicerRepo.InterruptSliceJobs(); err != nil {
+		log.Printf("Failed to update interrupted slice jobs: %v", err)
+	} else if n > 0 {
+		log.Printf("Marked %d interrupted slice jobs as failed", n)
+	}
+	slicerEngine := slicer.NewEngine(slicerRepo, cfg.SliceOutputDir, cfg.SliceWorkers)
+	slicerEngine.StartRetention(ctx, func() int {
+		return settingsRepo.GetInt("slice_retention_days", handlers.DefaultSliceRetentionDays)
+	})
+	if err := slicerEngine.EnableCache(filepath.Join(cfg.SliceOutputDir, "cache"), func() int64 {
+		return int64(settingsRepo.GetInt("slice_cache_mb", handlers.DefaultSliceCacheMB)) << 20
+	}); err != nil {
+		log.Printf("Slice output cache disabled: %v", err)
+	}
 	slicerHandler := handlers.NewSlicerHandler(slicerRepo, modelRepo, slicerEngine, cfg.ScanPath)
 	duplicateHandler := handlers.NewDuplicateHandler(dupRepo, modelRepo, tagRepo, cfg.ScanPath)
 	langHandler := handlers.NewLangHandler()
@@ -114,15 +128,32 @@ func main() {
 
 		// Slicer
 		r.Get("/slicer", slicerHandler.Page)
+		r.Get("/slicer/history", slicerHandler.History)
 		r.Get("/api/slicer/profiles", slicerHandler.ListProfiles)
 		r.Post("/api/slicer/profiles", slicerHandler.CreateProfile)
+		r.Get("/api/slicer/profiles/export", slicerHandler.ExportProfiles)
+		r.Post("/api/slicer/profiles/import", slicerHandler.ImportProfiles)
 		r.Put("/api/slicer/profiles/{id}", slicerHandler.UpdateProfile)
 		r.Delete("/api/slicer/profiles/{id}", slicerHandler.DeleteProfile)
 		r.Get("/api/slicer/settings/{profileId}", slicerHandler.GetSettings)
+		r.Post("/api/slicer/profiles/{id}/settings", slicerHandler.CreateSettings)
 		r.Put("/api/slicer/settings/{id}", slicerHandler.UpdateSettings)
+		r.Delete("/api/slicer/settings/{id}", slicerHandler.DeleteSettings)
+		r.Post("/api/slicer/settings/{id}/clone", slicerHandler.CloneSettings)
+		r.Post("/api/slicer/settings/{id}/default", slicerHandler.SetDefaultSettings)
+		r.Post("/api/slicer/layout", slicerHandler.PlateLayout)
 		r.Post("/api/slicer/slice", slicerHandler.StartSlice)
 		r.Get("/api/slicer/status/{jobId}", slicerHandler.SliceStatus)
 		r.Get("/api/slicer/download/{jobId}", slicerHandler.Download)
+		r.Post("/api/slicer/jobs/{jobId}/cancel", slicerHandler.CancelJob)
+		r.Post("/api/slicer/history/{jobId}/reslice", slicerHandler.Reslice)
+		r.Get("/api/slicer/jobs/{jobId}/layers", slicerHandler.JobLayers)
+		r.Get("/api/slicer/jobs/{jobId}/layers/{n}.png", slicerHandler.JobLayerImage)
+		r.Get("/api/slicer/mesh/{fileId}", slicerHandler.MeshPreview)
+		r.Get("/api/slicer/mesh/{fileId}/check", slicerHandler.CheckMesh)
+		r.Get("/api/slicer/mesh/{fileId}/orient", slicerHandler.OrientMesh)
+		r.Get("/api/slicer/printfile/{fileId}", slicerHandler.PrintFileInfo)
+		r.Get("/api/slicer/printfile/{fileId}/preview/{n}", slicerHandler.PrintFilePreview)
 
 		// API - Models
 		r.Get("/api/models", modelHandler.List)
@@ -183,6 +214,8 @@ func main() {
 			r.Post("/api/settings/scan", settingsHandler.ForceScan)
 			r.Put("/api/settings", settingsHandler.SaveSettings)
 			r.Put("/api/settings/scanner-depth", settingsHandler.SaveScannerDepth)
+			r.Put("/api/settings/slice-retention", settingsHandler.SaveSliceRetention)
+			r.Put("/api/settings/slice-cache", settingsHandler.SaveSliceCache)
 			r.Put("/api/settings/ignored-folders", settingsHandler.SaveIgnoredFolders)
 			r.Post("/api/settings/ignored-folders/add", settingsHandler.AddIgnoredFolder)
 			r.Put("/api/settings/excluded-folders", settingsHandler.SaveExcludedFolders)
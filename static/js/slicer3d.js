@@ -318,10 +318,9 @@
     }
 
     // Load all files
+    // Non-STL files are served as binary STL by /api/slicer/mesh/{id}
     filesData.forEach(function(file) {
-        if (file.url.toLowerCase().endsWith('.stl')) {
-            loadSTLFile(file.url, addModelToScene);
-        }
+        loadSTLFile(file.url, addModelToScene);
     });
 
     // Public API for profile changes